@@ -0,0 +1,138 @@
+package mailbuilder
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+/**
+ * return m with a text/plain alternative rendered from its HTML body when
+ * the message has no text body: the HTML part (or the multipart/related
+ * holding it) is wrapped in a multipart/alternative; m itself is not
+ * modified, the changed nodes are copies
+ */
+func (c *MessageBuilder) withTextAlternative(m *Message) *Message {
+	if !hasOnlyHTMLBody(m) {
+		return m
+	}
+
+	mediaType := m.MediaType()
+	if mediaType == "text/html" || mediaType == "multipart/related" {
+		return c.wrapRootInAlternative(m)
+	}
+	if mediaType != "multipart/mixed" {
+		return m
+	}
+
+	for idx, part := range m.Parts {
+		partType := part.MediaType()
+		if part.Disposition() == "attachment" || (partType != "text/html" && partType != "multipart/related") {
+			continue
+		}
+		alternative := newTextAlternative(part, c.newlineFor(m))
+		if alternative == nil {
+			return m
+		}
+		root := *m
+		root.Parts = append([]*Message(nil), m.Parts...)
+		root.Parts[idx] = alternative
+		return &root
+	}
+	return m
+}
+
+// move the content of the root into a multipart/alternative; the other headers stay
+func (c *MessageBuilder) wrapRootInAlternative(m *Message) *Message {
+	content := *m
+	content.Header = make(textproto.MIMEHeader)
+	content.RawOriginalHeader = nil
+	content.HeaderOrder = nil
+	content.HeaderTerminator = nil
+	content.Parent = nil
+
+	root := copyRootHeader(m)
+	for _, key := range m.headerOrder() {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if !strings.HasPrefix(key, "Content-") || m.Header.Get(key) == "" {
+			continue
+		}
+		content.SetHeaderField(key, m.Header.Get(key))
+		root.DelHeaderField(key)
+	}
+
+	alternative := newTextAlternative(&content, c.newlineFor(m))
+	if alternative == nil {
+		return m
+	}
+	root.Body, root.BodyMessage, root.IsDecoded, root.RawBody = nil, nil, false, nil
+	root.Preamble, root.Epilogue, root.RawCloseDelimiter = nil, nil, nil
+	root.Boundary, root.MultipartSubtype = alternative.Boundary, alternative.MultipartSubtype
+	root.Parts = alternative.Parts
+	root.SetHeaderField("Content-Type", alternative.Header.Get("Content-Type"))
+	return root
+}
+
+// create a multipart/alternative with the text rendered from html and html itself
+func newTextAlternative(html *Message, nl string) *Message {
+	var p *Message
+	if html.MediaType() == "text/html" {
+		p = html
+	} else {
+		p = html.findTextBody("text/html")
+	}
+	if p == nil {
+		return nil
+	}
+	document, err := p.DecodedText()
+	if err != nil {
+		return nil
+	}
+	text, err := HTMLToText(document)
+	if err != nil {
+		return nil
+	}
+
+	alternative := NewMultipart("alternative", nil)
+	alternative.AddPart(NewTextPart(strings.ReplaceAll(text, "\n", nl) + nl))
+	alternative.Parts = append(alternative.Parts, html)
+	return alternative
+}
+
+/**
+ * create a text/plain UTF-8 part; the text is sent as 7bit when possible,
+ * quoted-printable or base64 otherwise
+ */
+func NewTextPart(text string) *Message {
+	p := NewPart("text/plain; charset=utf-8", nil, "7bit")
+	p.SetText(text)
+	return p
+}
+
+// check if a line of text is longer than limit bytes
+func hasLongLines(text string, limit int) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if len(strings.TrimRight(line, "\r")) > limit {
+			return true
+		}
+	}
+	return false
+}
+
+// check if the message body is HTML only: no text/plain body and no alternative
+func hasOnlyHTMLBody(m *Message) bool {
+	onlyHTML := m.findTextBody("text/html") != nil
+	m.Walk(func(p *Message) bool {
+		if p.IsRfc822() && p != m {
+			// a forwarded message has its own bodies
+			return false
+		}
+		switch {
+		case p.MediaType() == "multipart/alternative":
+			onlyHTML = false
+		case p.isTextLeaf() && p.MediaType() == "text/plain" && p.Disposition() != "attachment":
+			onlyHTML = false
+		}
+		return onlyHTML
+	})
+	return onlyHTML
+}
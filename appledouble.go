@@ -0,0 +1,200 @@
+package mailbuilder
+
+import (
+	"encoding/binary"
+	"errors"
+	"mime"
+	"net/textproto"
+	"strings"
+)
+
+// AppleSingle/AppleDouble (RFC 1740) magic numbers
+const (
+	appleSingleMagic = 0x00051600
+	appleDoubleMagic = 0x00051607
+)
+
+// AppleSingle/AppleDouble entry ids
+const (
+	AppleEntryDataFork     = 1
+	AppleEntryResourceFork = 2
+	AppleEntryRealName     = 3
+	AppleEntryComment      = 4
+	AppleEntryFinderInfo   = 9
+)
+
+var ErrInvalidAppleFile = errors.New("mailbuilder: invalid AppleSingle/AppleDouble header")
+
+// a parsed application/applefile header
+type AppleFile struct {
+	// true for AppleDouble (the data fork is in a separate part)
+	Double bool
+
+	// entry id -> entry content
+	Entries map[uint32][]byte
+}
+
+// return the original file name stored in the header
+func (a *AppleFile) RealName() string {
+	return string(a.Entries[AppleEntryRealName])
+}
+
+// return the resource fork
+func (a *AppleFile) ResourceFork() []byte {
+	return a.Entries[AppleEntryResourceFork]
+}
+
+// return the data fork (only AppleSingle files contain it)
+func (a *AppleFile) DataFork() []byte {
+	return a.Entries[AppleEntryDataFork]
+}
+
+// parse an AppleSingle/AppleDouble file
+func ParseAppleFile(data []byte) (*AppleFile, error) {
+	if len(data) < 26 {
+		return nil, ErrInvalidAppleFile
+	}
+	magic := binary.BigEndian.Uint32(data)
+	if magic != appleSingleMagic && magic != appleDoubleMagic {
+		return nil, ErrInvalidAppleFile
+	}
+
+	result := &AppleFile{
+		Double:  magic == appleDoubleMagic,
+		Entries: make(map[uint32][]byte),
+	}
+
+	// magic, version, 16 bytes filler, entries count
+	count := int(binary.BigEndian.Uint16(data[24:]))
+	if len(data) < 26+count*12 {
+		return nil, ErrInvalidAppleFile
+	}
+	for i := 0; i < count; i++ {
+		entry := data[26+i*12:]
+		id := binary.BigEndian.Uint32(entry)
+		offset := binary.BigEndian.Uint32(entry[4:])
+		length := binary.BigEndian.Uint32(entry[8:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, ErrInvalidAppleFile
+		}
+		result.Entries[id] = data[offset : offset+length]
+	}
+	return result, nil
+}
+
+// an AppleDouble attachment: the applefile header part and the data fork part
+type AppleDouble struct {
+	// the multipart/appledouble container
+	Container *Message
+
+	// the application/applefile part (resource fork, finder info)
+	Header *Message
+
+	// the real attachment
+	DataFork *Message
+
+	// the file name of the data fork, from its headers or from the applefile header
+	Filename string
+}
+
+// check if the part is a multipart/appledouble container
+func (c *Message) IsAppleDouble() bool {
+	return c.IsMultipart() && c.MediaType() == "multipart/appledouble"
+}
+
+/**
+ * return the AppleDouble description of a multipart/appledouble container;
+ * nil if the part is not a valid AppleDouble pair
+ */
+func (c *Message) AppleDouble() *AppleDouble {
+	if !c.IsAppleDouble() {
+		return nil
+	}
+	result := &AppleDouble{Container: c}
+	for _, p := range c.Parts {
+		if p.MediaType() == "application/applefile" {
+			result.Header = p
+		} else if result.DataFork == nil {
+			result.DataFork = p
+		}
+	}
+	if result.DataFork == nil {
+		return nil
+	}
+
+	result.Filename = result.DataFork.Filename()
+	if result.Filename == "" && result.Header != nil {
+		if data, err := result.Header.DecodedBody(); err == nil {
+			if header, err := ParseAppleFile(data); err == nil {
+				result.Filename = header.RealName()
+			}
+		}
+	}
+	return result
+}
+
+// return the AppleDouble attachments of the message
+func AppleDoubleAttachments(m *Message) []*AppleDouble {
+	var result []*AppleDouble
+	m.Walk(func(p *Message) bool {
+		if ad := p.AppleDouble(); ad != nil {
+			result = append(result, ad)
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+/**
+ * return the data fork as written in place of the container (see
+ * MessageBuilder.SetStripResourceForks): a data fork without a file name
+ * is a copy named after the applefile header
+ */
+func (ad *AppleDouble) namedDataFork() *Message {
+	if ad.Filename == "" || ad.DataFork.Filename() != "" {
+		return ad.DataFork
+	}
+	p := copyRootHeader(ad.DataFork)
+	p.setContentTypeParam("name", ad.Filename)
+	if p.Disposition() == "" {
+		p.SetHeaderField("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": ad.Filename}))
+	} else {
+		p.setDispositionParam("filename", ad.Filename)
+	}
+	return p
+}
+
+/**
+ * return m with the content of its data fork when the message itself is a
+ * multipart/appledouble container; the other header fields of m are kept
+ * and m is not modified
+ */
+func withRootDataFork(m *Message) *Message {
+	ad := m.AppleDouble()
+	if ad == nil {
+		return m
+	}
+	fork := ad.namedDataFork()
+
+	root := *fork
+	root.Header = make(textproto.MIMEHeader)
+	root.RawOriginalHeader, root.HeaderOrder, root.HeaderTerminator = nil, nil, nil
+	root.lazyHeader, root.changes = nil, nil
+	root.Newline, root.RawDelimiter, root.Idx, root.Parent = m.Newline, nil, m.Idx, nil
+	root.SMTPEnvelope, root.signatureProtection = m.SMTPEnvelope, m.signatureProtection
+
+	m.rangeHeaders(func(name, value string) bool {
+		if !strings.HasPrefix(textproto.CanonicalMIMEHeaderKey(name), "Content-") {
+			root.AddHeaderField(name, value)
+		}
+		return true
+	})
+	fork.rangeHeaders(func(name, value string) bool {
+		if strings.HasPrefix(textproto.CanonicalMIMEHeaderKey(name), "Content-") {
+			root.AddHeaderField(name, value)
+		}
+		return true
+	})
+	return &root
+}
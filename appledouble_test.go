@@ -0,0 +1,94 @@
+package mailbuilder
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// an AppleDouble header holding only the real name of the file
+func appleDoubleHeader(name string) string {
+	data := make([]byte, 38, 38+len(name))
+	binary.BigEndian.PutUint32(data, appleDoubleMagic)
+	binary.BigEndian.PutUint32(data[4:], 0x00020000)
+	binary.BigEndian.PutUint16(data[24:], 1)
+	binary.BigEndian.PutUint32(data[26:], AppleEntryRealName)
+	binary.BigEndian.PutUint32(data[30:], 38)
+	binary.BigEndian.PutUint32(data[34:], uint32(len(name)))
+	return base64.StdEncoding.EncodeToString(append(data, name...))
+}
+
+func TestStripResourceForks(t *testing.T) {
+	container := func(forkHeader string) string {
+		return "Content-Type: multipart/appledouble; boundary=ad\r\n\r\n" +
+			"--ad\r\nContent-Type: application/applefile\r\nContent-Transfer-Encoding: base64\r\n\r\n" + appleDoubleHeader("report.pdf") + "\r\n" +
+			"--ad\r\n" + forkHeader + "\r\nContent-Transfer-Encoding: base64\r\n\r\nJVBERi0=\r\n--ad--\r\n"
+	}
+	nested := func(forkHeader string) string {
+		return "Subject: files\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: text/plain\r\n\r\nsee attached\r\n" +
+			"--b\r\n" + container(forkHeader) + "\r\n--b--\r\n"
+	}
+
+	tests := []struct {
+		name     string
+		raw      string
+		filename string
+	}{
+		{"named data fork", nested("Content-Type: application/pdf; name=\"data.pdf\""), "data.pdf"},
+		{"unnamed data fork", nested("Content-Type: application/pdf"), "report.pdf"},
+		{"unnamed inline data fork", nested("Content-Type: application/pdf\r\nContent-Disposition: inline"), "report.pdf"},
+		{"root container", "Subject: files\r\n" + container("Content-Type: application/pdf"), "report.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewMessageDecomposer()
+			m, err := d.Decompose([]byte(tt.raw), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := NewMessageBuilder()
+			b.SetStripResourceForks(true)
+			out := b.Build(m)
+			if int64(len(out)) != b.EstimateSize(m) {
+				t.Errorf("built %d bytes, estimated %d", len(out), b.EstimateSize(m))
+			}
+			plain := NewMessageBuilder()
+			if string(plain.Build(m)) != tt.raw {
+				t.Error("the message was modified")
+			}
+
+			rebuilt, err := d.Decompose(out, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rebuilt.GetHeader("Subject") != "files" {
+				t.Errorf("lost the Subject: %q", out)
+			}
+			var forks []*Message
+			rebuilt.Walk(func(p *Message) bool {
+				if p.IsAppleDouble() || p.MediaType() == "application/applefile" {
+					t.Errorf("the container is still written: %q", out)
+				}
+				if p.MediaType() == "application/pdf" {
+					forks = append(forks, p)
+				}
+				return true
+			})
+			if len(forks) != 1 {
+				t.Fatalf("got %d data forks in %q", len(forks), out)
+			}
+			if got := forks[0].Filename(); got != tt.filename {
+				t.Errorf("got filename %q, want %q", got, tt.filename)
+			}
+			if body, _ := forks[0].DecodedBody(); string(body) != "%PDF-" {
+				t.Errorf("got data fork %q", body)
+			}
+			if strings.HasPrefix(tt.name, "unnamed inline") && forks[0].Disposition() != "inline" {
+				t.Errorf("got disposition %q, want inline", forks[0].Disposition())
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
+)
+
+var (
+	ErrNotARF = errors.New("mailbuilder: not an abuse report (ARF)")
+
+	ErrInvalidFeedbackReport = errors.New("mailbuilder: invalid feedback report (missing Feedback-Type or User-Agent)")
+)
+
+// a feedback report of the Abuse Reporting Format (RFC 5965)
+type FeedbackReport struct {
+	// abuse, fraud, virus, not-spam, auth-failure, other, ...
+	FeedbackType string
+
+	// the software which generated the report and the version of the format ("1")
+	UserAgent string
+	Version   string
+
+	// the SMTP envelope of the reported message
+	OriginalMailFrom   string
+	OriginalRcptTo     []string
+	OriginalEnvelopeID string
+
+	ArrivalDate time.Time
+
+	// the MTA which received the message (without the "dns;" type) and the IP of the sending client
+	ReportingMTA string
+	SourceIP     string
+
+	// the number of incidents the report stands for (0 if not given)
+	Incidents int
+
+	AuthenticationResults []string
+	ReportedDomains       []string
+	ReportedURIs          []string
+
+	// the human readable explanation
+	Text string
+
+	// the reported message or only its header
+	Original *Message
+}
+
+// options of NewARF
+type ARFOptions struct {
+	From    string
+	To      string
+	Subject string
+
+	// the human readable explanation; generated by default
+	Text string
+
+	// return only the header of the reported message (text/rfc822-headers)
+	HeadersOnly bool
+}
+
+/**
+ * parse an abuse report: the first multipart/report with
+ * report-type=feedback-report of the message; the machine readable fields
+ * come from the message/feedback-report part
+ */
+func ParseARF(m *Message) (*FeedbackReport, error) {
+	report := findReport(m, "feedback-report")
+	if report == nil {
+		return nil, ErrNotARF
+	}
+
+	fr := &FeedbackReport{}
+	found := false
+	for i, p := range report.Parts {
+		switch mediaType := p.MediaType(); {
+		case i == 0 && strings.HasPrefix(mediaType, "text/"):
+			fr.Text, _ = p.DecodedText()
+
+		case mediaType == "message/feedback-report":
+			body, err := p.DecodedBody()
+			if err != nil {
+				return nil, err
+			}
+			groups := dsnFieldGroups(body)
+			if len(groups) == 0 {
+				return nil, ErrNotARF
+			}
+			fields := groups[0]
+			fr.FeedbackType = strings.ToLower(strings.TrimSpace(fields.Get("Feedback-Type")))
+			fr.UserAgent = strings.TrimSpace(fields.Get("User-Agent"))
+			fr.Version = strings.TrimSpace(fields.Get("Version"))
+			fr.OriginalMailFrom = strings.TrimSpace(fields.Get("Original-Mail-From"))
+			fr.OriginalEnvelopeID = strings.TrimSpace(fields.Get("Original-Envelope-Id"))
+			fr.ArrivalDate, _ = ParseDate(fields.Get("Arrival-Date"))
+			fr.ReportingMTA = dsnTypedValue(fields.Get("Reporting-Mta"))
+			fr.SourceIP = strings.TrimSpace(fields.Get("Source-Ip"))
+			fr.Incidents, _ = strconv.Atoi(strings.TrimSpace(fields.Get("Incidents")))
+			fr.OriginalRcptTo = trimmedValues(fields["Original-Rcpt-To"])
+			fr.AuthenticationResults = trimmedValues(fields["Authentication-Results"])
+			fr.ReportedDomains = trimmedValues(fields["Reported-Domain"])
+			fr.ReportedURIs = trimmedValues(fields["Reported-Uri"])
+			if fr.FeedbackType == "" {
+				return nil, ErrNotARF
+			}
+			found = true
+
+		case p.IsRfc822() || reportedMediaTypes[mediaType]:
+			fr.Original = reportedMessage(p)
+		}
+	}
+	if !found {
+		return nil, ErrNotARF
+	}
+	return fr, nil
+}
+
+/**
+ * create an abuse report (RFC 5965) about orig: a multipart/report with the
+ * human readable text, the message/feedback-report part built from fr (the
+ * Text and Original fields are ignored) and the reported message
+ */
+func NewARF(orig *Message, fr *FeedbackReport, opts ARFOptions) (*Message, error) {
+	if fr.FeedbackType == "" || fr.UserAgent == "" {
+		return nil, ErrInvalidFeedbackReport
+	}
+
+	m := NewMessage()
+	m.SetDate(time.Now())
+	m.SetHeaderField("From", opts.From)
+	m.SetHeaderField("To", opts.To)
+	subject := opts.Subject
+	if subject == "" {
+		subject = "Abuse report (" + strings.ToLower(fr.FeedbackType) + ")"
+	}
+	m.SetHeaderField("Subject", encodeWords(subject))
+	m.SetHeaderField("Message-ID", GenerateMessageID(addressDomain(opts.From)))
+	m.SetHeaderField("MIME-Version", "1.0")
+	m.setMultipartContentType("report", map[string]string{"report-type": "feedback-report"})
+
+	text := opts.Text
+	if text == "" {
+		text = "This is an email abuse report for an email message"
+		if fr.SourceIP != "" {
+			text += " received from IP address " + fr.SourceIP
+		}
+		if !fr.ArrivalDate.IsZero() {
+			text += " on " + fr.ArrivalDate.Format(headerDateFormat)
+		}
+		text += ".\r\n"
+	}
+	m.AddPart(NewTextPart(text))
+	m.AddPart(NewPart("message/feedback-report", fr.fields(), "7bit"))
+
+	if err := addReported(m, orig, !opts.HeadersOnly); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// the body of the feedback report part
+func (fr *FeedbackReport) fields() []byte {
+	var b bytes.Buffer
+	field := func(name string, values ...string) {
+		for _, value := range values {
+			if value != "" {
+				b.WriteString(mailtextproto.FoldHeaderField(name, value, "\r\n") + "\r\n")
+			}
+		}
+	}
+
+	version := fr.Version
+	if version == "" {
+		version = "1"
+	}
+	field("Feedback-Type", strings.ToLower(fr.FeedbackType))
+	field("User-Agent", fr.UserAgent)
+	field("Version", version)
+	field("Original-Mail-From", fr.OriginalMailFrom)
+	field("Original-Rcpt-To", fr.OriginalRcptTo...)
+	field("Original-Envelope-Id", fr.OriginalEnvelopeID)
+	if !fr.ArrivalDate.IsZero() {
+		field("Arrival-Date", fr.ArrivalDate.Format(headerDateFormat))
+	}
+	if fr.ReportingMTA != "" {
+		field("Reporting-MTA", "dns; "+fr.ReportingMTA)
+	}
+	field("Source-IP", fr.SourceIP)
+	if fr.Incidents > 0 {
+		field("Incidents", strconv.Itoa(fr.Incidents))
+	}
+	field("Authentication-Results", fr.AuthenticationResults...)
+	field("Reported-Domain", fr.ReportedDomains...)
+	field("Reported-URI", fr.ReportedURIs...)
+	return b.Bytes()
+}
+
+// the values with the surrounding spaces removed
+func trimmedValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,233 @@
+package mailbuilder
+
+import (
+	"mime"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content-* headers describing the encoded content itself; they are not
+// carried over to a part generated to replace another one
+var contentHeadersNotPreserved = map[string]bool{
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+	"Content-Length":            true,
+	"Content-Md5":               true,
+}
+
+// description of an attachment (or inline resource) part
+type AttachmentInfo struct {
+	// part index in the message tree
+	Idx string
+
+	// lower case media type
+	ContentType string
+
+	// decoded file name ("" if the part has none)
+	Filename string
+
+	// lower case disposition type (attachment, inline) or ""
+	Disposition string
+
+	// Content-ID without the angle brackets
+	ContentID string
+
+	// decoded size (-1 if the body can't be decoded) and encoded size in bytes
+	Size        int
+	EncodedSize int
+
+	// the described part
+	Part *Message
+}
+
+// create the descriptor of a part
+func NewAttachmentInfo(p *Message) AttachmentInfo {
+	info := AttachmentInfo{
+		Idx:         p.Idx,
+		ContentType: p.MediaType(),
+		Filename:    p.Filename(),
+		Disposition: p.Disposition(),
+		ContentID:   p.ContentID(),
+		Size:        int(p.BodySize()),
+		EncodedSize: int(p.BodySize()),
+		Part:        p,
+	}
+	if p.BodyMessage != nil {
+		b := MessageBuilder{}
+		data := b.Build(p.BodyMessage)
+		info.Size = len(data)
+		info.EncodedSize = info.Size
+		if p.IsDecoded {
+			info.EncodedSize = len(EncodeByContentEncoding(data, p.ContentTransferEncoding()))
+		}
+	} else if size, err := p.decodedBodySize(); err == nil {
+		info.Size = size
+	} else {
+		info.Size = -1
+	}
+	return info
+}
+
+// parts of the signing and encryption protocols, never attachments
+var protocolMediaTypes = map[string]bool{
+	"application/pgp-signature":     true,
+	"application/pgp-encrypted":     true,
+	"application/pkcs7-signature":   true,
+	"application/x-pkcs7-signature": true,
+}
+
+/**
+ * check if the part is an attachment or an inline resource: a part with the
+ * attachment disposition or a file name, an attached message or a non text
+ * part (inline image, ...) of a multipart; the signatures and the
+ * encryption control parts are not attachments
+ */
+func (c *Message) IsAttachment() bool {
+	if c.IsMultipart() {
+		return false
+	}
+	if c.Disposition() == "attachment" || c.Filename() != "" {
+		return true
+	}
+	if c.Parent == nil {
+		return false
+	}
+	mediaType := c.MediaType()
+	if mediaType == "message/rfc822" || c.IsRfc822() {
+		return true
+	}
+	return !strings.HasPrefix(mediaType, "text/") && !protocolMediaTypes[mediaType]
+}
+
+/**
+ * return the attachments and inline resources of the message; an attached
+ * message is returned as one attachment, without the parts it contains
+ */
+func (c *Message) Attachments() []AttachmentInfo {
+	result := make([]AttachmentInfo, 0)
+	c.Walk(func(p *Message) bool {
+		if !p.IsAttachment() {
+			return true
+		}
+		result = append(result, NewAttachmentInfo(p))
+		return false
+	})
+	return result
+}
+
+// return the Content-ID without the angle brackets
+func (c *Message) ContentID() string {
+	return strings.Trim(strings.TrimSpace(c.Header.Get("Content-Id")), "<>")
+}
+
+// return the decoded Content-Description
+func (a AttachmentInfo) Description() string {
+	return a.Part.ContentDescription()
+}
+
+// return the Content-Duration (RFC 3803) used by audio/video parts
+func (a AttachmentInfo) Duration() (time.Duration, bool) {
+	return a.Part.ContentDuration()
+}
+
+// return the Content-* headers that survive a part rebuild
+func (a AttachmentInfo) ContentHeaders() textproto.MIMEHeader {
+	return preservedContentHeaders(a.Part)
+}
+
+// return the decoded Content-Description
+func (c *Message) ContentDescription() string {
+	return decodeHeaderWords(c.Header.Get("Content-Description"))
+}
+
+// return the Content-Duration (RFC 3803) in seconds
+func (c *Message) ContentDuration() (time.Duration, bool) {
+	value := strings.TrimSpace(c.Header.Get("Content-Duration"))
+	if value == "" {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// return the Content-* headers of m that describe the part and not its encoded
+// content (Content-Description, Content-Duration, Content-Disposition, ...)
+func preservedContentHeaders(m *Message) textproto.MIMEHeader {
+	result := make(textproto.MIMEHeader)
+	for key, values := range m.Header {
+		if !strings.HasPrefix(key, "Content-") || contentHeadersNotPreserved[key] {
+			continue
+		}
+		result[key] = append([]string(nil), values...)
+	}
+	return result
+}
+
+/**
+ * copy into dst the Content-* headers of src describing the part (and not its
+ * encoded content) so they survive when dst is generated to replace src;
+ * headers already set on dst are kept
+ */
+func CopyContentHeaders(dst, src *Message) {
+	for _, key := range src.headerOrder() {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		values, ok := src.Header[key]
+		if !ok || !strings.HasPrefix(key, "Content-") || contentHeadersNotPreserved[key] {
+			continue
+		}
+		if dst.Header.Get(key) != "" {
+			continue
+		}
+		dst.SetHeaderField(key, values[0])
+	}
+}
+
+// decode RFC 2047 words; the value is returned unchanged if it can't be decoded
+func decodeHeaderWords(value string) string {
+	decoder := mime.WordDecoder{}
+	decoded, err := decoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+/**
+ * return the decoded file name of the part: the Content-Disposition filename
+ * parameter (RFC 2231 continuations and charsets are supported) or the
+ * Content-Type name parameter; RFC 2047 encoded names are decoded too
+ */
+func (c *Message) Filename() string {
+	for _, field := range []string{"Content-Disposition", "Content-Type"} {
+		param := "filename"
+		if field == "Content-Type" {
+			param = "name"
+		}
+		_, params, err := mime.ParseMediaType(c.Header.Get(field))
+		if err != nil {
+			continue
+		}
+		if name := strings.TrimSpace(params[param]); name != "" {
+			return decodeHeaderWords(name)
+		}
+	}
+	return ""
+}
+
+// return the lower case disposition type of Content-Disposition (inline, attachment) or ""
+func (c *Message) Disposition() string {
+	disposition := c.Header.Get("Content-Disposition")
+	if disposition == "" {
+		return ""
+	}
+	dispositionType, _, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		dispositionType = strings.ToLower(strings.TrimSpace(strings.Split(disposition, ";")[0]))
+	}
+	return dispositionType
+}
@@ -0,0 +1,306 @@
+package mailbuilder
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidAuthResults = errors.New("mailbuilder: invalid Authentication-Results header")
+
+// an Authentication-Results header (RFC 8601)
+type AuthenticationResults struct {
+	// the server which made the checks
+	AuthServID string
+
+	// 1 if missing
+	Version int
+
+	// empty for "none"
+	Results []AuthResult
+}
+
+// the result of an authentication method
+type AuthResult struct {
+	// lower case method (spf, dkim, dmarc, arc, auth, ...) and its version (0 if missing)
+	Method        string
+	MethodVersion int
+
+	// lower case result (pass, fail, softfail, neutral, none, temperror, permerror, ...)
+	Result string
+
+	// the reason=value
+	Reason string
+
+	// the comment after the result ("sender IP is 192.0.2.1")
+	Comment string
+
+	// the properties by lower case "ptype.property" (smtp.mailfrom, header.d, ...)
+	Props map[string]string
+}
+
+// return a property value ("header.from", "smtp.mailfrom", ...)
+func (r AuthResult) Prop(name string) string {
+	return r.Props[strings.ToLower(name)]
+}
+
+/**
+ * parse the Authentication-Results headers of the message; when
+ * authservIDs is not empty only the headers added by these servers (the
+ * trusted ones, case insensitive) are returned, since a sender can add
+ * forged ones; the invalid headers are skipped
+ */
+func (c *Message) AuthenticationResults(authservIDs ...string) []AuthenticationResults {
+	result := make([]AuthenticationResults, 0)
+	for _, value := range c.GetHeaderValues("Authentication-Results") {
+		ar, err := ParseAuthenticationResults(value)
+		if err != nil {
+			continue
+		}
+		if len(authservIDs) > 0 && !containsFold(authservIDs, ar.AuthServID) {
+			continue
+		}
+		result = append(result, *ar)
+	}
+	return result
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse an Authentication-Results header value
+func ParseAuthenticationResults(value string) (*AuthenticationResults, error) {
+	statements, comments := splitAuthResults(value)
+	head := statements[0]
+	if len(head) == 0 || head[0] == "=" {
+		return nil, ErrInvalidAuthResults
+	}
+
+	ar := &AuthenticationResults{AuthServID: head[0], Version: 1}
+	if len(head) > 2 {
+		return nil, ErrInvalidAuthResults
+	}
+	if len(head) == 2 {
+		version, err := strconv.Atoi(head[1])
+		if err != nil {
+			return nil, ErrInvalidAuthResults
+		}
+		ar.Version = version
+	}
+
+	for n, tokens := range statements[1:] {
+		if len(tokens) == 0 {
+			continue
+		}
+		if len(tokens) == 1 && strings.EqualFold(tokens[0], "none") && len(statements) == 2 {
+			// no-result
+			break
+		}
+		if len(tokens) < 3 || tokens[1] != "=" {
+			return nil, ErrInvalidAuthResults
+		}
+		r := AuthResult{Result: strings.ToLower(tokens[2]), Props: make(map[string]string)}
+		if len(comments[n+1]) > 0 {
+			r.Comment = comments[n+1][0]
+		}
+		r.Method, _, _ = strings.Cut(strings.ToLower(tokens[0]), "/")
+		if _, version, ok := strings.Cut(tokens[0], "/"); ok {
+			r.MethodVersion, _ = strconv.Atoi(version)
+		}
+
+		for i := 3; i < len(tokens); i += 3 {
+			if i+2 >= len(tokens) || tokens[i+1] != "=" {
+				return nil, ErrInvalidAuthResults
+			}
+			name := strings.ToLower(tokens[i])
+			if name == "reason" {
+				r.Reason = tokens[i+2]
+				continue
+			}
+			r.Props[name] = tokens[i+2]
+		}
+		ar.Results = append(ar.Results, r)
+	}
+	return ar, nil
+}
+
+/**
+ * split the value in statements separated by ";" of tokens (words, quoted
+ * strings unquoted, "="); the comments of each statement are returned apart
+ */
+func splitAuthResults(value string) ([][]string, [][]string) {
+	statements := [][]string{{}}
+	comments := [][]string{{}}
+	add := func(token string) {
+		statements[len(statements)-1] = append(statements[len(statements)-1], token)
+	}
+	for i := 0; i < len(value); {
+		switch c := value[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == ';':
+			statements = append(statements, []string{})
+			comments = append(comments, []string{})
+			i++
+		case c == '=':
+			add("=")
+			i++
+		case c == '(':
+			var b strings.Builder
+			depth := 0
+			for ; i < len(value); i++ {
+				if value[i] == '\\' && i+1 < len(value) {
+					i++
+				} else if value[i] == '(' {
+					depth++
+					if depth == 1 {
+						continue
+					}
+				} else if value[i] == ')' {
+					depth--
+					if depth == 0 {
+						i++
+						break
+					}
+				}
+				b.WriteByte(value[i])
+			}
+			n := len(comments) - 1
+			comments[n] = append(comments[n], strings.TrimSpace(b.String()))
+		case c == '"':
+			var b strings.Builder
+			for i++; i < len(value) && value[i] != '"'; i++ {
+				if value[i] == '\\' && i+1 < len(value) {
+					i++
+				}
+				b.WriteByte(value[i])
+			}
+			add(b.String())
+			i++
+		default:
+			j := i
+			for j < len(value) && !strings.ContainsRune(" \t\r\n;=(\"", rune(value[j])) {
+				j++
+			}
+			add(value[i:j])
+			i = j
+		}
+	}
+	return statements, comments
+}
+
+/**
+ * stamp the message with the results of the checks made by ar.AuthServID:
+ * the field is inserted at the top of the header and the existing ones
+ * claiming the same authserv-id (forged by the sender, RFC 8601 section 5)
+ * are removed
+ */
+func (c *Message) SetAuthenticationResults(ar *AuthenticationResults) error {
+	value, err := ar.Format()
+	if err != nil {
+		return err
+	}
+
+	existing := c.GetHeaderValues("Authentication-Results")
+	kept := make([]string, 0, len(existing))
+	for _, v := range existing {
+		if other, err := ParseAuthenticationResults(v); err == nil && strings.EqualFold(other.AuthServID, ar.AuthServID) {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	if len(kept) < len(existing) {
+		c.DelHeaderField("Authentication-Results")
+		for i := len(kept) - 1; i >= 0; i-- {
+			c.PrependHeaderField("Authentication-Results", kept[i])
+		}
+	}
+	c.PrependHeaderField("Authentication-Results", value)
+	return nil
+}
+
+// format the header value; ErrInvalidAuthResults if a name is not a valid token
+func (ar *AuthenticationResults) Format() (string, error) {
+	if !isAuthResultsToken(ar.AuthServID, ".-_@") {
+		return "", ErrInvalidAuthResults
+	}
+	var b strings.Builder
+	b.WriteString(ar.AuthServID)
+	if ar.Version > 1 {
+		b.WriteString(" " + strconv.Itoa(ar.Version))
+	}
+	if len(ar.Results) == 0 {
+		b.WriteString("; none")
+		return b.String(), nil
+	}
+	for _, r := range ar.Results {
+		formatted, err := r.Format()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("; " + formatted)
+	}
+	return b.String(), nil
+}
+
+// format the result (method=result (comment) reason=... ptype.property=value ...); the properties are sorted
+func (r AuthResult) Format() (string, error) {
+	if !isAuthResultsToken(r.Method, "-_") || !isAuthResultsToken(r.Result, "-_") {
+		return "", ErrInvalidAuthResults
+	}
+	var b strings.Builder
+	b.WriteString(r.Method)
+	if r.MethodVersion > 0 {
+		b.WriteString("/" + strconv.Itoa(r.MethodVersion))
+	}
+	b.WriteString("=" + r.Result)
+	if r.Comment != "" {
+		comment := strings.NewReplacer("\\", "\\\\", "(", "\\(", ")", "\\)").Replace(r.Comment)
+		b.WriteString(" (" + comment + ")")
+	}
+	if r.Reason != "" {
+		b.WriteString(" reason=" + authResultsValue(r.Reason))
+	}
+
+	names := make([]string, 0, len(r.Props))
+	for name := range r.Props {
+		ptype, property, ok := strings.Cut(name, ".")
+		if !ok || !isAuthResultsToken(ptype, "-_") || !isAuthResultsToken(property, "-_.") {
+			return "", ErrInvalidAuthResults
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString(" " + strings.ToLower(name) + "=" + authResultsValue(r.Props[name]))
+	}
+	return b.String(), nil
+}
+
+// check if s is a non empty word of letters, digits and the extra characters
+func isAuthResultsToken(s, extra string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune(extra, c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// a property value, quoted if it is not a token (an address or a domain stays unquoted)
+func authResultsValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t;=()\"<>,[]:\\") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,130 @@
+package mailbuilder
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+var ErrInvalidAutocrypt = errors.New("mailbuilder: invalid Autocrypt header (missing addr or keydata, unknown critical attribute)")
+
+// the length of the keydata chunks; the header folding breaks the lines between them
+const autocryptChunkSize = 64
+
+// an Autocrypt or Autocrypt-Gossip header (Autocrypt Level 1)
+type Autocrypt struct {
+	// the address the key belongs to
+	Addr string
+
+	// prefer-encrypt=mutual (only in the Autocrypt header)
+	PreferEncrypt bool
+
+	// the OpenPGP transferable public key (binary)
+	KeyData []byte
+}
+
+/**
+ * parse the value of an Autocrypt or Autocrypt-Gossip header; the folding
+ * white space of the keydata is ignored and the unknown non-critical
+ * attributes (starting with "_") are skipped
+ */
+func ParseAutocrypt(value string) (*Autocrypt, error) {
+	a := &Autocrypt{}
+	var keyData string
+	for _, attribute := range strings.Split(value, ";") {
+		if strings.TrimSpace(attribute) == "" {
+			continue
+		}
+		name, attributeValue, found := strings.Cut(attribute, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !found {
+			return nil, ErrInvalidAutocrypt
+		}
+		switch name {
+		case "addr":
+			a.Addr = strings.TrimSpace(attributeValue)
+		case "prefer-encrypt":
+			a.PreferEncrypt = strings.EqualFold(strings.TrimSpace(attributeValue), "mutual")
+		case "keydata":
+			keyData = strings.Join(strings.Fields(attributeValue), "")
+		default:
+			if !strings.HasPrefix(name, "_") {
+				return nil, ErrInvalidAutocrypt
+			}
+		}
+	}
+	if a.Addr == "" || keyData == "" {
+		return nil, ErrInvalidAutocrypt
+	}
+	data, err := base64.StdEncoding.DecodeString(keyData)
+	if err != nil {
+		return nil, ErrInvalidAutocrypt
+	}
+	a.KeyData = data
+	return a, nil
+}
+
+/**
+ * return the header value; the base64 keydata is split in chunks separated
+ * by spaces so the header folding (mailtextproto.FoldHeaderField) writes it
+ * on lines of legal length
+ */
+func (a *Autocrypt) Format() string {
+	value := "addr=" + a.Addr + ";"
+	if a.PreferEncrypt {
+		value += " prefer-encrypt=mutual;"
+	}
+	keyData := base64.StdEncoding.EncodeToString(a.KeyData)
+	chunks := make([]string, 0, len(keyData)/autocryptChunkSize+1)
+	for len(keyData) > autocryptChunkSize {
+		chunks = append(chunks, keyData[:autocryptChunkSize])
+		keyData = keyData[autocryptChunkSize:]
+	}
+	chunks = append(chunks, keyData)
+	return value + " keydata=" + strings.Join(chunks, " ")
+}
+
+/**
+ * return the Autocrypt header of the message; nil when it is missing,
+ * invalid, present more than once or for another address than the From
+ * one (these headers are ignored by the Autocrypt clients)
+ */
+func (c *Message) Autocrypt() *Autocrypt {
+	values := c.GetHeaderValues("Autocrypt")
+	if len(values) != 1 {
+		return nil
+	}
+	a, err := ParseAutocrypt(values[0])
+	if err != nil {
+		return nil
+	}
+	from, err := mail.ParseAddress(decodeHeaderWords(c.GetHeader("From")))
+	if err != nil || !strings.EqualFold(from.Address, a.Addr) {
+		return nil
+	}
+	return a
+}
+
+// set the Autocrypt header of the message
+func (c *Message) SetAutocrypt(a *Autocrypt) {
+	c.SetHeaderField("Autocrypt", a.Format())
+}
+
+// return the valid Autocrypt-Gossip headers (found in the header of the encrypted content)
+func (c *Message) AutocryptGossip() []*Autocrypt {
+	var gossip []*Autocrypt
+	for _, value := range c.GetHeaderValues("Autocrypt-Gossip") {
+		if a, err := ParseAutocrypt(value); err == nil {
+			gossip = append(gossip, a)
+		}
+	}
+	return gossip
+}
+
+// add an Autocrypt-Gossip header for a recipient key; prefer-encrypt is not sent in gossip
+func (c *Message) AddAutocryptGossip(a *Autocrypt) {
+	gossip := *a
+	gossip.PreferEncrypt = false
+	c.AddHeaderField("Autocrypt-Gossip", gossip.Format())
+}
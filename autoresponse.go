@@ -0,0 +1,74 @@
+package mailbuilder
+
+import (
+	"regexp"
+	"strings"
+)
+
+// the subjects of the automatic answers
+var autoReplySubjectRegexp = regexp.MustCompile(`(?i)^\s*(auto(matic)?[- ]?(reply|response|antwort)|out of (the )?office|vacation|abwesenheit|absence|r[ée]ponse automatique|away from)`)
+
+// the header fields set by the vacation responders of the common servers and clients
+var autoReplyFields = []string{"X-Autoreply", "X-Autorespond", "X-Autoresponse", "X-Mail-Autoreply", "X-Vacation"}
+
+/**
+ * check if the message is an automatic response or must not get one:
+ * Auto-Submitted other than "no" (RFC 3834), X-Auto-Response-Suppress
+ * asking to suppress the automatic replies (Exchange), Precedence bulk,
+ * junk, list or auto_reply, the vacation responder fields and subjects
+ * and the null reverse path; the automatic responders check it to avoid
+ * mail loops
+ */
+func IsAutoResponse(m *Message) bool {
+	if isAutoReply(m) {
+		return true
+	}
+
+	// the keyword without its parameters and comment
+	autoSubmitted := m.GetHeader("Auto-Submitted")
+	if i := strings.IndexAny(autoSubmitted, ";("); i != -1 {
+		autoSubmitted = autoSubmitted[:i]
+	}
+	autoSubmitted = strings.ToLower(strings.TrimSpace(autoSubmitted))
+	if autoSubmitted != "" && autoSubmitted != "no" {
+		return true
+	}
+
+	for _, value := range strings.Split(m.GetHeader("X-Auto-Response-Suppress"), ",") {
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "all", "oof", "autoreply":
+			return true
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(m.GetHeader("Precedence"))) {
+	case "bulk", "junk", "list":
+		return true
+	}
+
+	if strings.TrimSpace(m.GetHeader("Return-Path")) == "<>" {
+		return true
+	}
+	return m.SMTPEnvelope != nil && m.SMTPEnvelope.MailFrom == ""
+}
+
+// check the header fields and the subject of the automatic answers (vacation, out of office)
+func isAutoReply(m *Message) bool {
+	autoSubmitted := strings.ToLower(strings.TrimSpace(m.GetHeader("Auto-Submitted")))
+	if strings.HasPrefix(autoSubmitted, "auto-replied") {
+		return true
+	}
+	for _, field := range autoReplyFields {
+		if strings.TrimSpace(m.GetHeader(field)) != "" {
+			return true
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(m.GetHeader("Precedence")), "auto_reply") {
+		return true
+	}
+	if strings.EqualFold(strings.TrimSpace(m.GetHeader("X-Autogenerated")), "reply") {
+		return true
+	}
+	subject := decodeHeaderWords(m.GetHeader("Subject"))
+	return autoReplySubjectRegexp.MatchString(subject)
+}
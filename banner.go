@@ -0,0 +1,140 @@
+package mailbuilder
+
+import (
+	"regexp"
+	"strings"
+)
+
+// where a banner is inserted in the text
+type Position int
+
+const (
+	PositionBottom Position = iota
+	PositionTop
+)
+
+var (
+	htmlBodyOpenRegexp  = regexp.MustCompile(`(?i)<body[^>]*>`)
+	htmlBodyCloseRegexp = regexp.MustCompile(`(?i)</body\s*>`)
+	htmlCloseRegexp     = regexp.MustCompile(`(?i)</html\s*>`)
+)
+
+/**
+ * insert a disclaimer/banner (UTF-8) in every text/plain (textBanner) and
+ * text/html (htmlBanner) part of the message; a nil banner leaves the parts
+ * of its type unchanged; the attachments, the forwarded messages and the
+ * signed or encrypted subtrees are not modified; the charset and the
+ * transfer encoding of the parts are upgraded when needed; the parts which
+ * can't be decoded or are protected (see ProtectSignatures) are skipped and
+ * the first error is returned
+ */
+func InsertBanner(m *Message, textBanner, htmlBanner []byte, position Position) error {
+	var firstErr error
+	m.Walk(func(p *Message) bool {
+		if p != m && p.IsAttachment() {
+			return false
+		}
+		if isSignedOrEncrypted(p) || (p.IsRfc822() && p != m) {
+			return false
+		}
+		if !p.isTextLeaf() {
+			return true
+		}
+		if (p.MediaType() == "text/plain" && textBanner != nil) || (p.MediaType() == "text/html" && htmlBanner != nil) {
+			if err := checkSignatureProtection(p); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return true
+			}
+		}
+
+		var err error
+		switch p.MediaType() {
+		case "text/plain":
+			if textBanner != nil {
+				err = p.insertTextBanner(string(textBanner), position)
+			}
+		case "text/html":
+			if htmlBanner != nil {
+				err = p.insertHTMLBanner(string(htmlBanner), position)
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return true
+	})
+	return firstErr
+}
+
+// check if the part content is protected by a signature or encrypted
+func isSignedOrEncrypted(p *Message) bool {
+	switch p.MediaType() {
+	case "multipart/signed", "multipart/encrypted", "application/pkcs7-mime", "application/x-pkcs7-mime":
+		return true
+	}
+	return false
+}
+
+// add the banner to a text/plain part, on its own lines
+func (c *Message) insertTextBanner(banner string, position Position) error {
+	text, err := c.DecodedText()
+	if err != nil {
+		return err
+	}
+
+	nl := textNewline(text, c)
+	banner = string(ConvertNewlines([]byte(banner), nl))
+	if !strings.HasSuffix(banner, nl) {
+		banner += nl
+	}
+
+	if position == PositionTop {
+		c.SetText(banner + text)
+		return nil
+	}
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += nl
+	}
+	c.SetText(text + banner)
+	return nil
+}
+
+// add the banner to a text/html part, inside the body element when there is one
+func (c *Message) insertHTMLBanner(banner string, position Position) error {
+	document, err := c.DecodedText()
+	if err != nil {
+		return err
+	}
+
+	var offset int
+	if position == PositionTop {
+		offset = 0
+		if loc := htmlBodyOpenRegexp.FindStringIndex(document); loc != nil {
+			offset = loc[1]
+		}
+	} else {
+		offset = len(document)
+		if locs := htmlBodyCloseRegexp.FindAllStringIndex(document, -1); locs != nil {
+			offset = locs[len(locs)-1][0]
+		} else if locs := htmlCloseRegexp.FindAllStringIndex(document, -1); locs != nil {
+			offset = locs[len(locs)-1][0]
+		}
+	}
+
+	c.SetText(document[:offset] + banner + document[offset:])
+	return nil
+}
+
+// return the line ending used by a text, the one of the part if the text has no line
+func textNewline(text string, p *Message) string {
+	if i := strings.IndexByte(text, '\n'); i != -1 {
+		if i > 0 && text[i-1] == '\r' {
+			return "\r\n"
+		}
+		return "\n"
+	}
+	b := MessageBuilder{}
+	return b.newlineFor(p)
+}
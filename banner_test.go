@@ -0,0 +1,103 @@
+package mailbuilder
+
+import (
+	"testing"
+)
+
+func TestInsertBanner(t *testing.T) {
+	mixed := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nHello\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=data.txt\r\n\r\n1,2,3\r\n--b--\r\n"
+	alternative := "Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nHello\r\n" +
+		"--b\r\nContent-Type: text/html\r\n\r\n<html><body><p>Hello</p></body></html>\r\n--b--\r\n"
+	named := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nHello\r\n" +
+		"--b\r\nContent-Type: text/plain; name=\"data.txt\"\r\n\r\n1,2,3\r\n--b--\r\n"
+	signed := "Content-Type: multipart/signed; boundary=b; protocol=\"application/pgp-signature\"\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nHello\r\n" +
+		"--b\r\nContent-Type: application/pgp-signature\r\n\r\nsig\r\n--b--\r\n"
+
+	tests := []struct {
+		name       string
+		raw        string
+		htmlBanner []byte
+		position   Position
+		want       []string // the decoded text of the leaf parts
+	}{
+		{"plain bottom", "Content-Type: text/plain\r\n\r\nHello\r\n", nil, PositionBottom,
+			[]string{"Hello\r\nDISCLAIMER\r\n"}},
+		{"plain top", "Content-Type: text/plain\r\n\r\nHello\r\n", nil, PositionTop,
+			[]string{"DISCLAIMER\r\nHello\r\n"}},
+		{"attachment untouched", mixed, nil, PositionBottom,
+			[]string{"Hello\r\nDISCLAIMER\r\n", "1,2,3"}},
+		{"named attachment untouched", named, nil, PositionBottom,
+			[]string{"Hello\r\nDISCLAIMER\r\n", "1,2,3"}},
+		{"html bottom", alternative, []byte("<p>DISCLAIMER</p>"), PositionBottom,
+			[]string{"Hello\r\nDISCLAIMER\r\n", "<html><body><p>Hello</p><p>DISCLAIMER</p></body></html>"}},
+		{"html top", alternative, []byte("<p>DISCLAIMER</p>"), PositionTop,
+			[]string{"DISCLAIMER\r\nHello", "<html><body><p>DISCLAIMER</p><p>Hello</p></body></html>"}},
+		{"nil html banner", alternative, nil, PositionBottom,
+			[]string{"Hello\r\nDISCLAIMER\r\n", "<html><body><p>Hello</p></body></html>"}},
+		{"signed untouched", signed, nil, PositionBottom,
+			[]string{"Hello", "sig"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewMessageDecomposer()
+			m, err := d.Decompose([]byte(tt.raw), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := InsertBanner(m, []byte("DISCLAIMER"), tt.htmlBanner, tt.position); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			m.Walk(func(p *Message) bool {
+				if !p.IsMultipart() {
+					text, err := p.DecodedText()
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, text)
+				}
+				return true
+			})
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d leaf parts, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("part %d: got %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInsertBannerUpgradesCharset(t *testing.T) {
+	d := NewMessageDecomposer()
+	m, err := d.Decompose([]byte("Content-Type: text/plain; charset=us-ascii\r\nContent-Transfer-Encoding: 7bit\r\n\r\nHello\r\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InsertBanner(m, []byte("© ACME"), nil, PositionBottom); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := m.Charset(); got != "utf-8" {
+		t.Errorf("got charset %q, want utf-8", got)
+	}
+	if has8Bit(m.Body) && m.ContentTransferEncoding() == "7bit" {
+		t.Errorf("got 8bit body labeled 7bit: %q", m.Body)
+	}
+	text, err := m.DecodedText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello\r\n© ACME\r\n"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
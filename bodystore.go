@@ -0,0 +1,330 @@
+package mailbuilder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"os"
+	"sync/atomic"
+)
+
+/**
+ * where the decomposer keeps the leaf bodies larger than its spill threshold
+ * (see MessageDecomposer.SetBodyStore) instead of Message.Body; the body is
+ * kept as read from the message, still transfer encoded, so the builder
+ * writes it back unchanged straight from the store; it is read with
+ * BodyReader, decoded while read with DecodedBodyReader and brought in
+ * memory by LoadBody
+ */
+type BodyStore interface {
+	// keep the body read from r until its end
+	Store(r io.Reader) (StoredBody, error)
+}
+
+// a body kept by a BodyStore
+type StoredBody interface {
+	io.ReaderAt
+
+	// the length of the body
+	Size() int64
+
+	// free the storage; the body can't be read anymore
+	Release() error
+}
+
+// a BodyStore writing the bodies to temporary files of Dir (the default temporary directory when "")
+type TempFileStore struct {
+	Dir string
+}
+
+func (s TempFileStore) Store(r io.Reader) (StoredBody, error) {
+	f, err := ioutil.TempFile(s.Dir, "mailbuilder-body-")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &tempFileBody{file: f, size: size}, nil
+}
+
+type tempFileBody struct {
+	file *os.File
+	size int64
+}
+
+func (b *tempFileBody) ReadAt(p []byte, off int64) (int, error) {
+	return b.file.ReadAt(p, off)
+}
+
+func (b *tempFileBody) Size() int64 {
+	return b.size
+}
+
+func (b *tempFileBody) Release() error {
+	err := b.file.Close()
+	if rmErr := os.Remove(b.file.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// read the body of a leaf part keeping it in the store when larger than the spill threshold
+func (d *MessageDecomposer) readLeafBody(s *decomposition, result *Message, r io.Reader) ([]byte, error) {
+	s.scratch.Reset()
+	if _, err := s.scratch.ReadFrom(io.LimitReader(r, d.spillThreshold+1)); err != nil {
+		return nil, err
+	}
+	if int64(s.scratch.Len()) <= d.spillThreshold {
+		return append([]byte(nil), s.scratch.Bytes()...), nil
+	}
+
+	stored, err := d.bodyStore.Store(io.MultiReader(bytes.NewReader(s.scratch.Bytes()), r))
+	if err != nil {
+		return nil, err
+	}
+	result.storedBody = stored
+	return nil, nil
+}
+
+// the file of DecomposeFile, closed when its last body is released
+type fileBodies struct {
+	file *os.File
+	refs int32
+}
+
+func (f *fileBodies) release() error {
+	if atomic.AddInt32(&f.refs, -1) == 0 {
+		return f.file.Close()
+	}
+	return nil
+}
+
+// a body kept as a section of the file of DecomposeFile
+type fileSectionBody struct {
+	*io.SectionReader
+	file     *fileBodies
+	released int32
+}
+
+func (b *fileSectionBody) Release() error {
+	if !atomic.CompareAndSwapInt32(&b.released, 0, 1) {
+		return nil
+	}
+	return b.file.release()
+}
+
+/**
+ * read the body of a leaf part starting at offset in the file, keeping it
+ * as a section of the file when larger than the spill threshold
+ */
+func (d *MessageDecomposer) readFileBody(file *fileBodies, result *Message, r io.Reader, offset int64) ([]byte, error) {
+	buff := getBuffer()
+	defer putBuffer(buff)
+	if _, err := buff.ReadFrom(io.LimitReader(r, d.spillThreshold+1)); err != nil {
+		return nil, err
+	}
+	if int64(buff.Len()) <= d.spillThreshold {
+		return append([]byte(nil), buff.Bytes()...), nil
+	}
+
+	// only the size of the rest is needed
+	rest, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&file.refs, 1)
+	result.storedBody = &fileSectionBody{
+		SectionReader: io.NewSectionReader(file.file, offset, int64(buff.Len())+rest),
+		file:          file,
+	}
+	return nil, nil
+}
+
+// return a reader of the body, kept in Body or by a BodyStore
+func (c *Message) BodyReader() io.Reader {
+	if len(c.Body) == 0 && c.storedBody != nil {
+		return io.NewSectionReader(c.storedBody, 0, c.storedBody.Size())
+	}
+	return bytes.NewReader(c.Body)
+}
+
+/**
+ * return a reader of the body decoded with the Content-Transfer-Encoding; a
+ * base64 or quoted-printable body kept by a BodyStore is decoded while read
+ * without bringing it in memory
+ */
+func (c *Message) DecodedBodyReader() (io.Reader, error) {
+	if c.IsBodyStored() {
+		if r := decodingReader(c.BodyReader(), c.ContentTransferEncoding()); r != nil {
+			return r, nil
+		}
+	}
+	data, err := c.DecodedBody()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// a reader decoding r with a streamable transfer encoding, nil for the other encodings
+func decodingReader(r io.Reader, encoding string) io.Reader {
+	switch normalizeEncoding(encoding) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "", "7bit", "8bit", "binary":
+		return r
+	}
+	return nil
+}
+
+// decode a body kept by a BodyStore, falling back to the tolerant decoding of the whole body
+func (c *Message) decodeStoredBody() ([]byte, error) {
+	if r := decodingReader(c.BodyReader(), c.ContentTransferEncoding()); r != nil {
+		if data, err := ioutil.ReadAll(r); err == nil {
+			return data, nil
+		}
+	}
+	body, err := c.rawBody()
+	if err != nil {
+		return nil, err
+	}
+	data, _, warnings, err := DecodeByContentEncodingWithWarnings(body, c.ContentTransferEncoding())
+	c.AddWarnings(warnings...)
+	return data, err
+}
+
+// size of the decoded body; a body kept by a BodyStore is decoded while counted
+func (c *Message) decodedBodySize() (int, error) {
+	if c.IsBodyStored() {
+		if r := decodingReader(c.BodyReader(), c.ContentTransferEncoding()); r != nil {
+			if n, err := io.Copy(ioutil.Discard, r); err == nil {
+				return int(n), nil
+			}
+		}
+	}
+	data, err := c.DecodedBody()
+	return len(data), err
+}
+
+// the body as read from the message; a body kept by a BodyStore is read without releasing it
+func (c *Message) rawBody() ([]byte, error) {
+	if !c.IsBodyStored() {
+		return c.Body, nil
+	}
+	return ioutil.ReadAll(c.BodyReader())
+}
+
+// size of the body as read from the message, kept in Body or by a BodyStore
+func (c *Message) BodySize() int64 {
+	if c.IsBodyStored() {
+		return c.storedBody.Size()
+	}
+	return int64(len(c.Body))
+}
+
+// check if the body has 8-bit bytes; a body kept by a BodyStore is scanned (true if it can't be read)
+func (c *Message) bodyHas8Bit() bool {
+	if !c.IsBodyStored() {
+		return has8Bit(c.Body)
+	}
+	r := c.BodyReader()
+	buff := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buff)
+		if has8Bit(buff[:n]) {
+			return true
+		}
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			return true
+		}
+	}
+}
+
+// release a body kept by a BodyStore, replaced by a new one
+func (c *Message) dropStoredBody() {
+	if c.storedBody != nil {
+		c.storedBody.Release()
+		c.storedBody = nil
+	}
+}
+
+/**
+ * call fn with each line of the body starting with "--", without its line
+ * break; a body kept by a BodyStore is scanned line by line
+ */
+func (c *Message) rangeBodyDashLines(fn func(line []byte)) {
+	if !c.IsBodyStored() {
+		rangeDashLines(c.Body, fn)
+		return
+	}
+	br := bufio.NewReader(c.BodyReader())
+	lineStart := true
+	for {
+		line, err := br.ReadSlice('\n')
+		// the rest of a line longer than the buffer can't start a delimiter
+		if lineStart {
+			rangeDashLines(line, fn)
+		}
+		lineStart = err != bufio.ErrBufferFull
+		if err != nil && err != bufio.ErrBufferFull {
+			// a body which can't be read fails the build anyway
+			return
+		}
+	}
+}
+
+// check if the body is kept by a BodyStore (Body is empty until LoadBody)
+func (c *Message) IsBodyStored() bool {
+	return len(c.Body) == 0 && c.storedBody != nil
+}
+
+/**
+ * bring a body kept by a BodyStore in Body and release its storage; return
+ * Body
+ */
+func (c *Message) LoadBody() ([]byte, error) {
+	if c.storedBody == nil {
+		return c.Body, nil
+	}
+	if len(c.Body) == 0 {
+		body, err := ioutil.ReadAll(c.BodyReader())
+		if err != nil {
+			return nil, err
+		}
+		c.Body = body
+	}
+	err := c.storedBody.Release()
+	c.storedBody = nil
+	return c.Body, err
+}
+
+/**
+ * release the storage of the bodies kept by a BodyStore in the message and
+ * its descendants; those bodies are empty afterwards (see LoadBody to keep
+ * one); return the first error
+ */
+func (c *Message) ReleaseBodies() error {
+	var err error
+	c.Walk(func(p *Message) bool {
+		if p.storedBody != nil {
+			if releaseErr := p.storedBody.Release(); err == nil {
+				err = releaseErr
+			}
+			p.storedBody = nil
+		}
+		return true
+	})
+	return err
+}
@@ -0,0 +1,118 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// decompose a message with a single attachment kept by a TempFileStore
+func decomposeStored(t *testing.T, body, encoding string) *Message {
+	raw := "From: a@example.com\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: " + encoding + "\r\n\r\n" +
+		body + "\r\n--b--\r\n"
+	d := NewMessageDecomposer()
+	d.SetBodyStore(TempFileStore{Dir: t.TempDir()})
+	d.SetSpillThreshold(16)
+	m, err := d.Decompose([]byte(raw), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Parts[0].IsBodyStored() {
+		t.Fatal("the body is not stored")
+	}
+	t.Cleanup(func() { m.ReleaseBodies() })
+	return m
+}
+
+func TestStoredBodyDecoding(t *testing.T) {
+	data := bytes.Repeat([]byte("hello world "), 20)
+	encoded := base64.StdEncoding.EncodeToString(data)
+	m := decomposeStored(t, encoded, "base64")
+	p := m.Parts[0]
+
+	decoded, err := p.DecodedBody()
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Fatalf("DecodedBody = %q, %v", decoded, err)
+	}
+	if !p.IsBodyStored() {
+		t.Error("DecodedBody released the stored body")
+	}
+
+	r, err := p.DecodedBodyReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ := ioutil.ReadAll(r); !bytes.Equal(decoded, data) {
+		t.Errorf("DecodedBodyReader read %q", decoded)
+	}
+
+	if info := NewAttachmentInfo(p); info.Size != len(data) || info.EncodedSize != len(encoded) {
+		t.Errorf("got sizes %d/%d, want %d/%d", info.Size, info.EncodedSize, len(data), len(encoded))
+	}
+
+	j, err := json.Marshal(m)
+	if err != nil || !strings.Contains(string(j), encoded) {
+		t.Errorf("the JSON misses the stored body: %v", err)
+	}
+
+	p.SetDecodedBody([]byte("replaced"))
+	if p.IsBodyStored() || p.storedBody != nil {
+		t.Error("SetDecodedBody kept the stored body")
+	}
+}
+
+func TestStoredBodyBoundaryAndDowngrade(t *testing.T) {
+	m := decomposeStored(t, "--inner\r\nnon-ascii é "+strings.Repeat("x", 40), "8bit")
+	if !m.boundaryCollides("inner") {
+		t.Error("the delimiter line of the stored body is not detected")
+	}
+
+	Downgrade8Bit(m)
+	p := m.Parts[0]
+	decoded, err := p.DecodedBody()
+	if err != nil || !strings.Contains(string(decoded), "non-ascii é") || p.ContentTransferEncoding() != "base64" {
+		t.Errorf("downgraded to %s: %q, %v", p.ContentTransferEncoding(), decoded, err)
+	}
+}
+
+func TestDecomposeFileBodies(t *testing.T) {
+	big := strings.Repeat("QUJD\r\n", 100)
+	raw := "From: a@example.com\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\npreamble\r\n" +
+		"--b\r\n\r\nsmall\r\n" +
+		"--b\r\nContent-Type: multipart/alternative; boundary=c\r\n\r\n" +
+		"--c\r\nContent-Type: text/plain\r\n\r\n" + big + "\r\n--c--\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\n\r\n" + big + "\r\n" +
+		"--b--\r\nepilogue\r\n"
+	file := t.TempDir() + "/message.eml"
+	if err := ioutil.WriteFile(file, []byte(raw), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewMessageDecomposer()
+	d.SetFileBodies(true)
+	d.SetSpillThreshold(100)
+	m, err := d.DecomposeFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.ReleaseBodies()
+
+	stored := []*Message{m.Parts[1].Parts[0], m.Parts[2]}
+	for _, p := range stored {
+		body, err := ioutil.ReadAll(p.BodyReader())
+		if !p.IsBodyStored() || err != nil || string(body) != big {
+			t.Errorf("part %s: got %q, %v", p.Idx, body, err)
+		}
+	}
+	if m.Parts[0].IsBodyStored() || string(m.Parts[0].Body) != "small" {
+		t.Errorf("got small body %q", m.Parts[0].Body)
+	}
+	b := NewMessageBuilder()
+	if got := string(b.Build(m)); got != raw {
+		t.Errorf("rebuilt as %q", got)
+	}
+}
@@ -0,0 +1,131 @@
+package mailbuilder
+
+import (
+	"regexp"
+	"strings"
+)
+
+// the kind of a received message for the bounce processing
+type BounceClass int
+
+const (
+	NotABounce BounceClass = iota
+
+	// permanent failure: the address should not be used again
+	HardBounce
+
+	// temporary failure (mailbox full, delay, ...): the delivery can be retried
+	SoftBounce
+
+	// an automatic answer (vacation, out of office) which is not a delivery failure
+	AutoReply
+)
+
+func (b BounceClass) String() string {
+	switch b {
+	case HardBounce:
+		return "hard bounce"
+	case SoftBounce:
+		return "soft bounce"
+	case AutoReply:
+		return "auto-reply"
+	}
+	return "not a bounce"
+}
+
+var (
+	// the subjects of the bounces of the common MTAs (Postfix, Exim, qmail, Exchange, Sendmail, Gmail)
+	bounceSubjectRegexp = regexp.MustCompile(`(?i)(undeliver|undelivered mail|returned mail|mail delivery (failed|failure|subsystem)|delivery (status notification|failure|has failed)|failure notice|non[- ]?delivery|could not be delivered|delivery problem)`)
+
+	// the enhanced status codes (RFC 3463) and the SMTP replies of a bounce text
+	bounceStatusRegexp = regexp.MustCompile(`\b([245])\.\d{1,3}\.\d{1,3}\b`)
+	bounceReplyRegexp  = regexp.MustCompile(`(?m)(^|[\s:(])([45])[05]\d[\s-]`)
+
+	// the texts of the temporary failures and of the permanent ones
+	softBounceRegexp = regexp.MustCompile(`(?i)(mailbox (is )?full|over ?quota|quota exceeded|insufficient (system )?storage|temporar(il)?y|try again|deferred|delayed|greylist)`)
+	hardBounceRegexp = regexp.MustCompile(`(?i)(user unknown|unknown user|no such (user|recipient|mailbox)|does not exist|doesn't exist|mailbox (unavailable|not found)|recipient (address )?rejected|address rejected|invalid (recipient|address|mailbox)|account (has been )?disabled|not our customer)`)
+)
+
+/**
+ * classify a received message: a delivery status notification by the
+ * actions and status codes of its recipients, the bounces without DSN
+ * (from MAILER-DAEMON or postmaster, null reverse path, common MTA
+ * subjects) by the status codes and the wording of their text (a bounce
+ * without any hint is soft) and an automatic answer by its header
+ * (Auto-Submitted, X-Autoreply, Precedence) or subject
+ */
+func ClassifyBounce(m *Message) BounceClass {
+	if ds, err := ParseDSN(m); err == nil {
+		return classifyDSN(ds)
+	}
+	if looksLikeBounce(m) {
+		// checked first: some MTAs mark their bounces auto-replied
+		text, _ := ExtractText(m)
+		return classifyBounceText(text)
+	}
+	if isAutoReply(m) {
+		return AutoReply
+	}
+	return NotABounce
+}
+
+// the worst status of the recipients of a DSN
+func classifyDSN(ds *DeliveryStatus) BounceClass {
+	class := NotABounce
+	for _, r := range ds.Recipients {
+		switch {
+		case r.Failed() && strings.HasPrefix(r.Status, "5") && r.Status != "5.2.2":
+			// 5.2.2 is a full mailbox
+			return HardBounce
+		case r.Failed() || strings.EqualFold(r.Action, "delayed"):
+			class = SoftBounce
+		}
+	}
+	if class == NotABounce && len(ds.Recipients) == 0 {
+		// a DSN without recipient groups
+		return classifyBounceText(ds.Text)
+	}
+	return class
+}
+
+// check the sender, the reverse path and the subject of the bounces
+func looksLikeBounce(m *Message) bool {
+	if strings.TrimSpace(m.GetHeader("Return-Path")) == "<>" {
+		return true
+	}
+	if m.SMTPEnvelope != nil && m.SMTPEnvelope.MailFrom == "" {
+		return true
+	}
+	for _, address := range envelopeAddresses(m.GetHeader("From")) {
+		local := strings.ToLower(address.Address)
+		if i := strings.IndexByte(local, '@'); i != -1 {
+			local = local[:i]
+		}
+		if local == "mailer-daemon" || local == "postmaster" {
+			return true
+		}
+	}
+	return bounceSubjectRegexp.MatchString(decodeHeaderWords(m.GetHeader("Subject")))
+}
+
+// classify a bounce by the first status code of its text, by its wording otherwise
+func classifyBounceText(text string) BounceClass {
+	if match := bounceStatusRegexp.FindStringSubmatch(text); match != nil {
+		switch {
+		case match[0] == "5.2.2" || match[1] == "4":
+			return SoftBounce
+		case match[1] == "5":
+			return HardBounce
+		}
+	}
+	if hardBounceRegexp.MatchString(text) {
+		return HardBounce
+	}
+	if softBounceRegexp.MatchString(text) {
+		return SoftBounce
+	}
+	if match := bounceReplyRegexp.FindStringSubmatch(text); match != nil && match[2] == "5" {
+		return HardBounce
+	}
+	return SoftBounce
+}
@@ -0,0 +1,219 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidBoundary = errors.New("mailbuilder: invalid boundary (1 to 70 bchars, not ending with a space)")
+
+// the longest boundary (RFC 2046 section 5.1.1)
+const maxBoundaryLength = 70
+
+// the characters of a boundary besides the letters and digits (bchars); the space can't end it
+const boundarySpecials = "'()+_,-./:=? "
+
+/**
+ * check the boundary follows RFC 2046: 1 to 70 characters among the
+ * letters, digits and '()+_,-./:=? and the space, not ending with a space;
+ * the boundaries with specials are quoted when the Content-Type is written
+ */
+func ValidateBoundary(boundary string) error {
+	if len(boundary) == 0 || len(boundary) > maxBoundaryLength || strings.HasSuffix(boundary, " ") {
+		return ErrInvalidBoundary
+	}
+	for i := 0; i < len(boundary); i++ {
+		b := boundary[i]
+		if !('a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte(boundarySpecials, b) != -1) {
+			return ErrInvalidBoundary
+		}
+	}
+	return nil
+}
+
+/**
+ * return m with boundaries which can be written: a multipart with a line of
+ * its content (parts, nested multiparts, attached messages or preamble)
+ * read as one of its delimiter lines, which would cut the message when
+ * parsed, gets a new boundary unless the content is the decomposed one
+ * (the parser found the same parts in it); a multipart without a boundary
+ * or with a Content-Type not declaring it gets one too; the tree is
+ * scanned once and m is not modified: the changed multiparts and their
+ * ancestors are copies
+ */
+func (c *MessageBuilder) withSafeBoundaries(m *Message) *Message {
+	colliding := make(map[*Message]bool)
+	m.scanDelimiterLines(m.Boundary, nil, colliding)
+	return c.safeBoundaries(m, colliding)
+}
+
+// see withSafeBoundaries; the children are checked first
+func (c *MessageBuilder) safeBoundaries(m *Message, colliding map[*Message]bool) *Message {
+	bodyMessage := m.BodyMessage
+	if bodyMessage != nil {
+		bodyMessage = c.safeBoundaries(bodyMessage, colliding)
+	}
+	var parts []*Message
+	for idx, p := range m.Parts {
+		if safe := c.safeBoundaries(p, colliding); safe != p {
+			if parts == nil {
+				parts = append([]*Message(nil), m.Parts...)
+			}
+			parts[idx] = safe
+		}
+	}
+	declared := !m.IsMultipart() || m.declaresBoundary()
+	if bodyMessage == m.BodyMessage && parts == nil && declared && !colliding[m] {
+		return m
+	}
+
+	safe := *m
+	safe.BodyMessage = bodyMessage
+	if parts != nil {
+		safe.Parts = parts
+	}
+	if !safe.IsMultipart() {
+		return &safe
+	}
+	if safe.Boundary == "" || (!declared && ValidateBoundary(safe.Boundary) != nil) ||
+		(colliding[m] && !c.contentUnchanged(&safe)) {
+		safe.Boundary = c.derivedBoundary(&safe)
+	}
+	if declared && safe.Boundary == m.Boundary {
+		return &safe
+	}
+	// the Content-Type is written again on a copy of the header
+	p := copyRootHeader(&safe)
+	p.ensureMultipartContentType()
+	return p
+}
+
+// check if the content of a decomposed multipart is built as it was read
+func (c *MessageBuilder) contentUnchanged(m *Message) bool {
+	if m.contentSum == nil {
+		return false
+	}
+	sum := sha256.New()
+	if err := c.writeContent(context.Background(), sum, m); err != nil {
+		return false
+	}
+	return bytes.Equal(sum.Sum(nil), m.contentSum)
+}
+
+/**
+ * a boundary derived from the parts of the multipart, not found in its
+ * content; the header and the body blocks built apart get the same one
+ */
+func (c *MessageBuilder) derivedBoundary(m *Message) string {
+	sum := sha256.New()
+	sum.Write(m.Preamble)
+	for _, p := range m.Parts {
+		c.writePart(context.Background(), sum, p)
+	}
+	sum.Write(m.Epilogue)
+	seed := sum.Sum(nil)
+	for {
+		next := sha256.Sum256(seed)
+		boundary := hex.EncodeToString(next[:])[:60]
+		if !m.boundaryCollides(boundary) {
+			return boundary
+		}
+		seed = next[:]
+	}
+}
+
+// check if the content of the multipart has a line matching a delimiter of boundary
+func (c *Message) boundaryCollides(boundary string) bool {
+	colliding := make(map[*Message]bool)
+	c.scanDelimiterLines(boundary, nil, colliding)
+	return colliding[c]
+}
+
+// a multipart holding the scanned content
+type openBoundary struct {
+	part     *Message
+	boundary string
+}
+
+/**
+ * add to colliding the multiparts among open (holding c) and c itself,
+ * delimited by boundary, with a delimiter line in their content; the
+ * preamble is read line by line (see isRawDelimiter) while the parts are
+ * cut by the parser at any line starting like a delimiter (see
+ * isDelimiterStart)
+ */
+func (c *Message) scanDelimiterLines(boundary string, open []openBoundary, colliding map[*Message]bool) {
+	check := func(line []byte) {
+		for _, o := range open {
+			if isDelimiterStart(line, o.boundary) {
+				colliding[o.part] = true
+			}
+		}
+	}
+
+	multipart := c.IsMultipart() && boundary != ""
+	if len(open) > 0 {
+		rangeDashLines(c.RawOriginalHeader, check)
+		c.rangeBodyDashLines(check)
+		rangeDashLines(c.Epilogue, check)
+		if multipart {
+			check([]byte("--" + boundary))
+			check([]byte("--" + boundary + "--"))
+		}
+	}
+
+	rangeDashLines(c.Preamble, func(line []byte) {
+		check(line)
+		if multipart && (isRawDelimiter(line, boundary, false) || isRawDelimiter(line, boundary, true)) {
+			colliding[c] = true
+		}
+	})
+	if multipart {
+		open = append(open[:len(open):len(open)], openBoundary{part: c, boundary: boundary})
+	}
+	if c.BodyMessage != nil {
+		c.BodyMessage.scanDelimiterLines(c.BodyMessage.Boundary, open, colliding)
+	}
+	for _, p := range c.Parts {
+		p.scanDelimiterLines(p.Boundary, open, colliding)
+	}
+}
+
+/**
+ * check if the parser would end a part at a line of its content: "--boundary"
+ * followed by a space, a tab, a line break, a dash or the end of the content
+ */
+func isDelimiterStart(line []byte, boundary string) bool {
+	if len(line) < len(boundary)+2 || string(line[:2]) != "--" || string(line[2:len(boundary)+2]) != boundary {
+		return false
+	}
+	if len(line) == len(boundary)+2 {
+		return true
+	}
+	return strings.IndexByte(" \t\r\n-", line[len(boundary)+2]) != -1
+}
+
+// call fn with each line of data starting with "--", with its line break
+func rangeDashLines(data []byte, fn func(line []byte)) {
+	for start := 0; start < len(data); {
+		i := bytes.Index(data[start:], []byte("--"))
+		if i == -1 {
+			return
+		}
+		i += start
+		end := bytes.IndexByte(data[i:], '\n')
+		if end == -1 {
+			end = len(data)
+		} else {
+			end += i + 1
+		}
+		if i == 0 || data[i-1] == '\n' {
+			fn(data[i:end])
+		}
+		start = end
+	}
+}
@@ -0,0 +1,125 @@
+package mailbuilder
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// a multipart nested depth times, the innermost one holding body
+func nestedMultipart(depth int, body string) *Message {
+	m := NewMultipart("mixed", nil)
+	m.Boundary = "level0"
+	inner := m
+	for i := 1; i < depth; i++ {
+		p := NewMultipart("mixed", nil)
+		p.Boundary = fmt.Sprintf("level%d", i)
+		inner.AddPart(p)
+		inner = p
+	}
+	inner.AddPart(NewTextPart(body))
+	return m
+}
+
+func TestEnsureSafeBoundaries(t *testing.T) {
+	// the innermost text has delimiter lines of the root and of its parent
+	m := nestedMultipart(4, "--level0\r\n--level2--\r\n")
+	b := NewMessageBuilder()
+	d := NewMessageDecomposer()
+	rebuilt, err := d.Decompose(b.Build(m), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var boundaries []string
+	rebuilt.Walk(func(p *Message) bool {
+		if p.IsMultipart() {
+			boundaries = append(boundaries, p.Boundary)
+		}
+		return true
+	})
+	if len(boundaries) != 4 || boundaries[0] == "level0" || boundaries[1] != "level1" || boundaries[2] == "level2" || boundaries[3] != "level3" {
+		t.Errorf("got boundaries %q, want level0 and level2 only replaced", boundaries)
+	}
+	inner := rebuilt.Parts[0].Parts[0].Parts[0].Parts[0]
+	if body, _ := inner.DecodedBody(); string(body) != "--level0\r\n--level2--\r\n" {
+		t.Errorf("the innermost body was cut: %q", body)
+	}
+}
+
+func TestDelimiterPadding(t *testing.T) {
+	tests := []struct {
+		raw   string
+		final bool
+		want  bool
+	}{
+		{"--b\r\n", false, true},
+		{"\r\n--b \t\r\n", false, true},
+		{"--b\n", false, true},
+		{"--b--", true, true},
+		{"--b-- \n", true, true},
+		{"--b\r \n", false, false},
+		{"--b \r\r\n", false, false},
+		{"--bc\n", false, false},
+		{"--b--\r \n", true, false},
+	}
+	for _, test := range tests {
+		if got := isRawDelimiter([]byte(test.raw), "b", test.final); got != test.want {
+			t.Errorf("isRawDelimiter(%q, final %v) = %v, want %v", test.raw, test.final, got, test.want)
+		}
+	}
+}
+
+func TestUnchangedBoundariesRoundTrip(t *testing.T) {
+	tests := []string{
+		// the preamble line isn't a delimiter for the parser
+		"Content-Type: multipart/mixed; boundary=b\n\n--b\r \n--b\n\n--b--",
+		// the part header isn't read as a delimiter either
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n--b-x: 1\r\n\r\nbody\r\n--b--\r\n",
+	}
+	for _, raw := range tests {
+		if err := VerifyRoundTrip([]byte(raw)); err != nil {
+			t.Errorf("%v for %q", err, raw)
+		}
+	}
+}
+
+func TestBuildKeepsBoundaries(t *testing.T) {
+	m := nestedMultipart(3, "--level0\r\n")
+	composed := NewMultipart("mixed", nil)
+	composed.Boundary = ""
+	composed.AddPart(NewTextPart("text"))
+	m.AddPart(composed)
+	header := m.Header.Get("Content-Type")
+
+	b := NewMessageBuilder()
+	out := b.Build(m)
+	if m.Boundary != "level0" || composed.Boundary != "" || m.Header.Get("Content-Type") != header {
+		t.Errorf("the build changed the boundaries to %q and %q", m.Boundary, composed.Boundary)
+	}
+	if again := b.Build(m); string(again) != string(out) {
+		t.Error("two builds of the same message differ")
+	}
+
+	// the blocks built apart agree on the new boundaries
+	d := NewMessageDecomposer()
+	rebuilt, err := d.Decompose(append(b.headerBlock(m), b.bodyBlock(m)...), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rebuilt.Parts) != 2 || rebuilt.Boundary == "level0" || rebuilt.Parts[1].Boundary == "" {
+		t.Fatalf("got %d parts with boundaries %q", len(rebuilt.Parts), rebuilt.Boundary)
+	}
+	if body, _ := rebuilt.Parts[0].Parts[0].Parts[0].DecodedBody(); string(body) != "--level0\r\n" {
+		t.Errorf("the innermost body was cut: %q", body)
+	}
+}
+
+func BenchmarkBuildNested(b *testing.B) {
+	m := nestedMultipart(20, strings.Repeat("a line of text\r\n", 1<<14))
+	builder := NewMessageBuilder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		builder.Build(m)
+	}
+}
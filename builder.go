@@ -6,9 +6,17 @@ package mailbuilder
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 	"net/textproto"
-	//"fmt"
+	"sync"
+	"time"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
 )
 
 func NewMessageBuilder() MessageBuilder {
@@ -18,8 +26,59 @@ func NewMessageBuilder() MessageBuilder {
 
 type MessageBuilder struct {
 	newLine string
+
+	// the output channel can carry binary content (BINARYMIME)
+	binaryMIME bool
+
+	// replace the multipart/appledouble parts with their data fork
+	stripResourceForks bool
+
+	// add a text/plain alternative to the messages having only an HTML body
+	generateTextAlternative bool
+
+	// write all the line endings with newLine instead of keeping the ones of each part
+	normalizeNewlines bool
+
+	// convert the Date header to this location (nil keeps the original zone)
+	dateLocation *time.Location
+
+	// write the Return-Path of the SMTP envelope and remove the Bcc field
+	syncReturnPath bool
+	stripBcc       bool
+
+	// set the Date header when missing
+	ensureDate bool
+
+	// set a generated Message-ID with this domain when missing ("" disabled)
+	messageIDDomain string
+
+	// the VERP reverse path of the single recipient messages ("" local part disabled)
+	verpLocal  string
+	verpDomain string
+
+	// the largest message BuildTo writes (0 unlimited)
+	maxOutputSize int64
+}
+
+// returned when a part has binary content and the output channel can't carry it
+type BinaryContentError struct {
+	Idx string
+}
+
+func (e *BinaryContentError) Error() string {
+	return fmt.Sprintf("mailbuilder: part %q has binary content and the output channel doesn't support BINARYMIME", e.Idx)
+}
+
+// returned by BuildTo when the message is larger than the maximum output size
+type OutputSizeError struct {
+	Limit int64
 }
 
+func (e *OutputSizeError) Error() string {
+	return fmt.Sprintf("mailbuilder: the message exceeds the maximum output size of %d bytes", e.Limit)
+}
+
+// set the newline of the messages built from scratch; the decomposed parts keep their own
 func (c *MessageBuilder) SetNewline(nl string) {
 	c.newLine = nl
 }
@@ -28,81 +87,427 @@ func (c *MessageBuilder) GetNewline() (string) {
 	return c.newLine
 }
 
+/**
+ * specify if all the line endings (headers, boundaries, bodies except the
+ * binary ones) are written with the builder newline (\r\n if not set)
+ * instead of the newline of each part
+ */
+func (c *MessageBuilder) SetNormalizeNewlines(normalize bool) {
+	c.normalizeNewlines = normalize
+}
+
+func (c *MessageBuilder) GetNormalizeNewlines() bool {
+	return c.normalizeNewlines
+}
+
+// specify if the output channel can carry binary content (BINARYMIME)
+func (c *MessageBuilder) SetBinaryMIME(allowed bool) {
+	c.binaryMIME = allowed
+}
+
+func (c *MessageBuilder) GetBinaryMIME() bool {
+	return c.binaryMIME
+}
+
+/**
+ * specify if the multipart/appledouble parts (the message itself included)
+ * are replaced by their data fork, named after the applefile header when
+ * it has no file name
+ */
+func (c *MessageBuilder) SetStripResourceForks(strip bool) {
+	c.stripResourceForks = strip
+}
+
+func (c *MessageBuilder) GetStripResourceForks() bool {
+	return c.stripResourceForks
+}
 
 /**
- * build the message from components
- *
+ * specify if a text/plain alternative rendered from the HTML is added to the
+ * messages having only an HTML body; the message itself is not modified
  */
-func(c *MessageBuilder) Build(m *Message) ([]byte) {
+func (c *MessageBuilder) SetGenerateTextAlternative(generate bool) {
+	c.generateTextAlternative = generate
+}
 
-	buff := bytes.NewBuffer([]byte{})
+func (c *MessageBuilder) GetGenerateTextAlternative() bool {
+	return c.generateTextAlternative
+}
 
-	// write header
-	buff.Write(c.BuildHeader(m))
+/**
+ * convert the Date header of the built messages to loc (with its zone
+ * abbreviation as comment) for display-oriented pipelines; nil keeps the
+ * original zone; the built message itself is not modified
+ */
+func (c *MessageBuilder) SetDateLocation(loc *time.Location) {
+	c.dateLocation = loc
+}
 
-	// write header & body separator
-	buff.WriteString(c.GetNewline() + c.GetNewline())
+func (c *MessageBuilder) GetDateLocation() *time.Location {
+	return c.dateLocation
+}
 
-	// write body
-	body := c.BuildBody(m)
-	if m.IsDecoded {
-		/*
-		 * The original message had the body encoded and the
-		 * decomposer decoded it (only for message/rfc822 content type)
-		 * to try to parse the parts
-		 */
-		body = EncodeByContentEncoding(body, m.Header.Get("Content-Transfer-Encoding"))
+// specify if a Date header (now, see FormatDate) is set on the built messages without one
+func (c *MessageBuilder) SetEnsureDate(ensure bool) {
+	c.ensureDate = ensure
+}
+
+func (c *MessageBuilder) GetEnsureDate() bool {
+	return c.ensureDate
+}
+
+/**
+ * specify if the Return-Path of the built messages is set from the reverse
+ * path of their SMTP envelope (the messages without one are unchanged)
+ */
+func (c *MessageBuilder) SetSyncReturnPath(sync bool) {
+	c.syncReturnPath = sync
+}
+
+func (c *MessageBuilder) GetSyncReturnPath() bool {
+	return c.syncReturnPath
+}
+
+// specify if the Bcc field is removed from the built messages (the recipients stay in the SMTP envelope)
+func (c *MessageBuilder) SetStripBcc(strip bool) {
+	c.stripBcc = strip
+}
+
+func (c *MessageBuilder) GetStripBcc() bool {
+	return c.stripBcc
+}
+
+// set the largest message BuildTo writes (0 unlimited), see OutputSizeError
+func (c *MessageBuilder) SetMaxOutputSize(size int64) {
+	c.maxOutputSize = size
+}
+
+func (c *MessageBuilder) GetMaxOutputSize() int64 {
+	return c.maxOutputSize
+}
+
+/**
+ * check the message can be sent on the output channel: binary parts are
+ * written unchanged and need a channel supporting BINARYMIME
+ */
+func (c *MessageBuilder) CheckTransport(m *Message) error {
+	if c.binaryMIME {
+		return nil
 	}
-	buff.Write(body)
+	var err error
+	m.Walk(func(p *Message) bool {
+		if err == nil && p.ContentTransferEncoding() == "binary" {
+			err = &BinaryContentError{Idx: p.Idx}
+		}
+		return err == nil
+	})
+	return err
+}
 
-	return buff.Bytes()
+// build the message after checking it can be sent on the output channel
+func (c *MessageBuilder) BuildChecked(m *Message) ([]byte, error) {
+	if err := c.CheckTransport(m); err != nil {
+		return nil, err
+	}
+	return c.Build(m), nil
 }
 
 
 /**
- * create header trying to keep the same header order as the original
+ * build the message from components; a decomposed message rebuilt without
+ * changes is byte-identical to the original (see VerifyRoundTrip)
  */
+func(c *MessageBuilder) Build(m *Message) ([]byte) {
+	return c.build(c.prepare(m))
+}
 
-func (c *MessageBuilder) BuildHeader(m *Message) ([]byte) {
+// return m with the builder transformations applied (text alternative, MIME-Version, Date, ...); m itself is not modified
+func (c *MessageBuilder) prepare(m *Message) *Message {
+	if c.generateTextAlternative {
+		m = c.withTextAlternative(m)
+	}
+	if c.stripResourceForks {
+		m = withRootDataFork(m)
+	}
+	m = withMIMEVersion(m)
+	if c.ensureDate {
+		m = withDate(m)
+	}
+	if c.dateLocation != nil {
+		m = withLocalizedDate(m, c.dateLocation)
+	}
+	if c.syncReturnPath || c.stripBcc {
+		m = c.withSMTPEnvelope(m)
+	}
+	if c.verpLocal != "" {
+		m = c.withVERP(m)
+	}
+	if c.messageIDDomain != "" {
+		m = withMessageID(m, c.messageIDDomain)
+	}
+	return m
+}
 
-	if len(m.RawOriginalHeader) > 0 && !m.HeaderIsChanged {
-		return bytes.TrimRight(m.RawOriginalHeader, "\r\n")
+/**
+ * build the message into w part by part instead of in memory; the writing
+ * stops with an *OutputSizeError as soon as the message exceeds the
+ * maximum output size (the bytes written so far stay in w); returns the
+ * number of bytes written
+ */
+func (c *MessageBuilder) BuildTo(w io.Writer, m *Message) (int64, error) {
+	out := &limitedWriter{w: w, limit: c.maxOutputSize}
+	err := c.writeMessage(context.Background(), out, c.prepare(m))
+	return out.written, err
+}
+
+/**
+ * like Build but checks ctx before writing each part: the building of a
+ * canceled context or past its deadline stops with ctx.Err()
+ */
+func (c *MessageBuilder) BuildContext(ctx context.Context, m *Message) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	buff := getBuffer()
+	defer putBuffer(buff)
+	if err := c.writeMessage(ctx, buff, c.prepare(m)); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buff.Bytes()...), nil
+}
+
+// a writer refusing the writes beyond limit bytes (0 unlimited)
+type limitedWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.written+int64(len(p)) > l.limit {
+		return 0, &OutputSizeError{Limit: l.limit}
+	}
+	n, err := l.w.Write(p)
+	l.written += int64(n)
+	return n, err
+}
+
+/**
+ * the buffers the messages are built in, shared by all the builders (a
+ * builder stays safe for concurrent use); the result is copied out with a
+ * single exact sized allocation
+ */
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// a larger buffer is left to the garbage collector instead of pinning its memory in the pool
+const maxPooledBufferSize = 4 << 20
+
+func getBuffer() *bytes.Buffer {
+	buff := bufferPool.Get().(*bytes.Buffer)
+	buff.Reset()
+	return buff
+}
+
+func putBuffer(buff *bytes.Buffer) {
+	if buff.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buff)
 	}
+}
+
+// build a message or a part
+func (c *MessageBuilder) build(m *Message) []byte {
+	buff := getBuffer()
+	defer putBuffer(buff)
+	c.writeMessage(context.Background(), buff, m)
+	return append([]byte(nil), buff.Bytes()...)
+}
 
+/**
+ * write a message or a part; the whole tree is written straight to w, only
+ * the decoded message/rfc822 bodies are built in a buffer to be encoded
+ * again; stops at the first write error or when ctx is done (checked
+ * before each part)
+ */
+func (c *MessageBuilder) writeMessage(ctx context.Context, w io.Writer, m *Message) error {
+	// the boundaries of the whole tree are checked at once
+	return c.writePart(ctx, w, c.withSafeBoundaries(m))
+}
+
+// write a message or a part of a tree with checked boundaries (see writeMessage)
+func (c *MessageBuilder) writePart(ctx context.Context, w io.Writer, m *Message) error {
+	if err := c.writeHeader(w, m); err != nil {
+		return err
+	}
+	if m.IsDecoded {
+		// the encoding depends on the whole content
+		body, err := c.encodedBody(ctx, m)
+		if err == nil {
+			_, err = w.Write(body)
+		}
+		return err
+	}
+	return c.writeContent(ctx, w, m)
+}
+
+// the header of a message or part followed by the blank line
+func (c *MessageBuilder) headerBlock(m *Message) []byte {
 	buff := bytes.NewBuffer([]byte{})
+	c.writeHeaderBlock(buff, m)
+	return buff.Bytes()
+}
 
-	alreadyAdded := make(map[string]bool)
-	if m.HeaderOrder != nil && len(m.HeaderOrder) > 0 {
-		for _, headerCode := range m.HeaderOrder {
-			//fmt.Printf("Header Code: %v\r\n", headerCode)
-			if _, ok := m.Header[textproto.CanonicalMIMEHeaderKey(headerCode)]; ok {
-				if buff.String() != "" {
-					buff.WriteString(c.GetNewline())
-				}
-				//fmt.Printf("Header Value: %v\r\n\r\n", m.Header.Get(headerCode))
+// write the header block (see headerBlock) straight to w
+func (c *MessageBuilder) writeHeaderBlock(w io.Writer, m *Message) error {
+	// a boundary found in the content would cut the message
+	return c.writeHeader(w, c.withSafeBoundaries(m))
+}
+
+// write the header block of a message or part of a tree with checked boundaries
+func (c *MessageBuilder) writeHeader(w io.Writer, m *Message) error {
+	// write header
+	header := c.BuildHeader(m)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	// write header & body separator
+	var err error
+	if terminator := c.headerTerminator(m, header); terminator != nil {
+		_, err = w.Write(terminator)
+	} else if len(header) == 0 {
+		// only the blank line (the parts of a digest have no header)
+		_, err = io.WriteString(w, c.newlineFor(m))
+	} else {
+		nl := c.newlineFor(m)
+		_, err = io.WriteString(w, nl+nl)
+	}
+	return err
+}
+
+// the body of a message or part, with its transfer encoding
+func (c *MessageBuilder) bodyBlock(m *Message) []byte {
+	body, _ := c.encodedBody(context.Background(), c.withSafeBoundaries(m))
+	return body
+}
+
+func (c *MessageBuilder) encodedBody(ctx context.Context, m *Message) ([]byte, error) {
+	buff := getBuffer()
+	defer putBuffer(buff)
+	if err := c.writeContent(ctx, buff, m); err != nil {
+		return nil, err
+	}
+	body := buff.Bytes()
+	if !m.IsDecoded {
+		return append([]byte(nil), body...), nil
+	}
+	/*
+	 * The original message had the body encoded and the
+	 * decomposer decoded it (only for message/rfc822 content type)
+	 * to try to parse the parts
+	 */
+	if m.RawBody != nil && sha256.Sum256(body) == m.decodedBodySum {
+		// unchanged: keep the original encoding
+		return m.RawBody, nil
+	}
+	// the identity encodings return the pooled bytes
+	return append([]byte(nil), EncodeByContentEncoding(body, m.Header.Get("Content-Transfer-Encoding"))...), nil
+}
 
-				buff.WriteString(headerCode + ": " + m.Header.Get(headerCode))
-				alreadyAdded[textproto.CanonicalMIMEHeaderKey(headerCode)] = true
+/**
+ * return the line ending to use for m: its own one, the one of the nearest
+ * ancestor having one (for the added parts), the builder one otherwise;
+ * the builder one is used everywhere when normalizing the newlines
+ */
+func (c *MessageBuilder) newlineFor(m *Message) string {
+	if !c.normalizeNewlines {
+		for node := m; node != nil; node = node.Parent {
+			if node.Newline != "" {
+				return node.Newline
 			}
 		}
 	}
+	if c.newLine != "" {
+		return c.newLine
+	}
+	return "\r\n"
+}
 
-	for key, _ := range m.Header {
-		if _, ok := alreadyAdded[key]; ok {
-			continue
-		}
+// return the original bytes of m (raw header, boundary lines, ...) with the line endings to write
+func (c *MessageBuilder) layoutBytes(m *Message, raw []byte) []byte {
+	if !c.normalizeNewlines || len(raw) == 0 {
+		return raw
+	}
+	return ConvertNewlines(raw, c.newlineFor(m))
+}
 
-		tmp := m.Header.Get(key);
-		if tmp == "" {
-			continue
+// replace the line endings (\r\n or \n) of data with nl
+func ConvertNewlines(data []byte, nl string) []byte {
+	result := make([]byte, 0, len(data)+len(data)/32)
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n':
+			result = append(result, nl...)
+			i++
+		case data[i] == '\n':
+			result = append(result, nl...)
+		default:
+			result = append(result, data[i])
 		}
-		if buff.String() != "" {
-			buff.WriteString(c.GetNewline())
+	}
+	return result
+}
+
+// return the original bytes ending the header if they still fit the header written
+func (c *MessageBuilder) headerTerminator(m *Message, header []byte) []byte {
+	if len(m.HeaderTerminator) == 0 || m.HeaderIsChanged {
+		return nil
+	}
+	if (len(m.RawOriginalHeader) > 0) != (len(header) > 0) {
+		// fields were added to an empty header
+		return nil
+	}
+	return c.layoutBytes(m, m.HeaderTerminator)
+}
+
+/**
+ * check if a raw boundary line (with the preceding line ending) is a
+ * delimiter line of boundary as the parser reads it: "--boundary" (with
+ * "--" for the final one), spaces or tabs and the line ending
+ */
+func isRawDelimiter(raw []byte, boundary string, final bool) bool {
+	line := bytes.TrimLeft(raw, "\r\n")
+	if !bytes.HasPrefix(line, []byte("--"+boundary)) {
+		return false
+	}
+	rest := line[len(boundary)+2:]
+	if final {
+		if !bytes.HasPrefix(rest, []byte("--")) {
+			return false
 		}
-		buff.WriteString(key + ": " + m.Header.Get(key))
+		rest = rest[2:]
 	}
+	rest = bytes.TrimLeft(rest, " \t")
+	return len(rest) == 0 || string(rest) == "\n" || string(rest) == "\r\n"
+}
 
-	return buff.Bytes()
+/**
+ * create header trying to keep the same header order as the original; the
+ * unchanged raw header is kept, a changed one is written again with all the
+ * values of the fields and the long lines folded (mailtextproto.FormatMIMEHeader)
+ */
+
+func (c *MessageBuilder) BuildHeader(m *Message) ([]byte) {
+
+	if len(m.RawOriginalHeader) > 0 && !m.HeaderIsChanged {
+		return c.layoutBytes(m, bytes.TrimRight(m.RawOriginalHeader, "\r\n"))
+	}
+
+	m.LoadHeader()
+	nl := c.newlineFor(m)
+	header := mailtextproto.FormatMIMEHeader(m.Header, m.headerOrder(), nl)
+	return bytes.TrimSuffix(header, []byte(nl))
 }
 
 
@@ -111,80 +516,230 @@ func (c *MessageBuilder) BuildHeader(m *Message) ([]byte) {
  */
 
 func (c *MessageBuilder) BuildBody(m *Message) ([]byte) {
-	buff := bytes.NewBuffer([]byte{})
+	buff := getBuffer()
+	defer putBuffer(buff)
+	c.writeContent(context.Background(), buff, c.withSafeBoundaries(m))
+	return append([]byte(nil), buff.Bytes()...)
+}
+
+// write the body of a message or part (see BuildBody); stops at the first write error
+func (c *MessageBuilder) writeContent(ctx context.Context, w io.Writer, m *Message) error {
+	var err error
+	write := func(data []byte) {
+		if err == nil {
+			_, err = w.Write(data)
+		}
+	}
+	writeString := func(data string) {
+		if err == nil {
+			_, err = io.WriteString(w, data)
+		}
+	}
 
 	if m.IsRfc822() {
-		buff.Write(c.Build(m.BodyMessage))
+		err = c.writePart(ctx, w, m.BodyMessage)
 	} else if len(m.Body) > 0 {
-		buff.Write(m.Body)
+		if m.ContentTransferEncoding() == "binary" {
+			// the line endings are data
+			write(m.Body)
+		} else {
+			write(c.layoutBytes(m, m.Body))
+		}
+	} else if m.IsBodyStored() && err == nil {
+		if m.ContentTransferEncoding() == "binary" || !c.normalizeNewlines {
+			_, err = io.Copy(w, m.BodyReader())
+		} else {
+			// the line endings are converted on the whole body
+			var body []byte
+			if body, err = ioutil.ReadAll(m.BodyReader()); err == nil {
+				write(c.layoutBytes(m, body))
+			}
+		}
 	}
 
 	if m.IsMultipart() {
-		// be sure we have a bondary set
-		if m.Boundary == "" {
-			m.Boundary = RandomBoundary()
-		}
+		nl := c.newlineFor(m)
+		write(c.layoutBytes(m, m.Preamble))
 
 		for idx, part := range m.Parts {
-			if idx > 0 {
-				buff.WriteString(c.GetNewline())
+			if err == nil {
+				err = ctx.Err()
+			}
+			if err != nil {
+				return err
+			}
+			if c.stripResourceForks {
+				if ad := part.AppleDouble(); ad != nil {
+					// keep only the real attachment
+					part = ad.namedDataFork()
+				}
 			}
-			// open boundary
-			buff.WriteString(c.GetNewline()+"--"+m.Boundary+c.GetNewline())
 
-			// build part message
-			buff.Write(c.Build(part))
+			if isRawDelimiter(part.RawDelimiter, m.Boundary, false) {
+				write(c.layoutBytes(m, part.RawDelimiter))
+			} else {
+				if idx > 0 {
+					writeString(nl)
+				}
+				// open boundary
+				writeString(nl + "--" + m.Boundary + nl)
+			}
+
+			// write part message
+			if err == nil {
+				err = c.writePart(ctx, w, part)
+			}
 		}
 		// close boundary
-		buff.WriteString(c.GetNewline()+"--"+m.Boundary+"--"+c.GetNewline())
-
+		if isRawDelimiter(m.RawCloseDelimiter, m.Boundary, true) {
+			write(c.layoutBytes(m, m.RawCloseDelimiter))
+		} else {
+			writeString(nl + "--" + m.Boundary + "--" + nl)
+		}
+		write(c.layoutBytes(m, m.Epilogue))
 	}
-
-	return buff.Bytes()
+	return err
 }
 
+/**
+ * set a header field value; the original raw header is rewritten in place
+ * if the field exists or the field is added to the end
+ */
 func (c *MessageBuilder) SetHeaderField(m *Message, field, value string) {
+	m.LoadHeader()
+	if m.Header == nil {
+		m.Header = make(textproto.MIMEHeader)
+	}
+	_, exists := m.Header[textproto.CanonicalMIMEHeaderKey(field)]
+	if !exists {
+		// keep the order of the raw header for the fields already present
+		m.HeaderOrder = append(m.headerOrder(), field)
+	}
+	m.changes.setHeader(field, value, exists)
 	m.Header.Set(field, value)
 
 	if len(m.RawOriginalHeader) > 0 {
-		// Rewrite the original header if the field exists or add it to the end
-		originalHeader := string(bytes.TrimRight(m.RawOriginalHeader, "\r\n"))
-
-		firstPart := originalHeader
-		remainingPart := ""
-
-		idx := strings.Index(strings.ToLower(originalHeader), strings.ToLower(field))
-		if idx != -1 {
-			// The header field already exists
-			// Remove it to be added at the end
-			firstPart = originalHeader[:idx]
-			remainingPart = originalHeader[idx:]
-
-			for {
-				newLineIdx := strings.Index(remainingPart, "\n")
-				if newLineIdx != -1 {
-					if newLineIdx+1 > len(remainingPart)-1 {
-						break
-					}
-					remainingPart = remainingPart[newLineIdx+1:]
-					// Check if it's the end of the value: should be something
-					// different than space or tab (for multi-line values)
-					if !strings.HasPrefix(remainingPart, " ") && !strings.HasPrefix(remainingPart, "\t") {
-						break
-					}
-				} else {
-					break
-				}
-			}
+		line := mailtextproto.FoldHeaderField(field, value, c.newlineFor(m))
 
+		start, end := headerFieldRange(m.RawOriginalHeader, field)
+		if start == -1 {
+			originalHeader := bytes.TrimRight(m.RawOriginalHeader, "\r\n")
+			m.RawOriginalHeader = []byte(string(originalHeader) + c.newlineFor(m) + line)
+			return
 		}
 
-		originalHeader = strings.TrimRight(firstPart, "\r\n")
-		originalHeader += c.GetNewline()
-		originalHeader += field + ": " + value
-		originalHeader += remainingPart
+		buff := bytes.NewBuffer(make([]byte, 0, len(m.RawOriginalHeader)+len(line)))
+		buff.Write(m.RawOriginalHeader[:start])
+		buff.WriteString(line)
+		buff.Write(m.RawOriginalHeader[end:])
+		m.RawOriginalHeader = buff.Bytes()
+	}
+}
 
-		m.RawOriginalHeader = []byte(originalHeader)
+/**
+ * insert a header field at the top of the header, before the existing
+ * occurrences of the field (trace fields: Received, Authentication-Results)
+ */
+func (c *MessageBuilder) PrependHeaderField(m *Message, field, value string) {
+	m.LoadHeader()
+	if m.Header == nil {
+		m.Header = make(textproto.MIMEHeader)
+	}
+	key := textproto.CanonicalMIMEHeaderKey(field)
+	m.HeaderOrder = append([]string{field}, m.headerOrder()...)
+	m.changes.prependHeader(field, value)
+	m.Header[key] = append([]string{value}, m.Header[key]...)
+
+	if len(m.RawOriginalHeader) > 0 {
+		line := mailtextproto.FoldHeaderField(field, value, c.newlineFor(m))
+		m.RawOriginalHeader = append([]byte(line+c.newlineFor(m)), m.RawOriginalHeader...)
 	}
 }
 
+// add an occurrence of a header field after the existing ones (Autocrypt-Gossip, ...), at the end of the header
+func (c *MessageBuilder) AddHeaderField(m *Message, field, value string) {
+	m.LoadHeader()
+	if m.Header == nil {
+		m.Header = make(textproto.MIMEHeader)
+	}
+	m.HeaderOrder = append(m.headerOrder(), field)
+	m.changes.setHeader(field, value, false)
+	m.Header.Add(field, value)
+
+	if len(m.RawOriginalHeader) > 0 {
+		line := mailtextproto.FoldHeaderField(field, value, c.newlineFor(m))
+		originalHeader := bytes.TrimRight(m.RawOriginalHeader, "\r\n")
+		m.RawOriginalHeader = []byte(string(originalHeader) + c.newlineFor(m) + line)
+	}
+}
+
+// remove all the occurrences of a header field, from the original raw header too
+func (c *MessageBuilder) DelHeaderField(m *Message, field string) {
+	m.LoadHeader()
+	m.changes.delHeader(field, len(m.Header[textproto.CanonicalMIMEHeaderKey(field)]))
+	m.Header.Del(field)
+
+	order := m.headerOrder()
+	m.HeaderOrder = make([]string, 0, len(order))
+	for _, key := range order {
+		if !strings.EqualFold(key, field) {
+			m.HeaderOrder = append(m.HeaderOrder, key)
+		}
+	}
+
+	for len(m.RawOriginalHeader) > 0 {
+		start, end := headerFieldRange(m.RawOriginalHeader, field)
+		if start == -1 {
+			break
+		}
+		// remove the field with its line ending
+		for end < len(m.RawOriginalHeader) && (m.RawOriginalHeader[end] == '\r' || m.RawOriginalHeader[end] == '\n') {
+			end++
+			if m.RawOriginalHeader[end-1] == '\n' {
+				break
+			}
+		}
+		raw := append([]byte(nil), m.RawOriginalHeader[:start]...)
+		raw = append(raw, m.RawOriginalHeader[end:]...)
+		m.RawOriginalHeader = bytes.TrimRight(raw, "\r\n")
+	}
+}
+
+/**
+ * find the first occurrence of field in a raw header; returns the offset where
+ * the field starts and the offset of the line ending of its last folded line,
+ * or -1, -1 if the field is missing
+ */
+func headerFieldRange(raw []byte, field string) (int, int) {
+	start := -1
+	for pos := 0; pos < len(raw); {
+		lineEnd := bytes.IndexByte(raw[pos:], '\n')
+		next := len(raw)
+		if lineEnd != -1 {
+			next = pos + lineEnd + 1
+		}
+		line := raw[pos:next]
+
+		if start != -1 {
+			if len(line) == 0 || (line[0] != ' ' && line[0] != '\t') {
+				return start, len(bytes.TrimRight(raw[:pos], "\r\n"))
+			}
+		} else if isHeaderFieldLine(line, field) {
+			start = pos
+		}
+		pos = next
+	}
+	if start == -1 {
+		return -1, -1
+	}
+	return start, len(bytes.TrimRight(raw, "\r\n"))
+}
+
+// check if the raw header line starts the given field
+func isHeaderFieldLine(line []byte, field string) bool {
+	if len(line) <= len(field) || !strings.EqualFold(string(line[:len(field)]), field) {
+		return false
+	}
+	rest := bytes.TrimLeft(line[len(field):], " \t")
+	return len(rest) > 0 && rest[0] == ':'
+}
@@ -0,0 +1,165 @@
+package mailbuilder
+
+import (
+	"errors"
+	"mime"
+	"net/textproto"
+	"strings"
+)
+
+// returned for a payload which is not an iTIP calendar (VCALENDAR with a METHOD)
+var ErrInvalidCalendar = errors.New("mailbuilder: invalid iCalendar object (missing VCALENDAR or METHOD)")
+
+// a calendar part (text/calendar or application/ics) of a message
+type CalendarPart struct {
+	Part *Message
+
+	// the upper case iTIP method (REQUEST, REPLY, CANCEL, ...): the method
+	// parameter of the Content-Type, the METHOD property otherwise
+	Method string
+}
+
+// return the calendar parts of the message (the attached messages included)
+func (c *Message) CalendarParts() []*CalendarPart {
+	var parts []*CalendarPart
+	c.Walk(func(p *Message) bool {
+		if p.IsMultipart() || p.IsRfc822() {
+			return true
+		}
+		switch p.MediaType() {
+		case "text/calendar", "application/ics":
+			cp := &CalendarPart{Part: p}
+			if _, params, err := mime.ParseMediaType(p.Header.Get("Content-Type")); err == nil {
+				cp.Method = strings.ToUpper(strings.TrimSpace(params["method"]))
+			}
+			if cp.Method == "" {
+				if ics, err := cp.ICalendar(); err == nil {
+					cp.Method = icalMethod(ics)
+				}
+			}
+			parts = append(parts, cp)
+		}
+		return true
+	})
+	return parts
+}
+
+// return the decoded iCalendar object (UTF-8 for text/calendar)
+func (c *CalendarPart) ICalendar() (string, error) {
+	if strings.HasPrefix(c.Part.MediaType(), "text/") {
+		return c.Part.DecodedText()
+	}
+	data, err := c.Part.DecodedBody()
+	return string(data), err
+}
+
+/**
+ * replace the iCalendar object of the part (see SetText); the line endings
+ * become CRLF (RFC 5545) and the method parameter of a text/calendar follows
+ * the METHOD of the new object
+ */
+func (c *CalendarPart) SetICalendar(ics string) {
+	data := ConvertNewlines([]byte(ics), "\r\n")
+	if !strings.HasPrefix(c.Part.MediaType(), "text/") {
+		c.Part.SetDecodedBody(data)
+		c.Method = icalMethod(ics)
+		return
+	}
+
+	c.Part.SetText(string(data))
+	if method := icalMethod(ics); method != "" {
+		if c.Method != method {
+			c.Part.setContentTypeParam("method", method)
+		}
+		c.Method = method
+	}
+}
+
+/**
+ * add a meeting invite (iTIP object with a METHOD) to the message the way the
+ * calendar clients send it (RFC 6047): a text/calendar with the method
+ * parameter as alternative of the body and an application/ics attachment
+ * (invite.ics); the message becomes multipart/mixed if needed
+ */
+func AttachCalendarInvite(m *Message, ics string) error {
+	method := icalMethod(ics)
+	if method == "" || !strings.Contains(strings.ToUpper(ics), "BEGIN:VCALENDAR") {
+		return ErrInvalidCalendar
+	}
+	data := ConvertNewlines([]byte(ics), "\r\n")
+
+	// the alternative holding the body
+	var alternative *Message
+	switch {
+	case m.MediaType() == "multipart/alternative":
+		alternative = m
+	case m.MediaType() == "multipart/mixed" && len(m.Parts) > 0 && (m.Parts[0].MediaType() == "multipart/alternative" || m.Parts[0].isTextLeaf()):
+		alternative = m.Parts[0]
+	default:
+		alternative = m
+	}
+	if alternative.MediaType() != "multipart/alternative" {
+		alternative.wrapContent("alternative")
+	}
+
+	calendar := NewPart(mime.FormatMediaType("text/calendar", map[string]string{"charset": "utf-8", "method": method}), nil, "7bit")
+	calendar.SetText(string(data))
+	alternative.AddPart(calendar)
+
+	if m.MediaType() != "multipart/mixed" {
+		m.wrapContent("mixed")
+	}
+	attachment := NewPart(mime.FormatMediaType("application/ics", map[string]string{"name": "invite.ics"}), data, "base64")
+	attachment.SetHeaderField("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "invite.ics"}))
+	m.AddPart(attachment)
+	return nil
+}
+
+/**
+ * move the content of the message (Content-* headers, body or parts) into a
+ * new first part of a multipart of the given subtype (see ConvertToMultipart)
+ */
+func (c *Message) wrapContent(subtype string) {
+	if !c.IsMultipart() {
+		c.ConvertToMultipart(subtype)
+		return
+	}
+
+	first := NewMessage()
+	for _, key := range c.headerOrder() {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if !strings.HasPrefix(key, "Content-") || c.Header.Get(key) == "" {
+			continue
+		}
+		first.SetHeaderField(key, c.Header.Get(key))
+		c.DelHeaderField(key)
+	}
+	first.Body = c.Body
+	first.Boundary, first.MultipartSubtype = c.Boundary, c.MultipartSubtype
+	first.Preamble, first.Epilogue, first.RawCloseDelimiter = c.Preamble, c.Epilogue, c.RawCloseDelimiter
+	first.Parts = c.Parts
+	for _, p := range first.Parts {
+		p.Parent = first
+	}
+	first.lastPartIdx = c.lastPartIdx
+
+	c.Body, c.Parts = nil, nil
+	c.Preamble, c.Epilogue, c.RawCloseDelimiter = nil, nil, nil
+	c.setMultipartContentType(subtype, nil)
+	c.AddPart(first)
+	if c.Parent == nil && !c.hasMIMEVersion() {
+		c.SetHeaderField("MIME-Version", "1.0")
+	}
+}
+
+// the upper case METHOD property of an iCalendar object ("" if missing)
+func icalMethod(ics string) string {
+	for _, line := range strings.Split(ics, "\n") {
+		line = strings.TrimRight(line, "\r")
+		name, value, found := strings.Cut(line, ":")
+		if found && strings.EqualFold(name, "METHOD") {
+			return strings.ToUpper(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,254 @@
+package mailbuilder
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// returned when a declared charset is not known
+type UnknownCharsetError struct {
+	Charset string
+}
+
+func (e *UnknownCharsetError) Error() string {
+	return fmt.Sprintf("mailbuilder: unknown charset %q", e.Charset)
+}
+
+// check if the charset needs no conversion to UTF-8
+func isUTF8Compatible(charset string) bool {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+	return false
+}
+
+// find the decoder of a charset (iso-8859-*, windows-125x, koi8-r, shift_jis, ...)
+func charsetEncoding(charset string) (encoding.Encoding, error) {
+	name := strings.Trim(strings.ToLower(strings.TrimSpace(charset)), `"`)
+	if enc, err := htmlindex.Get(name); err == nil {
+		return enc, nil
+	}
+	if enc, err := ianaindex.MIME.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	return nil, &UnknownCharsetError{Charset: charset}
+}
+
+// convert UTF-8 data to the given charset; fails if a character can't be represented
+func EncodeCharset(data []byte, charset string) ([]byte, error) {
+	if isUTF8Compatible(charset) {
+		return data, nil
+	}
+	enc, err := charsetEncoding(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewEncoder().Bytes(data)
+}
+
+// convert data from the given charset to UTF-8
+func DecodeCharset(data []byte, charset string) ([]byte, error) {
+	if isUTF8Compatible(charset) {
+		return data, nil
+	}
+	enc, err := charsetEncoding(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Bytes(data)
+}
+
+// return the lower case charset parameter of the Content-Type
+func (c *Message) Charset() string {
+	_, params, err := mime.ParseMediaType(c.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(params["charset"]))
+}
+
+// return the charset of the text: the detected one when known, the declared one otherwise
+func (c *Message) EffectiveCharset() string {
+	if c.DetectedCharset != "" {
+		return c.DetectedCharset
+	}
+	return c.Charset()
+}
+
+/**
+ * guess the real charset of a text part; declared is the charset of the
+ * Content-Type (maybe empty); returns "" when there is no better guess
+ */
+type CharsetDetector interface {
+	DetectCharset(data []byte, declared string) string
+}
+
+/**
+ * the default detector: plain ASCII keeps the declared charset, valid UTF-8
+ * is UTF-8 and other 8-bit data declared as ASCII/UTF-8 (or not declared) is
+ * windows-1252, the usual charset of the mislabeled messages
+ */
+type HeuristicCharsetDetector struct {
+	// charset used for 8-bit data which is not UTF-8; windows-1252 if empty
+	Fallback string
+}
+
+func (d HeuristicCharsetDetector) DetectCharset(data []byte, declared string) string {
+	if !has8Bit(data) {
+		return ""
+	}
+	if utf8.Valid(data) {
+		return "utf-8"
+	}
+	if !isUTF8Compatible(declared) {
+		// a real 8-bit charset is declared
+		return ""
+	}
+	if d.Fallback != "" {
+		return strings.ToLower(d.Fallback)
+	}
+	return "windows-1252"
+}
+
+/**
+ * annotate every text/* leaf part with the charset found by detector (the
+ * default heuristic if nil); the header is left unchanged
+ */
+func (c *Message) DetectCharsets(detector CharsetDetector) {
+	if detector == nil {
+		detector = HeuristicCharsetDetector{}
+	}
+	c.Walk(func(p *Message) bool {
+		if !p.isTextLeaf() {
+			return true
+		}
+		body, err := p.DecodedBody()
+		if err != nil {
+			return true
+		}
+		detected := detector.DetectCharset(body, p.Charset())
+		if detected != "" && detected != p.Charset() {
+			p.DetectedCharset = detected
+		}
+		return true
+	})
+}
+
+// check if the part is a text/* part without children
+func (c *Message) isTextLeaf() bool {
+	return !c.IsMultipart() && !c.IsRfc822() && strings.HasPrefix(c.MediaType(), "text/")
+}
+
+// set a Content-Type parameter keeping the media type and the other parameters
+func (c *Message) setContentTypeParam(name, value string) {
+	mediaType, params, err := mime.ParseMediaType(c.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = c.MediaType(), map[string]string{}
+	}
+	params[name] = value
+	c.SetHeaderField("Content-Type", mime.FormatMediaType(mediaType, params))
+}
+
+/**
+ * convert every text/* leaf part to UTF-8: the body is decoded according to
+ * the Content-Transfer-Encoding and the charset (the detected one when set,
+ * see DetectCharsets), re-encoded as UTF-8 and the Content-Type charset
+ * parameter is updated; the parts with an unknown charset are left unchanged
+ * and the first error is returned
+ */
+func (c *Message) ConvertTextPartsToUTF8() error {
+	var firstErr error
+	c.Walk(func(p *Message) bool {
+		if !p.isTextLeaf() {
+			return true
+		}
+		if err := p.convertToUTF8(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return true
+	})
+	return firstErr
+}
+
+// convert a text leaf part to UTF-8
+func (c *Message) convertToUTF8() error {
+	charset := c.EffectiveCharset()
+	if isUTF8Compatible(charset) && c.DetectedCharset == "" {
+		return nil
+	}
+
+	body, err := c.DecodedBody()
+	if err != nil {
+		return err
+	}
+	converted, err := DecodeCharset(body, charset)
+	if err != nil {
+		return err
+	}
+	c.DetectedCharset = ""
+	c.setContentTypeParam("charset", "utf-8")
+	// the transfer encoding is upgraded if needed
+	c.SetDecodedBody(converted)
+	return nil
+}
+
+// return the text of a leaf part decoded (transfer encoding and charset) to UTF-8
+func (c *Message) DecodedText() (string, error) {
+	body, err := c.DecodedBody()
+	if err != nil {
+		return "", err
+	}
+	text, err := DecodeCharset(body, c.EffectiveCharset())
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// return the first text leaf part of the given media type which is not an attachment
+func (c *Message) findTextBody(mediaType string) *Message {
+	var found *Message
+	c.Walk(func(p *Message) bool {
+		if found != nil {
+			return false
+		}
+		if p.isTextLeaf() && p.MediaType() == mediaType && p.Disposition() != "attachment" {
+			found = p
+		}
+		return true
+	})
+	return found
+}
+
+/**
+ * replace the body of a text part with text (UTF-8): the text is written in
+ * the charset of the part when it can represent it, in UTF-8 otherwise (the
+ * charset parameter is updated) and the transfer encoding is upgraded when
+ * needed (see SetDecodedBody)
+ */
+func (c *Message) SetText(text string) {
+	data := []byte(text)
+	charset := c.EffectiveCharset()
+	if !isUTF8Compatible(charset) {
+		if encoded, err := EncodeCharset(data, charset); err == nil {
+			data = encoded
+		} else {
+			charset = "utf-8"
+		}
+	} else if has8Bit(data) {
+		charset = "utf-8"
+	}
+
+	if charset != c.Charset() {
+		c.setContentTypeParam("charset", charset)
+	}
+	c.DetectedCharset = ""
+	c.SetDecodedBody(data)
+}
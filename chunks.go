@@ -0,0 +1,31 @@
+//go:build go1.23
+
+package mailbuilder
+
+import (
+	"iter"
+)
+
+/**
+ * build the message and yield it in chunks of chunkSize bytes (the last one
+ * can be shorter) for SMTP CHUNKING (RFC 3030): the data is not dot-stuffed,
+ * the size of a chunk is the BDAT size and the bool is true for the last
+ * chunk (BDAT LAST); chunkSize <= 0 yields the whole message in one chunk
+ */
+func (c *MessageBuilder) BuildChunks(m *Message, chunkSize int) iter.Seq2[[]byte, bool] {
+	return func(yield func([]byte, bool) bool) {
+		data := c.Build(m)
+		// the sequence can be iterated again: chunkSize is left unchanged
+		size := chunkSize
+		if size <= 0 || size > len(data) {
+			size = len(data)
+		}
+		for len(data) > size {
+			if !yield(data[:size:size], false) {
+				return
+			}
+			data = data[size:]
+		}
+		yield(data, true)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build go1.23
+
+package mailbuilder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBuildChunks(t *testing.T) {
+	d := NewMessageDecomposer()
+	m, err := d.Decompose(manyPartsMessage(20), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewMessageBuilder()
+	want := b.Build(m)
+
+	chunks := b.BuildChunks(m, 100)
+	// the sequence gives the same chunks each time it is iterated
+	for i := 0; i < 2; i++ {
+		var got []byte
+		n, last := 0, false
+		for chunk, isLast := range chunks {
+			if len(chunk) > 100 || (len(chunk) < 100 && !isLast) {
+				t.Errorf("iteration %d: got a chunk of %d bytes (last %v)", i, len(chunk), isLast)
+			}
+			got = append(got, chunk...)
+			n++
+			last = isLast
+		}
+		if !bytes.Equal(got, want) || !last || n != (len(want)+99)/100 {
+			t.Errorf("iteration %d: got %d chunks of %d bytes", i, n, len(got))
+		}
+	}
+}
+
+func TestBuildChunksWhole(t *testing.T) {
+	m := NewMultipart("mixed", nil)
+	m.AddPart(NewTextPart("first"))
+	b := NewMessageBuilder()
+
+	chunks := b.BuildChunks(m, 0)
+	for i := 0; i < 2; i++ {
+		n := 0
+		for chunk, isLast := range chunks {
+			n++
+			if !isLast || !bytes.Equal(chunk, b.Build(m)) {
+				t.Errorf("iteration %d: got a chunk of %d bytes (last %v)", i, len(chunk), isLast)
+			}
+		}
+		if n != 1 {
+			t.Errorf("iteration %d: got %d chunks, want the whole message", i, n)
+		}
+		// a larger message is still yielded whole
+		m.AddPart(NewTextPart("second"))
+	}
+}
@@ -0,0 +1,110 @@
+package mailbuilder
+
+import (
+	"mime"
+	"net/textproto"
+	"strings"
+)
+
+// create an empty message; the headers keep the order they are set in
+func NewMessage() *Message {
+	return &Message{
+		Header: make(textproto.MIMEHeader),
+	}
+}
+
+/**
+ * create a leaf part: contentType is the full Content-Type value and data
+ * is encoded with the given Content-Transfer-Encoding
+ */
+func NewPart(contentType string, data []byte, encoding string) *Message {
+	m := NewMessage()
+	m.SetHeaderField("Content-Type", contentType)
+	if encoding != "" {
+		m.SetHeaderField("Content-Transfer-Encoding", encoding)
+	}
+	m.Body = EncodeByContentEncoding(data, encoding)
+	return m
+}
+
+// create a multipart container (mixed, alternative, related, ...) with a random boundary
+func NewMultipart(subtype string, params map[string]string) *Message {
+	m := NewMessage()
+	m.setMultipartContentType(subtype, params)
+	return m
+}
+
+// set a multipart Content-Type with a new random boundary
+func (c *Message) setMultipartContentType(subtype string, params map[string]string) {
+	c.Boundary = RandomBoundary()
+	c.MultipartSubtype = strings.ToLower(subtype)
+
+	typeParams := map[string]string{"boundary": c.Boundary}
+	for key, value := range params {
+		typeParams[key] = value
+	}
+	c.SetHeaderField("Content-Type", mime.FormatMediaType("multipart/"+subtype, typeParams))
+}
+
+/**
+ * turn a leaf message into a multipart: the content (body and Content-*
+ * headers) moves into a new first part and the message becomes a container
+ * of the given subtype; a root message gets the missing MIME-Version; a
+ * message which is already multipart is unchanged
+ */
+func (c *Message) ConvertToMultipart(subtype string) {
+	if c.IsMultipart() {
+		return
+	}
+
+	first := NewMessage()
+	for _, key := range c.headerOrder() {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if !strings.HasPrefix(key, "Content-") || c.Header.Get(key) == "" {
+			continue
+		}
+		first.SetHeaderField(key, c.Header.Get(key))
+		c.DelHeaderField(key)
+	}
+	first.Body, first.storedBody = c.Body, c.storedBody
+	first.BodyMessage = c.BodyMessage
+	first.IsDecoded = c.IsDecoded
+	first.RawBody, first.decodedBodySum = c.RawBody, c.decodedBodySum
+	if first.BodyMessage != nil {
+		first.BodyMessage.Parent = first
+	}
+
+	c.Body, c.storedBody = nil, nil
+	c.BodyMessage = nil
+	c.IsDecoded = false
+	c.RawBody = nil
+	c.setMultipartContentType(subtype, nil)
+	c.AddPart(first)
+	if c.Parent == nil && !c.hasMIMEVersion() {
+		c.SetHeaderField("MIME-Version", "1.0")
+	}
+}
+
+// check if the message declares the MIME-Version
+func (c *Message) hasMIMEVersion() bool {
+	return strings.TrimSpace(c.GetHeader("Mime-Version")) != ""
+}
+
+// check if the message needs MIME: a multipart, an attached message or Content-Type/Content-Transfer-Encoding fields
+func (c *Message) usesMIME() bool {
+	return c.IsMultipart() || c.IsRfc822() || c.Header.Get("Content-Type") != "" || c.Header.Get("Content-Transfer-Encoding") != ""
+}
+
+/**
+ * return m with MIME-Version: 1.0 if it is a composed MIME message (root)
+ * without one; the decomposed messages are written as they were received
+ * (see ConvertToMultipart); m itself is not modified
+ */
+func withMIMEVersion(m *Message) *Message {
+	if m.Parent != nil || len(m.HeaderTerminator) > 0 || !m.usesMIME() || m.hasMIMEVersion() {
+		return m
+	}
+	root := copyRootHeader(m)
+	root.SetHeaderField("MIME-Version", "1.0")
+	return root
+}
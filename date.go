@@ -0,0 +1,221 @@
+package mailbuilder
+
+import (
+	"errors"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// returned when the Date header is missing or can't be parsed
+var ErrInvalidDate = errors.New("mailbuilder: missing or invalid Date header")
+
+// the zone comment ending a date: "(PST)", "(CEST)"
+var dateZoneCommentRegexp = regexp.MustCompile(`\(\s*([A-Za-z]{1,6})\s*\)\s*$`)
+
+/**
+ * format a date for the Date header: RFC 5322 with a numeric zone followed
+ * by the zone abbreviation as comment when the location has one
+ * ("Mon, 02 Jan 2006 15:04:05 -0800 (PST)")
+ */
+func FormatDate(t time.Time) string {
+	value := t.Format(headerDateFormat)
+	if abbreviation := zoneAbbreviation(t); abbreviation != "" {
+		value += " (" + abbreviation + ")"
+	}
+	return value
+}
+
+// return the alphabetic zone abbreviation of t or ""
+func zoneAbbreviation(t time.Time) string {
+	name, _ := t.Zone()
+	for _, r := range name {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return ""
+		}
+	}
+	return name
+}
+
+// return the parsed Date header (see ParseDate)
+func (c *Message) Date() (time.Time, bool) {
+	t, err := ParseDate(c.GetHeader("Date"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// set the Date header with the zone abbreviation comment
+func (c *Message) SetDate(t time.Time) {
+	c.SetHeaderField("Date", FormatDate(t))
+}
+
+/**
+ * rewrite the Date header in the canonical RFC 5322 form; the zone comment
+ * of the original value ("(PST)") is kept, the offset is not changed
+ */
+func (c *Message) NormalizeDate() error {
+	value := strings.TrimSpace(c.GetHeader("Date"))
+	t, err := ParseDate(value)
+	if err != nil {
+		return ErrInvalidDate
+	}
+
+	normalized := t.Format(headerDateFormat)
+	if match := dateZoneCommentRegexp.FindStringSubmatch(value); match != nil {
+		normalized += " (" + match[1] + ")"
+	} else if abbreviation := zoneAbbreviation(t); abbreviation != "" {
+		normalized += " (" + abbreviation + ")"
+	}
+	if normalized != value {
+		c.SetHeaderField("Date", normalized)
+	}
+	return nil
+}
+
+// the obsolete zone names of RFC 5322 section 4.3 and the common ones
+var dateZoneOffsets = map[string]string{
+	"UT": "+0000", "UTC": "+0000", "GMT": "+0000", "Z": "+0000",
+	"EST": "-0500", "EDT": "-0400", "CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600", "PST": "-0800", "PDT": "-0700",
+	"CET": "+0100", "CEST": "+0200", "BST": "+0100",
+}
+
+var (
+	// "02-Jan-2006"
+	dateDashedRegexp = regexp.MustCompile(`^(\d{1,2})-([A-Za-z]{3})-(\d{2,4})\b`)
+
+	// "+02:00", "GMT+0200", "UTC+2"
+	dateColonZoneRegexp    = regexp.MustCompile(`([+-]\d{2}):(\d{2})$`)
+	datePrefixedZoneRegexp = regexp.MustCompile(`(?i)\b(?:GMT|UTC|UT)([+-])(\d{1,2})(\d{2})?$`)
+)
+
+// the layouts tried for the dates net/mail rejects, after normalization
+var dateLayouts = []string{
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2 15:04:05 2006 -0700",
+	"Jan 2 15:04:05 -0700 2006",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 Jan 06 15:04:05",
+	"Jan 2 15:04:05 2006",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+/**
+ * parse a date header value: RFC 5322 dates and the malformed ones seen in
+ * the wild (missing day of week or seconds, two digit years, dashes
+ * "02-Jan-2006", zone names, "GMT+0200", "+02:00", asctime and ISO 8601
+ * forms, comments and extra white space); a date without zone is UTC
+ */
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := mail.ParseDate(value); err == nil {
+		return t, nil
+	}
+
+	words := make([]string, 0)
+	for _, token := range receivedTokens(value) {
+		if isReceivedComment(token) {
+			continue
+		}
+		if len(words) == 0 && isDayOfWeek(strings.TrimRight(token, ",")) {
+			continue
+		}
+		if offset, ok := dateZoneOffsets[strings.ToUpper(token)]; ok && len(words) > 0 {
+			token = offset
+		}
+		words = append(words, strings.TrimRight(token, ","))
+	}
+	value = strings.Join(words, " ")
+	value = dateDashedRegexp.ReplaceAllString(value, "$1 $2 $3")
+	value = dateColonZoneRegexp.ReplaceAllString(value, "$1$2")
+	if match := datePrefixedZoneRegexp.FindStringSubmatch(value); match != nil {
+		hours, minutes := match[2], match[3]
+		if len(hours) == 1 {
+			hours = "0" + hours
+		}
+		if minutes == "" {
+			minutes = "00"
+		}
+		value = strings.TrimSpace(value[:len(value)-len(match[0])]) + " " + match[1] + hours + minutes
+	}
+	if strings.HasSuffix(value, "Z") {
+		value = strings.TrimSuffix(value, "Z") + "+0000"
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrInvalidDate
+}
+
+// check if word is a day of the week name ("Mon", "monday")
+func isDayOfWeek(word string) bool {
+	if len(word) < 3 {
+		return false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if name := day.String(); strings.EqualFold(word, name) || strings.EqualFold(word, name[:3]) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * return m with a Date header set to now if it has none; m itself is not
+ * modified
+ */
+func withDate(m *Message) *Message {
+	if strings.TrimSpace(m.GetHeader("Date")) != "" {
+		return m
+	}
+	root := copyRootHeader(m)
+	root.SetDate(time.Now())
+	return root
+}
+
+/**
+ * return m with the Date header converted to loc and the matching zone
+ * comment; m itself is not modified, the root is a copy
+ */
+func withLocalizedDate(m *Message, loc *time.Location) *Message {
+	t, ok := m.Date()
+	if !ok {
+		return m
+	}
+	localized := FormatDate(t.In(loc))
+	if localized == strings.TrimSpace(m.GetHeader("Date")) {
+		return m
+	}
+
+	root := copyRootHeader(m)
+	root.SetHeaderField("Date", localized)
+	return root
+}
+
+// return a copy of m whose header can be changed without changing m
+func copyRootHeader(m *Message) *Message {
+	root := *m
+	root.changes = nil
+	root.Header = make(textproto.MIMEHeader)
+	root.RawOriginalHeader = append([]byte(nil), m.RawOriginalHeader...)
+	root.HeaderOrder = append([]string(nil), m.headerOrder()...)
+	for key, values := range m.Header {
+		root.Header[key] = append([]string(nil), values...)
+	}
+	return &root
+}
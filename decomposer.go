@@ -2,6 +2,8 @@ package mailbuilder
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"io"
 	"io/ioutil"
 	"strconv"
@@ -17,7 +19,14 @@ import (
 
 // read an email
 func ReadMessage(r io.Reader) (msg *mail.Message, rawOriginalHeader []byte, err error) {
-	tp := mailtextproto.NewReader(bufio.NewReader(r))
+	return readMessage(r, mailtextproto.Limits{})
+}
+
+// read an email, its header within limits
+func readMessage(r io.Reader, limits mailtextproto.Limits) (msg *mail.Message, rawOriginalHeader []byte, err error) {
+	tp := mailtextproto.GetReader(bufio.NewReader(r))
+	defer mailtextproto.PutReader(tp)
+	tp.SetLimits(limits)
 
 	hdr, rawOriginalHeader, err := tp.ReadMIMEHeader()
 	if err != nil {
@@ -30,31 +39,207 @@ func ReadMessage(r io.Reader) (msg *mail.Message, rawOriginalHeader []byte, err
 	}, rawOriginalHeader, nil
 }
 
-type MessageDecomposer struct {}
+/**
+ * messages are allocated in blocks: a newsletter or a calendar digest can have
+ * thousands of tiny parts and one allocation per part dominates the decomposing;
+ * the blocks of a call grow from firstMessageBlockSize to messageBlockSize so a
+ * small message allocates no unused messages (a part kept alone keeps its
+ * block alive, the parts of the same message only)
+ */
+const (
+	firstMessageBlockSize = 4
+	messageBlockSize      = 64
+)
+
+// the state of a single Decompose call; the decomposer itself only holds the
+// options, so one decomposer can be used by concurrent calls
+type decomposition struct {
+	// preallocated messages handed out by newMessage
+	block     []Message
+	blockSize int
+
+	// scratch buffer used to read the leaf bodies
+	scratch bytes.Buffer
+
+	// checked before reading each part (see DecomposeContext)
+	ctx context.Context
+
+	// the file of DecomposeFile keeping the large leaf bodies (see SetFileBodies)
+	file *fileBodies
+}
+
+type MessageDecomposer struct {
+	// guess the transfer encoding of the bodies without one
+	detectEncoding bool
+
+	// annotate the text parts with their real charset
+	charsetDetector CharsetDetector
+
+	// parse only the Content-* fields of the message headers
+	lazyHeaders bool
+
+	// DecomposeFile reads the file as a stream instead of loading it whole
+	streamFiles bool
+
+	// DecomposeFile keeps the large leaf bodies as sections of the file
+	fileBodies bool
+
+	// where the leaf bodies larger than spillThreshold bytes are kept (nil keeps all in memory)
+	bodyStore      BodyStore
+	spillThreshold int64
+
+	// the limits of the header readers (see SetReaderLimits)
+	readerLimits mailtextproto.Limits
+}
 
 func NewMessageDecomposer() MessageDecomposer {
 	return MessageDecomposer{}
 }
 
+/**
+ * specify if the leaf bodies sent without Content-Transfer-Encoding (or 7bit)
+ * are checked for a hidden encoding; the guess is stored in SuggestedEncoding
+ */
+func (d *MessageDecomposer) SetDetectEncoding(detect bool) {
+	d.detectEncoding = detect
+}
+
+func (d *MessageDecomposer) GetDetectEncoding() bool {
+	return d.detectEncoding
+}
+
+// set the detector used to fill DetectedCharset of the text parts; nil disables the detection
+func (d *MessageDecomposer) SetCharsetDetector(detector CharsetDetector) {
+	d.charsetDetector = detector
+}
+
+func (d *MessageDecomposer) GetCharsetDetector() CharsetDetector {
+	return d.charsetDetector
+}
+
+/**
+ * specify if the headers of the messages (the root and the attached ones)
+ * are parsed lazily: only the Content-* fields go into Header, the others
+ * are parsed on demand by GetHeader or all at once by LoadHeader (called
+ * by the methods changing the header); the part headers are always parsed
+ */
+func (d *MessageDecomposer) SetLazyHeaders(lazy bool) {
+	d.lazyHeaders = lazy
+}
+
+func (d *MessageDecomposer) GetLazyHeaders() bool {
+	return d.lazyHeaders
+}
+
+/**
+ * specify if DecomposeFile streams the file (see DecomposeReader) instead of
+ * reading it whole first: the raw message is never held in memory, only
+ * its decomposed parts; ignored with lazy headers, which need the raw header
+ */
+func (d *MessageDecomposer) SetStreamFiles(stream bool) {
+	d.streamFiles = stream
+}
+
+func (d *MessageDecomposer) GetStreamFiles() bool {
+	return d.streamFiles
+}
+
+/**
+ * specify if DecomposeFile streams the file keeping the leaf bodies larger
+ * than the spill threshold as sections of the file, read at their byte
+ * offsets, instead of reading them or keeping them in the body store (see
+ * Message.BodyReader): a message of several GB is decomposed without
+ * matching memory or temporary files; the file stays open until all those
+ * bodies are released (see Message.ReleaseBodies) and must not change
+ * meanwhile; the message/rfc822 parts are always read in memory; ignored
+ * with lazy headers
+ */
+func (d *MessageDecomposer) SetFileBodies(fileBodies bool) {
+	d.fileBodies = fileBodies
+}
+
+func (d *MessageDecomposer) GetFileBodies() bool {
+	return d.fileBodies
+}
+
+/**
+ * set where the leaf bodies larger than the spill threshold are kept
+ * instead of Message.Body (see BodyStore and Message.BodyReader); the
+ * message/rfc822 parts are always read in memory; nil disables it
+ */
+func (d *MessageDecomposer) SetBodyStore(store BodyStore) {
+	d.bodyStore = store
+}
+
+func (d *MessageDecomposer) GetBodyStore() BodyStore {
+	return d.bodyStore
+}
+
+// set the size above which a leaf body goes to the body store
+func (d *MessageDecomposer) SetSpillThreshold(size int64) {
+	d.spillThreshold = size
+}
+
+func (d *MessageDecomposer) GetSpillThreshold() int64 {
+	return d.spillThreshold
+}
+
+/**
+ * set the limits applied to the reading of every header, the message one and
+ * the part ones (see mailtextproto.Limits); the decomposing fails with the
+ * error of the limit reached (*mailtextproto.LineTooLongError, ...)
+ */
+func (d *MessageDecomposer) SetReaderLimits(limits mailtextproto.Limits) {
+	d.readerLimits = limits
+}
+
+func (d *MessageDecomposer) GetReaderLimits() mailtextproto.Limits {
+	return d.readerLimits
+}
+
 // decompose a message in components: header, body, parts
 func (d *MessageDecomposer) Decompose(rawMessage []byte, partIdx string) (result *Message, err error) {
-	reader := bytes.NewReader(rawMessage)
+	return d.decompose(&decomposition{ctx: context.Background()}, rawMessage, partIdx)
+}
+
+func (d *MessageDecomposer) decompose(s *decomposition, rawMessage []byte, partIdx string) (*Message, error) {
+	if d.lazyHeaders {
+		return d.decomposeLazy(s, rawMessage, partIdx)
+	}
+	return d.decomposeReader(s, bytes.NewReader(rawMessage), partIdx)
+}
+
+// decompose a message read from r, without reading it whole first (the lazy headers apart)
+func (d *MessageDecomposer) DecomposeReader(r io.Reader, partIdx string) (*Message, error) {
+	if d.lazyHeaders {
+		rawMessage, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.decomposeLazy(&decomposition{ctx: context.Background()}, rawMessage, partIdx)
+	}
+	return d.decomposeReader(&decomposition{ctx: context.Background()}, r, partIdx)
+}
+
+// decompose a message read from reader (Decompose without the lazy headers)
+func (d *MessageDecomposer) decomposeReader(s *decomposition, reader io.Reader, partIdx string) (result *Message, err error) {
 	//msg, err := mail.ReadMessage(reader)
-	msg, originalHeader, err := ReadMessage(reader)
+	msg, originalHeader, err := readMessage(reader, d.readerLimits)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if msg != nil {
-		result = &Message{}
+		result = s.newMessage()
 		result.Idx = partIdx
 		result.Header = textproto.MIMEHeader(msg.Header)
 		result.rfc822Depth = 0
 		//result.SetOriginalHeaderOrder(rawMessage)
 		result.SetOriginalHeaderOrder(originalHeader)
+		result.Newline = newlineOf(result.HeaderTerminator)
 
-		err := d.ReadParts(result, msg.Body)
+		err := d.readParts(s, result, msg.Body, int64(len(originalHeader)))
 		if err != nil {
 			return nil, err
 		}
@@ -63,6 +248,39 @@ func (d *MessageDecomposer) Decompose(rawMessage []byte, partIdx string) (result
 	return nil, err
 }
 
+// decompose a message parsing only the Content-* fields of its header
+func (d *MessageDecomposer) decomposeLazy(s *decomposition, rawMessage []byte, partIdx string) (*Message, error) {
+	result := s.newMessage()
+	result.Idx = partIdx
+	result.SetOriginalHeaderOrder(rawMessage)
+	result.Newline = newlineOf(result.HeaderTerminator)
+	if d.readerLimits != (mailtextproto.Limits{}) {
+		// the lazy header is parsed later: check it now
+		header := rawMessage[:len(result.RawOriginalHeader)+len(result.HeaderTerminator)]
+		if _, _, err := readMessage(bytes.NewReader(header), d.readerLimits); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	result.lazyHeader = NewHeaderView(result.RawOriginalHeader)
+	result.Header = result.lazyHeader.contentHeader()
+
+	body := rawMessage[len(result.RawOriginalHeader)+len(result.HeaderTerminator):]
+	if err := d.readParts(s, result, bytes.NewReader(body), int64(len(rawMessage)-len(body))); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+/**
+ * like Decompose but checks ctx before reading each part: the decomposing
+ * of a canceled context or past its deadline stops with ctx.Err()
+ */
+func (d *MessageDecomposer) DecomposeContext(ctx context.Context, rawMessage []byte, partIdx string) (*Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return d.decompose(&decomposition{ctx: ctx}, rawMessage, partIdx)
+}
 
 // decompose an eml in parts
 func (d *MessageDecomposer) DecomposeFile(file string) (*Message, error) {
@@ -70,6 +288,32 @@ func (d *MessageDecomposer) DecomposeFile(file string) (*Message, error) {
 		return nil, err
 	}
 
+	if d.fileBodies && !d.lazyHeaders {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		fb := &fileBodies{file: f, refs: 1}
+		m, err := d.decomposeReader(&decomposition{ctx: context.Background(), file: fb}, f, "")
+		if err != nil {
+			// the bodies of a failed decomposing can't be released
+			f.Close()
+			return nil, err
+		}
+		// the bodies kept in the file hold it open
+		fb.release()
+		return m, nil
+	}
+
+	if d.streamFiles {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return d.DecomposeReader(f, "")
+	}
+
 	rawMessage, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
@@ -79,9 +323,70 @@ func (d *MessageDecomposer) DecomposeFile(file string) (*Message, error) {
 }
 
 
+// return a message from the current preallocated block
+func (s *decomposition) newMessage() *Message {
+	if len(s.block) == 0 {
+		switch {
+		case s.blockSize == 0:
+			s.blockSize = firstMessageBlockSize
+		case s.blockSize < messageBlockSize:
+			s.blockSize *= 2
+		}
+		s.block = make([]Message, s.blockSize)
+	}
+	m := &s.block[0]
+	s.block = s.block[1:]
+	return m
+}
+
+// read the whole body with a single exact sized allocation
+func (s *decomposition) readBody(r io.Reader) ([]byte, error) {
+	s.scratch.Reset()
+	if _, err := s.scratch.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), s.scratch.Bytes()...), nil
+}
+
+// return the line ending used by a header terminator
+func newlineOf(terminator []byte) string {
+	if bytes.HasSuffix(terminator, []byte("\r\n")) {
+		return "\r\n"
+	}
+	if bytes.HasSuffix(terminator, []byte("\n")) {
+		return "\n"
+	}
+	return ""
+}
+
+// build the index of the n-th part of parent without intermediate strings
+func childIdx(parentIdx string, n int64) string {
+	var buf [32]byte
+	b := append(buf[:0], parentIdx...)
+	if parentIdx != "" {
+		b = append(b, '-')
+	}
+	b = strconv.AppendInt(b, n, 10)
+	return string(b)
+}
+
+// check if the part is declared message/rfc822; the parts of a digest are by default
+func (c *Message) isRfc822Content() bool {
+	contentType := strings.Trim(c.Header.Get("Content-Type"), " \t")
+	if contentType == "" {
+		return c.Parent != nil && c.Parent.MultipartSubtype == "digest"
+	}
+	return strings.HasPrefix(contentType, "message/rfc822")
+}
+
 // extract boundary if exists
 func (d *MessageDecomposer) ExtractBoundary(header textproto.MIMEHeader) (string, error) {
-	_, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	contentType := header.Get("Content-Type")
+	if !strings.Contains(strings.ToLower(contentType), "boundary") {
+		// avoid parsing the media type of every leaf part
+		return "", nil
+	}
+	_, params, err := mime.ParseMediaType(contentType)
 	if boundary, ok := params["boundary"]; ok {
 		return boundary, nil
 	}
@@ -91,38 +396,59 @@ func (d *MessageDecomposer) ExtractBoundary(header textproto.MIMEHeader) (string
 
 // read message parts
 func (d *MessageDecomposer) ReadParts(result *Message, bodyReader io.Reader) error {
+	return d.readParts(&decomposition{ctx: context.Background()}, result, bodyReader, 0)
+}
+
+// offset is the offset of the body in the file of DecomposeFile (see SetFileBodies)
+func (d *MessageDecomposer) readParts(s *decomposition, result *Message, bodyReader io.Reader, offset int64) error {
 	boundary, _ := d.ExtractBoundary(result.Header)
 
-	if boundary != "" {
-		// Multipart
+	// a boundary parameter of another media type doesn't split the body
+	if boundary != "" && strings.HasPrefix(result.MediaType(), "multipart/") {
+		// Multipart; the unknown subtypes are read by boundary too
 		result.Boundary = boundary
+		result.MultipartSubtype = multipartSubtype(result.MediaType())
+		if ValidateBoundary(boundary) != nil {
+			// still read: the message is kept as received
+			result.AddWarnings("invalid multipart boundary " + strconv.Quote(boundary))
+		}
 
-		reader := mailmultipart.NewReader(bodyReader, result.Boundary)
+		// the content is hashed to tell if it is built unchanged
+		sum := sha256.New()
+		reader := mailmultipart.NewReader(io.TeeReader(bodyReader, sum), result.Boundary)
+		reader.Limits = d.readerLimits
 		var idx int64 = 0
 		for {
 			idx += 1
+			if err := s.ctx.Err(); err != nil {
+				return err
+			}
 			part, err := reader.NextPart()
 
 			if err == io.EOF {
+				if err := d.readMultipartLayout(result, reader); err != nil {
+					return err
+				}
+				if result.IsMultipart() {
+					result.contentSum = sum.Sum(nil)
+				}
 				return nil
 			}
 			if err != nil {
 				return err
 			}
 
-			newPartEmail := &Message{}
+			newPartEmail := s.newMessage()
 			newPartEmail.Header = part.Header
 			newPartEmail.RawOriginalHeader = part.RawOriginalHeader
-			newPartEmail.Idx = result.Idx
+			newPartEmail.HeaderTerminator = part.HeaderTerminator
+			newPartEmail.RawDelimiter = part.RawDelimiter
+			newPartEmail.Newline = newlineOf(part.HeaderTerminator)
+			newPartEmail.Idx = childIdx(result.Idx, idx)
 			newPartEmail.rfc822Depth = result.rfc822Depth
 			newPartEmail.Parent = result
 
-			if newPartEmail.Idx != "" {
-				newPartEmail.Idx += "-"
-			}
-			newPartEmail.Idx += strconv.FormatInt(idx, 10)
-
-			err = d.ReadParts(newPartEmail, part)
+			err = d.readParts(s, newPartEmail, part, offset+part.BodyOffset)
 			if err != nil {
 				return err
 			}
@@ -130,23 +456,39 @@ func (d *MessageDecomposer) ReadParts(result *Message, bodyReader io.Reader) err
 			result.Parts = append(result.Parts, newPartEmail)
 		}
 	} else {
-		rawPartBody, err := ioutil.ReadAll(bodyReader)
+		rfc822 := result.isRfc822Content() && result.rfc822Depth < 5
+
+		var rawPartBody []byte
+		var err error
+		switch {
+		case s.file != nil && !rfc822:
+			rawPartBody, err = d.readFileBody(s.file, result, bodyReader, offset)
+		case d.bodyStore != nil && !rfc822:
+			rawPartBody, err = d.readLeafBody(s, result, bodyReader)
+		default:
+			rawPartBody, err = s.readBody(bodyReader)
+		}
 		if err != nil {
 			return err
 		}
 
 		decodedAsMessage := false
 
-		if strings.HasPrefix(strings.Trim(result.Header.Get("Content-Type"), " \t"), "message/rfc822") && result.rfc822Depth < 5 {
+		if rfc822 {
 			/**
 			 * If we get an message/rfc822 part try to see if it contains
 			 * an email; goes to max 5 message/rfc822 depth
 			 */
 			// Try to parse the body as a new Message
-			decodedBody, isDecoded, err := DecodeByContentEncoding(rawPartBody, result.Header.Get("Content-Transfer-Encoding"))
+			decodedBody, isDecoded, warnings, err := DecodeByContentEncodingWithWarnings(rawPartBody, result.Header.Get("Content-Transfer-Encoding"))
 			if err == nil {
+				result.AddWarnings(warnings...)
 				// Try to decode the part if is base64 or quoted-printable to be parsed as email
-				newMessage, err := d.Decompose(decodedBody, result.Idx+"-0")
+				// the decoded message isn't read from the file
+				file := s.file
+				s.file = nil
+				newMessage, err := d.decompose(s, decodedBody, result.Idx+"-0")
+				s.file = file
 				if err == nil {
 					newMessage.rfc822Depth = result.rfc822Depth + 1
 					newMessage.Parent  = result
@@ -154,6 +496,11 @@ func (d *MessageDecomposer) ReadParts(result *Message, bodyReader io.Reader) err
 
 					// Mark the body was decoded so we encode it back when recompose the email
 					result.IsDecoded = isDecoded
+					if isDecoded {
+						// keep the original encoding while the message is unchanged
+						result.RawBody = rawPartBody
+						result.decodedBodySum = sha256.Sum256(decodedBody)
+					}
 
 					decodedAsMessage = true
 				}
@@ -162,8 +509,38 @@ func (d *MessageDecomposer) ReadParts(result *Message, bodyReader io.Reader) err
 
 		if !decodedAsMessage {
 			// The part has no more parts
-			result.Body = rawPartBody
+			if result.storedBody == nil {
+				result.Body = rawPartBody
+			}
+			if d.detectEncoding {
+				result.detectTransferEncoding()
+			}
+			if d.charsetDetector != nil && result.isTextLeaf() {
+				result.DetectCharsets(d.charsetDetector)
+			}
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+/**
+ * keep the bytes around the parts of a multipart (preamble, final boundary
+ * line and epilogue) so the message can be rebuilt identically; a multipart
+ * without parts becomes a simple body holding those bytes
+ */
+func (d *MessageDecomposer) readMultipartLayout(result *Message, reader *mailmultipart.Reader) error {
+	epilogue, err := reader.Epilogue()
+	if err != nil {
+		return err
+	}
+	if len(result.Parts) == 0 {
+		body := append([]byte(nil), reader.Preamble...)
+		body = append(body, reader.RawCloseDelimiter...)
+		result.Body = append(body, epilogue...)
+		return nil
+	}
+	result.Preamble = reader.Preamble
+	result.RawCloseDelimiter = reader.RawCloseDelimiter
+	result.Epilogue = epilogue
+	return nil
+}
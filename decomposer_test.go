@@ -0,0 +1,62 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// a multipart/mixed message with n small text parts
+func manyPartsMessage(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString("From: a@example.com\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "--b\r\nContent-Type: text/plain\r\n\r\npart %d\r\n", i)
+	}
+	b.WriteString("--b--\r\n")
+	return b.Bytes()
+}
+
+func TestDecomposeConcurrent(t *testing.T) {
+	raw := manyPartsMessage(200)
+	d := NewMessageDecomposer()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				m, err := d.Decompose(raw, "")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(m.Parts) != 200 {
+					t.Errorf("got %d parts, want 200", len(m.Parts))
+					return
+				}
+				for k, p := range m.Parts {
+					if want := fmt.Sprintf("part %d", k); string(p.Body) != want {
+						t.Errorf("part %s: got body %q, want %q", p.Idx, p.Body, want)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkDecomposeManyParts(b *testing.B) {
+	raw := manyPartsMessage(5000)
+	d := NewMessageDecomposer()
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Decompose(raw, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
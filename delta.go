@@ -0,0 +1,175 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+/**
+ * delta encoding of modified messages: Diff describes the rebuilt message as
+ * ranges copied from the original and inserted bytes, so a quarantine or a
+ * modification log can store the delta instead of a full copy
+ *
+ * format: "MBD" version, original length, original crc32, rebuilt length,
+ * then the operations: 'C' offset length (copy from the original) or 'I'
+ * length data (insert); the numbers are unsigned varints
+ */
+
+const (
+	deltaMagic  = "MBD\x01"
+	deltaCopy   = 'C'
+	deltaInsert = 'I'
+
+	// lines shorter than this only extend a copy, they never start one
+	deltaMinMatch = 4
+)
+
+var (
+	ErrInvalidDelta  = errors.New("mailbuilder: invalid delta")
+	ErrDeltaMismatch = errors.New("mailbuilder: delta doesn't apply to this message")
+)
+
+// return the delta turning original into rebuilt
+func Diff(original, rebuilt []byte) []byte {
+	// original line offsets by line content
+	index := make(map[string][]int)
+	for pos := 0; pos < len(original); {
+		line := nextDeltaLine(original, pos)
+		if len(line) >= deltaMinMatch {
+			index[string(line)] = append(index[string(line)], pos)
+		}
+		pos += len(line)
+	}
+
+	buff := bytes.NewBufferString(deltaMagic)
+	writeUvarint(buff, uint64(len(original)))
+	binary.Write(buff, binary.BigEndian, crc32.ChecksumIEEE(original))
+	writeUvarint(buff, uint64(len(rebuilt)))
+
+	copyStart, copyEnd := -1, -1
+	var insert []byte
+	flush := func() {
+		if copyStart != -1 {
+			buff.WriteByte(deltaCopy)
+			writeUvarint(buff, uint64(copyStart))
+			writeUvarint(buff, uint64(copyEnd-copyStart))
+			copyStart, copyEnd = -1, -1
+		}
+		if len(insert) > 0 {
+			buff.WriteByte(deltaInsert)
+			writeUvarint(buff, uint64(len(insert)))
+			buff.Write(insert)
+			insert = insert[:0]
+		}
+	}
+
+	lastEnd := 0
+	for pos := 0; pos < len(rebuilt); {
+		line := nextDeltaLine(rebuilt, pos)
+		pos += len(line)
+
+		if copyStart != -1 && bytes.HasPrefix(original[copyEnd:], line) {
+			// the copy continues
+			copyEnd += len(line)
+			lastEnd = copyEnd
+			continue
+		}
+
+		if start := deltaCandidate(index[string(line)], lastEnd); start != -1 {
+			flush()
+			copyStart, copyEnd = start, start+len(line)
+			lastEnd = copyEnd
+			continue
+		}
+
+		if copyStart != -1 {
+			flush()
+		}
+		insert = append(insert, line...)
+	}
+	flush()
+
+	return buff.Bytes()
+}
+
+// rebuild the modified message from the original and the delta returned by Diff
+func Apply(original, delta []byte) ([]byte, error) {
+	if !bytes.HasPrefix(delta, []byte(deltaMagic)) {
+		return nil, ErrInvalidDelta
+	}
+	r := bytes.NewReader(delta[len(deltaMagic):])
+
+	originalLength, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrInvalidDelta
+	}
+	var sum uint32
+	if err := binary.Read(r, binary.BigEndian, &sum); err != nil {
+		return nil, ErrInvalidDelta
+	}
+	if originalLength != uint64(len(original)) || sum != crc32.ChecksumIEEE(original) {
+		return nil, ErrDeltaMismatch
+	}
+	rebuiltLength, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrInvalidDelta
+	}
+
+	// the length is checked at the end, it isn't trusted for the allocation
+	result := make([]byte, 0, len(original)+len(delta))
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		switch op {
+		case deltaCopy:
+			offset, err1 := binary.ReadUvarint(r)
+			length, err2 := binary.ReadUvarint(r)
+			if err1 != nil || err2 != nil || offset > uint64(len(original)) || length > uint64(len(original))-offset {
+				return nil, ErrInvalidDelta
+			}
+			result = append(result, original[offset:offset+length]...)
+		case deltaInsert:
+			length, err := binary.ReadUvarint(r)
+			if err != nil || length > uint64(r.Len()) {
+				return nil, ErrInvalidDelta
+			}
+			data := make([]byte, length)
+			r.Read(data)
+			result = append(result, data...)
+		default:
+			return nil, ErrInvalidDelta
+		}
+	}
+
+	if uint64(len(result)) != rebuiltLength {
+		return nil, ErrInvalidDelta
+	}
+	return result, nil
+}
+
+// return the line starting at pos, with its line ending
+func nextDeltaLine(data []byte, pos int) []byte {
+	if i := bytes.IndexByte(data[pos:], '\n'); i != -1 {
+		return data[pos : pos+i+1]
+	}
+	return data[pos:]
+}
+
+// choose the original offset of a matching line: the first after the previous copy if any
+func deltaCandidate(offsets []int, after int) int {
+	for _, offset := range offsets {
+		if offset >= after {
+			return offset
+		}
+	}
+	if len(offsets) > 0 {
+		return offsets[0]
+	}
+	return -1
+}
+
+func writeUvarint(buff *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buff.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
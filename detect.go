@@ -0,0 +1,96 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// the shortest body considered when guessing a transfer encoding
+const minDetectedBodyLength = 16
+
+/**
+ * guess the transfer encoding of a body sent without (or with a 7bit)
+ * Content-Transfer-Encoding by broken gateways; only base64 is detected:
+ * every line is made of the base64 alphabet, the lines (except the last one)
+ * have the same length multiple of 4 and the whole body decodes; returns
+ * "base64" or "" if the body doesn't look encoded
+ */
+func DetectTransferEncoding(body []byte) string {
+	lines := bytes.Split(bytes.TrimRight(body, "\r\n"), []byte("\n"))
+	lineLength := -1
+	total := 0
+	hasDigitOrSymbol, hasUpper, hasLower := false, false, false
+
+	for i, line := range lines {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			return ""
+		}
+		last := i == len(lines)-1
+		if !last {
+			if lineLength == -1 {
+				lineLength = len(line)
+			}
+			if len(line) != lineLength || lineLength%4 != 0 {
+				return ""
+			}
+		} else if lineLength != -1 && len(line) > lineLength {
+			return ""
+		}
+
+		for j, c := range line {
+			switch {
+			case c >= 'A' && c <= 'Z':
+				hasUpper = true
+			case c >= 'a' && c <= 'z':
+				hasLower = true
+			case c >= '0' && c <= '9', c == '+', c == '/':
+				hasDigitOrSymbol = true
+			case c == '=' && last && j >= len(line)-2:
+				// padding
+			default:
+				return ""
+			}
+		}
+		total += len(line)
+	}
+
+	// plain words are made of the base64 alphabet too
+	if total < minDetectedBodyLength || total%4 != 0 || !hasDigitOrSymbol || !hasUpper || !hasLower {
+		return ""
+	}
+	if _, _, err := DecodeByContentEncoding(body, "base64"); err != nil {
+		return ""
+	}
+	return "base64"
+}
+
+// record the suggested transfer encoding of a leaf part without a real one
+func (c *Message) detectTransferEncoding() {
+	switch c.ContentTransferEncoding() {
+	case "", "7bit":
+	default:
+		return
+	}
+	body, err := c.rawBody()
+	if err != nil {
+		return
+	}
+	c.SuggestedEncoding = DetectTransferEncoding(body)
+}
+
+/**
+ * return the body decoded with the suggested transfer encoding; the body
+ * itself and the header are left unchanged
+ */
+func (c *Message) SuggestedDecodedBody() ([]byte, error) {
+	if c.SuggestedEncoding == "" {
+		return nil, fmt.Errorf("mailbuilder: part %q has no suggested transfer encoding", c.Idx)
+	}
+	body, err := c.rawBody()
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := DecodeByContentEncoding(body, c.SuggestedEncoding)
+	return data, err
+}
@@ -0,0 +1,70 @@
+package mailbuilder
+
+import (
+	"crypto"
+	"encoding/hex"
+)
+
+// the digest of the decoded content of a leaf part
+type PartDigest struct {
+	// part index in the message tree
+	Idx string
+
+	// lower case media type and decoded file name
+	ContentType string
+	Filename    string
+
+	// decoded size in bytes
+	Size int
+
+	// the digest of the decoded content
+	Digest []byte
+
+	// true when the body couldn't be decoded and the digest is over the encoded body
+	Encoded bool
+}
+
+// return the digest as lower case hex
+func (d PartDigest) Hex() string {
+	return hex.EncodeToString(d.Digest)
+}
+
+/**
+ * compute with h the digest of the decoded content (transfer encoding
+ * removed) of every leaf part, nested messages included; the hash function
+ * must be linked into the binary (crypto/sha256, ...), nil is returned
+ * otherwise
+ */
+func HashAttachments(m *Message, h crypto.Hash) []PartDigest {
+	if !h.Available() {
+		return nil
+	}
+
+	result := make([]PartDigest, 0)
+	m.Walk(func(p *Message) bool {
+		if p.IsMultipart() || p.IsRfc822() {
+			return true
+		}
+
+		data, err := p.DecodedBody()
+		encoded := err != nil
+		if encoded {
+			if data, err = p.rawBody(); err != nil {
+				return true
+			}
+		}
+		hash := h.New()
+		hash.Write(data)
+
+		result = append(result, PartDigest{
+			Idx:         p.Idx,
+			ContentType: p.MediaType(),
+			Filename:    p.Filename(),
+			Size:        len(data),
+			Digest:      hash.Sum(nil),
+			Encoded:     encoded,
+		})
+		return true
+	})
+	return result
+}
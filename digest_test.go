@@ -0,0 +1,83 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestHashAttachments(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Type: application/pdf; name=a.pdf\r\nContent-Transfer-Encoding: base64\r\n\r\naGVsbG8=\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\nSubject: inner\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n@@ not base64 ##\r\n" +
+		"--b--\r\n"
+	// sha256 of "hello"
+	const hello = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	tests := []struct {
+		idx         string
+		contentType string
+		filename    string
+		size        int
+		hex         string
+		encoded     bool
+	}{
+		{"1", "text/plain", "", 5, hello, false},
+		{"2", "application/pdf", "a.pdf", 5, hello, false},
+		{"3-0", "text/plain", "", 5, hello, false},
+		{"4", "text/plain", "", 16, "", true},
+	}
+
+	d := NewMessageDecomposer()
+	m, err := d.Decompose([]byte(raw), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := HashAttachments(m, crypto.SHA256)
+	if len(got) != len(tests) {
+		t.Fatalf("got %d digests, want %d: %+v", len(got), len(tests), got)
+	}
+	for i, tt := range tests {
+		g := got[i]
+		if g.Idx != tt.idx || g.ContentType != tt.contentType || g.Filename != tt.filename || g.Size != tt.size || g.Encoded != tt.encoded {
+			t.Errorf("digest %d: got %+v, want %+v", i, g, tt)
+		}
+		if tt.hex != "" && g.Hex() != tt.hex {
+			t.Errorf("digest %d: got %s, want %s", i, g.Hex(), tt.hex)
+		}
+	}
+
+	if got := HashAttachments(m, crypto.MD4); got != nil {
+		t.Errorf("got %d digests with an unavailable hash, want nil", len(got))
+	}
+}
+
+func TestHashAttachmentsStoredBody(t *testing.T) {
+	invalid := "@@ not base64 ## @@ not base64 ##"
+	tests := []struct {
+		name    string
+		body    string
+		data    string
+		encoded bool
+	}{
+		{"decoded", "aGVsbG8gd29ybGQsIGhlbGxvIHdvcmxk", "hello world, hello world", false},
+		{"raw fallback", invalid, invalid, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := decomposeStored(t, tt.body, "base64")
+			got := HashAttachments(m, crypto.SHA256)
+			if len(got) != 1 {
+				t.Fatalf("got %d digests, want 1", len(got))
+			}
+			want := sha256.Sum256([]byte(tt.data))
+			if got[0].Size != len(tt.data) || got[0].Encoded != tt.encoded || !bytes.Equal(got[0].Digest, want[:]) {
+				t.Errorf("got %+v, want size %d, encoded %v, digest %x", got[0], len(tt.data), tt.encoded, want)
+			}
+		})
+	}
+}
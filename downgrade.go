@@ -0,0 +1,165 @@
+package mailbuilder
+
+import (
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// headers holding address lists; their display names are encoded separately
+var addressHeaders = map[string]bool{
+	"From":     true,
+	"Sender":   true,
+	"Reply-To": true,
+	"To":       true,
+	"Cc":       true,
+	"Bcc":      true,
+}
+
+/**
+ * convert the message to 7bit so it can be relayed to servers that don't
+ * advertise 8BITMIME: 8bit/binary leaf parts are re-encoded as quoted-printable
+ * (mostly ascii text) or base64 and the non-ascii header values are encoded
+ * as RFC 2047 words
+ */
+func Downgrade8Bit(m *Message) {
+	m.Walk(func(p *Message) bool {
+		downgradeHeader(p)
+
+		encoding := p.ContentTransferEncoding()
+		if p.IsMultipart() || p.IsRfc822() {
+			// the children are downgraded so the container becomes 7bit
+			if encoding == "8bit" || encoding == "binary" {
+				p.SetHeaderField("Content-Transfer-Encoding", "7bit")
+			}
+			return true
+		}
+
+		switch encoding {
+		case "8bit", "binary", "", "7bit":
+		default:
+			// already encoded
+			return true
+		}
+
+		if (encoding == "" || encoding == "7bit") && !p.bodyHas8Bit() {
+			return true
+		}
+
+		// a body kept by a BodyStore is re-encoded in memory
+		body, err := p.rawBody()
+		if err != nil {
+			p.AddWarnings("body not downgraded: " + err.Error())
+			return true
+		}
+
+		newEncoding := "base64"
+		if strings.HasPrefix(p.MediaType(), "text/") && mostlyASCII(body) {
+			newEncoding = "quoted-printable"
+		}
+		p.SetHeaderField("Content-Transfer-Encoding", newEncoding)
+		p.SetDecodedBody(body)
+		return true
+	})
+}
+
+// encode the non-ascii header values of a message
+func downgradeHeader(m *Message) {
+	m.LoadHeader()
+	keys := make([]string, 0, len(m.Header))
+	for key := range m.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values := m.Header[key]
+		changed := false
+		for i, value := range values {
+			if !has8Bit([]byte(value)) {
+				continue
+			}
+			values[i] = encodeHeaderValue(key, value)
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if len(values) == 1 {
+			m.SetHeaderField(key, values[0])
+		} else {
+			m.HeaderIsChanged = true
+		}
+	}
+}
+
+// the header fields with a media type (or disposition) and parameters
+var parameterHeaders = map[string]bool{
+	"Content-Type":        true,
+	"Content-Disposition": true,
+}
+
+// encode a non-ascii header value
+func encodeHeaderValue(key, value string) string {
+	if parameterHeaders[textproto.CanonicalMIMEHeaderKey(key)] {
+		// the parameters are encoded following RFC 2231, not as words
+		if mediaType, params, err := mime.ParseMediaType(value); err == nil {
+			if formatted := mime.FormatMediaType(mediaType, params); formatted != "" {
+				return formatted
+			}
+		}
+	}
+	if addressHeaders[textproto.CanonicalMIMEHeaderKey(key)] {
+		if list, err := mail.ParseAddressList(value); err == nil {
+			encoded := make([]string, len(list))
+			for i, address := range list {
+				encoded[i] = address.String()
+			}
+			return strings.Join(encoded, ", ")
+		}
+	}
+	return encodeWords(value)
+}
+
+// encode only the runs of words containing non-ascii characters
+func encodeWords(value string) string {
+	words := strings.Split(value, " ")
+	result := make([]string, 0, len(words))
+	for i := 0; i < len(words); i++ {
+		if !has8Bit([]byte(words[i])) {
+			result = append(result, words[i])
+			continue
+		}
+		// adjacent non-ascii words form a single encoded run
+		j := i + 1
+		for j < len(words) && has8Bit([]byte(words[j])) {
+			j++
+		}
+		result = append(result, mime.QEncoding.Encode("utf-8", strings.Join(words[i:j], " ")))
+		i = j - 1
+	}
+	return strings.Join(result, " ")
+}
+
+// check if data contains bytes outside the 7bit range
+func has8Bit(data []byte) bool {
+	for _, b := range data {
+		if b >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// check if data is mostly ascii (quoted-printable stays readable and small)
+func mostlyASCII(data []byte) bool {
+	nonASCII := 0
+	for _, b := range data {
+		if b >= 0x80 || b == 0 {
+			nonASCII++
+		}
+	}
+	return nonASCII*10 <= len(data)
+}
@@ -0,0 +1,137 @@
+package mailbuilder
+
+import (
+	"mime"
+	"strings"
+	"testing"
+)
+
+func TestDowngrade8Bit(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		body     string
+		encoding string
+	}{
+		{"8bit text", "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit", "caf\xc3\xa9 au lait with two sugars, please", "quoted-printable"},
+		{"binary data", "Content-Type: application/octet-stream\r\nContent-Transfer-Encoding: binary", "\xff\xfe\x00\x01\x80\x81", "base64"},
+		{"unlabeled 8bit", "Content-Type: text/plain; charset=utf-8", "a na\xc3\xafve question about the schedule", "quoted-printable"},
+		{"mostly 8bit text", "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit", "\xd0\xbf\xd1\x80\xd0\xb8", "base64"},
+		{"7bit text", "Content-Type: text/plain\r\nContent-Transfer-Encoding: 7bit", "plain ascii", "7bit"},
+		{"already encoded", "Content-Type: text/plain\r\nContent-Transfer-Encoding: base64", "aGVsbG8=", "base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewMessageDecomposer()
+			m, err := d.Decompose([]byte(tt.header+"\r\n\r\n"+tt.body), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			Downgrade8Bit(m)
+
+			if got := m.ContentTransferEncoding(); got != tt.encoding {
+				t.Errorf("got encoding %q, want %q", got, tt.encoding)
+			}
+			if has8Bit(m.Body) {
+				t.Errorf("the body still has 8bit bytes: %q", m.Body)
+			}
+			decoded, _, err := DecodeByContentEncoding(m.Body, tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.body
+			if tt.name == "already encoded" {
+				want = "hello"
+			}
+			if string(decoded) != want {
+				t.Errorf("got decoded body %q, want %q", decoded, want)
+			}
+		})
+	}
+}
+
+func TestDowngrade8BitHeaders(t *testing.T) {
+	raw := "From: J\xc3\xa9r\xc3\xb4me <jerome@example.com>\r\n" +
+		"Subject: R\xc3\xa9sum\xc3\xa9 attached\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nvoil\xc3\xa0 the report of this week\r\n--b--\r\n"
+
+	d := NewMessageDecomposer()
+	m, err := d.Decompose([]byte(raw), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Downgrade8Bit(m)
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"Subject", "Résumé attached"},
+		{"From", "Jérôme <jerome@example.com>"},
+	}
+	dec := new(mime.WordDecoder)
+	for _, tt := range tests {
+		value := m.Header.Get(tt.field)
+		if has8Bit([]byte(value)) {
+			t.Errorf("%s: the value still has 8bit bytes: %q", tt.field, value)
+		}
+		got, err := dec.DecodeHeader(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.field, got, tt.want)
+		}
+	}
+
+	if got := m.ContentTransferEncoding(); got != "7bit" {
+		t.Errorf("got container encoding %q, want 7bit", got)
+	}
+	if got := m.Parts[0].ContentTransferEncoding(); !strings.EqualFold(got, "quoted-printable") {
+		t.Errorf("got part encoding %q, want quoted-printable", got)
+	}
+}
+
+func TestDowngrade8BitParameters(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"name", "Content-Type: application/pdf; name=\"r\xc3\xa9sum\xc3\xa9.pdf\""},
+		{"filename", "Content-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"r\xc3\xa9sum\xc3\xa9.pdf\""},
+		{"both", "Content-Type: application/pdf; name=\"r\xc3\xa9sum\xc3\xa9.pdf\"\r\nContent-Disposition: attachment; filename=\"r\xc3\xa9sum\xc3\xa9.pdf\"; size=3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n" + tt.header +
+				"\r\nContent-Description: le r\xc3\xa9sum\xc3\xa9\r\nContent-Transfer-Encoding: base64\r\n\r\nJVBE\r\n--b--\r\n"
+			d := NewMessageDecomposer()
+			m, err := d.Decompose([]byte(raw), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			Downgrade8Bit(m)
+
+			p := m.Parts[0]
+			for _, field := range []string{"Content-Type", "Content-Disposition", "Content-Description"} {
+				if value := p.Header.Get(field); has8Bit([]byte(value)) {
+					t.Errorf("%s: the value still has 8bit bytes: %q", field, value)
+				}
+			}
+			if got := p.Filename(); got != "résumé.pdf" {
+				t.Errorf("got filename %q, want %q", got, "résumé.pdf")
+			}
+			if p.MediaType() != "application/pdf" {
+				t.Errorf("got media type %q", p.MediaType())
+			}
+			dec := new(mime.WordDecoder)
+			if got, _ := dec.DecodeHeader(p.Header.Get("Content-Description")); got != "le résumé" {
+				t.Errorf("got description %q", got)
+			}
+		})
+	}
+}
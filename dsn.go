@@ -0,0 +1,382 @@
+package mailbuilder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"mime"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
+)
+
+var ErrNotDSN = errors.New("mailbuilder: not a delivery status notification")
+
+// a delivery status notification (RFC 3464)
+type DeliveryStatus struct {
+	// the per-message fields; the MTA names without their type ("dns;")
+	ReportingMTA       string
+	ReceivedFromMTA    string
+	OriginalEnvelopeID string
+	ArrivalDate        time.Time
+
+	Recipients []DSNRecipient
+
+	// the human readable explanation
+	Text string
+
+	// the returned message (message/rfc822) or only its header
+	// (text/rfc822-headers); nil if not returned
+	Original *Message
+}
+
+// the delivery status of a recipient
+type DSNRecipient struct {
+	// the addresses without their type ("rfc822;")
+	FinalRecipient    string
+	OriginalRecipient string
+
+	// failed, delayed, delivered, relayed or expanded
+	Action string
+
+	// the status code ("5.1.1")
+	Status string
+
+	// the MTA which gave the diagnostic and its reply ("550 5.1.1 user unknown"), without the type ("smtp;")
+	RemoteMTA      string
+	DiagnosticCode string
+
+	LastAttemptDate time.Time
+	WillRetryUntil  time.Time
+}
+
+// check if the delivery to the recipient failed (the message won't be delivered)
+func (r DSNRecipient) Failed() bool {
+	return strings.EqualFold(r.Action, "failed")
+}
+
+// media types of the delivery status part (RFC 3464, RFC 6533)
+var deliveryStatusMediaTypes = map[string]bool{
+	"message/delivery-status":        true,
+	"message/global-delivery-status": true,
+}
+
+// media types of the returned message or header part of a report
+var reportedMediaTypes = map[string]bool{
+	"text/rfc822-headers":    true,
+	"message/global-headers": true,
+	"message/rfc822":         true,
+	"message/global":         true,
+}
+
+/**
+ * parse a delivery status notification: the first multipart/report with
+ * report-type=delivery-status of the message; the recipients come from the
+ * delivery status part, the text from the first part and the original
+ * message from the returned message or header part
+ */
+func ParseDSN(m *Message) (*DeliveryStatus, error) {
+	report := findReport(m, "delivery-status")
+	if report == nil {
+		return nil, ErrNotDSN
+	}
+
+	ds := &DeliveryStatus{}
+	found := false
+	for i, p := range report.Parts {
+		switch mediaType := p.MediaType(); {
+		case i == 0 && strings.HasPrefix(mediaType, "text/"):
+			ds.Text, _ = p.DecodedText()
+
+		case deliveryStatusMediaTypes[mediaType]:
+			body, err := p.DecodedBody()
+			if err != nil {
+				return nil, err
+			}
+			groups := dsnFieldGroups(body)
+			if len(groups) == 0 {
+				return nil, ErrNotDSN
+			}
+			ds.ReportingMTA = dsnTypedValue(groups[0].Get("Reporting-MTA"))
+			ds.ReceivedFromMTA = dsnTypedValue(groups[0].Get("Received-From-MTA"))
+			ds.OriginalEnvelopeID = strings.TrimSpace(groups[0].Get("Original-Envelope-Id"))
+			ds.ArrivalDate, _ = ParseDate(groups[0].Get("Arrival-Date"))
+			for _, group := range groups[1:] {
+				ds.Recipients = append(ds.Recipients, parseDSNRecipient(group))
+			}
+			found = true
+
+		case p.IsRfc822() || reportedMediaTypes[mediaType]:
+			ds.Original = reportedMessage(p)
+		}
+	}
+	if !found {
+		return nil, ErrNotDSN
+	}
+	return ds, nil
+}
+
+// the first multipart/report of the message with the report type
+func findReport(m *Message, reportType string) *Message {
+	var report *Message
+	m.Walk(func(p *Message) bool {
+		if report != nil {
+			return false
+		}
+		_, params, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if err == nil && p.IsMultipart() && p.MediaType() == "multipart/report" && strings.EqualFold(params["report-type"], reportType) {
+			report = p
+		}
+		return true
+	})
+	return report
+}
+
+// decompose a returned message or header part (text/rfc822-headers, message/global-headers)
+func reportedMessage(p *Message) *Message {
+	if p.IsRfc822() {
+		return p.BodyMessage
+	}
+	body, err := p.DecodedBody()
+	if err != nil {
+		return nil
+	}
+	if !bytes.Contains(body, []byte("\n\n")) && !bytes.Contains(body, []byte("\n\r\n")) {
+		// the header alone can miss the blank line
+		body = append(append([]byte(nil), body...), "\r\n"...)
+	}
+	d := NewMessageDecomposer()
+	original, err := d.Decompose(body, p.Idx+"-0")
+	if err != nil {
+		return nil
+	}
+	return original
+}
+
+// the recipient fields of a delivery status group
+func parseDSNRecipient(group textproto.MIMEHeader) DSNRecipient {
+	r := DSNRecipient{
+		FinalRecipient:    dsnTypedValue(group.Get("Final-Recipient")),
+		OriginalRecipient: dsnTypedValue(group.Get("Original-Recipient")),
+		Action:            strings.ToLower(strings.TrimSpace(group.Get("Action"))),
+		Status:            strings.TrimSpace(group.Get("Status")),
+		RemoteMTA:         dsnTypedValue(group.Get("Remote-Mta")),
+		DiagnosticCode:    dsnTypedValue(group.Get("Diagnostic-Code")),
+	}
+	// the comment after the status code ("5.0.0 (permanent failure)")
+	if i := strings.IndexAny(r.Status, " \t("); i != -1 {
+		r.Status = r.Status[:i]
+	}
+	r.LastAttemptDate, _ = ParseDate(group.Get("Last-Attempt-Date"))
+	r.WillRetryUntil, _ = ParseDate(group.Get("Will-Retry-Until"))
+	return r
+}
+
+// the groups of fields separated by blank lines of a delivery status body
+func dsnFieldGroups(body []byte) []textproto.MIMEHeader {
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	var groups []textproto.MIMEHeader
+	for _, block := range bytes.Split(body, []byte("\n\n")) {
+		block = bytes.Trim(block, "\n")
+		if len(block) == 0 {
+			continue
+		}
+		r := mailtextproto.NewReader(bufio.NewReader(bytes.NewReader(append(block, "\n\n"...))))
+		header, _, err := r.ReadMIMEHeader()
+		if err != nil && len(header) == 0 {
+			continue
+		}
+		groups = append(groups, header)
+	}
+	return groups
+}
+
+// the value of a typed field ("rfc822; user@example.com") without the type
+func dsnTypedValue(value string) string {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexByte(value, ';'); i != -1 {
+		return strings.TrimSpace(value[i+1:])
+	}
+	return value
+}
+
+var (
+	ErrInvalidDSNRecipient = errors.New("mailbuilder: invalid DSN recipient (address, action or status)")
+
+	// a notification is never sent for a message with the null reverse path (RFC 3461 section 6.2)
+	ErrNoReturnPath = errors.New("mailbuilder: the message has no return path")
+)
+
+// the status codes of RFC 3463: class.subject.detail
+var dsnStatusRegexp = regexp.MustCompile(`^[245]\.\d{1,3}\.\d{1,3}$`)
+
+var dsnActions = map[string]bool{"failed": true, "delayed": true, "delivered": true, "relayed": true, "expanded": true}
+
+// options of NewDSN
+type DSNOptions struct {
+	// the MTA sending the notification (host name)
+	ReportingMTA string
+
+	// the sender of the notification, "MAILER-DAEMON@<ReportingMTA>" by default
+	From string
+
+	// the recipient of the notification, the reverse path of the message
+	// (SMTP envelope, Return-Path) by default
+	To string
+
+	// the human readable explanation; generated from the recipients by default
+	Text string
+
+	// the ENVID of the transaction and the time the message arrived (zero to omit)
+	OriginalEnvelopeID string
+	ArrivalDate        time.Time
+
+	// return the whole message (RET=FULL) instead of its header
+	ReturnFull bool
+}
+
+/**
+ * create a delivery status notification (RFC 3464) for orig: a
+ * multipart/report with the human readable text, the message/delivery-status
+ * part and the original message (ReturnFull) or its header
+ * (text/rfc822-headers); the recipients must have an address, an action
+ * and a status code
+ */
+func NewDSN(orig *Message, recipients []DSNRecipient, opts DSNOptions) (*Message, error) {
+	if len(recipients) == 0 {
+		return nil, ErrInvalidDSNRecipient
+	}
+	for _, r := range recipients {
+		if r.FinalRecipient == "" || !dsnActions[strings.ToLower(r.Action)] || !dsnStatusRegexp.MatchString(r.Status) {
+			return nil, ErrInvalidDSNRecipient
+		}
+	}
+
+	to := opts.To
+	if to == "" && orig.SMTPEnvelope != nil {
+		to = orig.SMTPEnvelope.MailFrom
+	}
+	if to == "" {
+		to = strings.Trim(strings.TrimSpace(orig.GetHeader("Return-Path")), "<>")
+	}
+	if to == "" {
+		return nil, ErrNoReturnPath
+	}
+	from := opts.From
+	if from == "" {
+		from = "MAILER-DAEMON@" + opts.ReportingMTA
+	}
+
+	m := NewMessage()
+	m.SetDate(time.Now())
+	m.SetHeaderField("From", from)
+	m.SetHeaderField("To", to)
+	m.SetHeaderField("Subject", "Delivery Status Notification ("+dsnOutcome(recipients)+")")
+	m.SetHeaderField("Message-ID", GenerateMessageID(opts.ReportingMTA))
+	m.SetHeaderField("Auto-Submitted", "auto-replied")
+	m.SetHeaderField("MIME-Version", "1.0")
+	m.setMultipartContentType("report", map[string]string{"report-type": "delivery-status"})
+
+	text := opts.Text
+	if text == "" {
+		text = dsnText(recipients, opts.ReportingMTA)
+	}
+	m.AddPart(NewTextPart(text))
+	m.AddPart(NewPart("message/delivery-status", dsnFields(recipients, opts), "7bit"))
+
+	if err := addReported(m, orig, opts.ReturnFull); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// add the original message (full) or its header (text/rfc822-headers) to a report
+func addReported(report, orig *Message, full bool) error {
+	if full {
+		_, err := AttachAsRFC822(report, orig)
+		return err
+	}
+	b := MessageBuilder{}
+	report.AddPart(NewPart("text/rfc822-headers", ConvertNewlines(b.headerBlock(orig), "\r\n"), "7bit"))
+	return nil
+}
+
+// Failure, Delay or Success from the worst action
+func dsnOutcome(recipients []DSNRecipient) string {
+	outcome := "Success"
+	for _, r := range recipients {
+		switch strings.ToLower(r.Action) {
+		case "failed":
+			return "Failure"
+		case "delayed":
+			outcome = "Delay"
+		}
+	}
+	return outcome
+}
+
+// the default human readable explanation
+func dsnText(recipients []DSNRecipient, reportingMTA string) string {
+	lines := []string{"This is the mail system at host " + reportingMTA + ".", ""}
+	for _, r := range recipients {
+		line := "<" + r.FinalRecipient + ">: "
+		switch strings.ToLower(r.Action) {
+		case "failed":
+			line += "the message could not be delivered"
+		case "delayed":
+			line += "the delivery is delayed, the mail system will keep trying"
+		case "delivered":
+			line += "the message was delivered"
+		case "relayed":
+			line += "the message was relayed to a system which doesn't send notifications"
+		case "expanded":
+			line += "the message was delivered to the members of the list"
+		}
+		if r.DiagnosticCode != "" {
+			line += " (" + r.DiagnosticCode + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// the body of the delivery status part: the per-message fields and a group for each recipient
+func dsnFields(recipients []DSNRecipient, opts DSNOptions) []byte {
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if value != "" {
+			b.WriteString(mailtextproto.FoldHeaderField(name, value, "\r\n") + "\r\n")
+		}
+	}
+
+	field("Reporting-MTA", "dns; "+opts.ReportingMTA)
+	field("Original-Envelope-Id", opts.OriginalEnvelopeID)
+	if !opts.ArrivalDate.IsZero() {
+		field("Arrival-Date", opts.ArrivalDate.Format(headerDateFormat))
+	}
+	for _, r := range recipients {
+		b.WriteString("\r\n")
+		if r.OriginalRecipient != "" {
+			field("Original-Recipient", "rfc822; "+r.OriginalRecipient)
+		}
+		field("Final-Recipient", "rfc822; "+r.FinalRecipient)
+		field("Action", strings.ToLower(r.Action))
+		field("Status", r.Status)
+		if r.RemoteMTA != "" {
+			field("Remote-MTA", "dns; "+r.RemoteMTA)
+		}
+		if r.DiagnosticCode != "" {
+			field("Diagnostic-Code", "smtp; "+r.DiagnosticCode)
+		}
+		if !r.LastAttemptDate.IsZero() {
+			field("Last-Attempt-Date", r.LastAttemptDate.Format(headerDateFormat))
+		}
+		if !r.WillRetryUntil.IsZero() {
+			field("Will-Retry-Until", r.WillRetryUntil.Format(headerDateFormat))
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,121 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+)
+
+// the encryption schemes reported by EncryptionInfo
+const (
+	EncryptionSMIME     = "S/MIME"
+	EncryptionPGPMIME   = "PGP/MIME"
+	EncryptionPGPInline = "PGP inline"
+)
+
+// the encryption of a message found from its structure and headers (nothing is decrypted)
+type EncryptionInfo struct {
+	// EncryptionSMIME, EncryptionPGPMIME, EncryptionPGPInline or "" if not encrypted
+	Scheme string
+
+	// the part holding the encrypted content (multipart/encrypted,
+	// application/pkcs7-mime or the text part with the armored PGP message)
+	Part *Message
+
+	// the lower case protocol parameter of multipart/encrypted and the
+	// smime-type parameter of application/pkcs7-mime (enveloped-data, authenveloped-data)
+	Protocol  string
+	SMIMEType string
+
+	// the keys advertised by the headers (Autocrypt, OpenPGP)
+	KeyHints []KeyHint
+}
+
+// a key advertised by a header field
+type KeyHint struct {
+	// Autocrypt or OpenPGP
+	Field string
+
+	Address string
+	KeyID   string
+	URL     string
+}
+
+// the armor line starting an inline PGP encrypted message
+var pgpMessageArmor = []byte("-----BEGIN PGP MESSAGE-----")
+
+// check if the message is encrypted
+func (e EncryptionInfo) Encrypted() bool {
+	return e.Scheme != ""
+}
+
+/**
+ * report if the message is encrypted: a multipart/encrypted (PGP/MIME), an
+ * application/pkcs7-mime enveloped-data (S/MIME) or a text body holding an
+ * armored PGP message, at the root or inside the multiparts (the attached
+ * messages are not searched); the key hints come from the root header
+ */
+func (c *Message) EncryptionInfo() EncryptionInfo {
+	info := EncryptionInfo{KeyHints: c.keyHints()}
+	c.Walk(func(p *Message) bool {
+		if info.Scheme != "" || (p.IsRfc822() && p != c) {
+			return false
+		}
+		_, params, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+
+		switch p.MediaType() {
+		case "multipart/encrypted":
+			info.Scheme, info.Part = EncryptionPGPMIME, p
+			info.Protocol = strings.ToLower(params["protocol"])
+			if info.Protocol != "" && info.Protocol != "application/pgp-encrypted" {
+				// another protocol in a multipart/encrypted
+				info.Scheme = info.Protocol
+			}
+			return false
+
+		case "application/pkcs7-mime", "application/x-pkcs7-mime":
+			smimeType := strings.ToLower(params["smime-type"])
+			name := strings.ToLower(p.Filename())
+			if smimeType == "enveloped-data" || smimeType == "authenveloped-data" || (smimeType == "" && strings.HasSuffix(name, ".p7m")) {
+				info.Scheme, info.Part, info.SMIMEType = EncryptionSMIME, p, smimeType
+			}
+			return false
+
+		case "text/plain":
+			if p.Disposition() != "attachment" {
+				if body, err := p.DecodedBody(); err == nil && bytes.HasPrefix(bytes.TrimLeft(body, " \t\r\n"), pgpMessageArmor) {
+					info.Scheme, info.Part = EncryptionPGPInline, p
+				}
+			}
+		}
+		return true
+	})
+	return info
+}
+
+// the keys advertised by the Autocrypt and OpenPGP header fields
+func (c *Message) keyHints() []KeyHint {
+	var hints []KeyHint
+	for _, field := range []string{"Autocrypt", "OpenPGP"} {
+		for _, value := range c.GetHeaderValues(field) {
+			hint := KeyHint{Field: field}
+			for _, attribute := range strings.Split(value, ";") {
+				name, attributeValue, found := strings.Cut(attribute, "=")
+				if !found {
+					continue
+				}
+				attributeValue = strings.Trim(strings.TrimSpace(attributeValue), `"`)
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "addr":
+					hint.Address = attributeValue
+				case "id":
+					hint.KeyID = attributeValue
+				case "url":
+					hint.URL = attributeValue
+				}
+			}
+			hints = append(hints, hint)
+		}
+	}
+	return hints
+}
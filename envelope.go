@@ -0,0 +1,98 @@
+package mailbuilder
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+)
+
+/**
+ * the commonly used parts of a message in decoded form: the address lists,
+ * the subject, the date, the text and html bodies and the attachments; the
+ * attached messages are attachments, their bodies are not used
+ */
+type Envelope struct {
+	From    []*mail.Address
+	To      []*mail.Address
+	Cc      []*mail.Address
+	Bcc     []*mail.Address
+	ReplyTo []*mail.Address
+
+	Subject string
+
+	// zero if the message has no valid Date
+	Date time.Time
+
+	// decoded bodies ("" if the message has none)
+	Text string
+	HTML string
+
+	Attachments []AttachmentInfo
+
+	// the decomposed message
+	Message *Message
+}
+
+// decompose a raw message and return its envelope
+func ParseEnvelope(raw []byte) (*Envelope, error) {
+	d := NewMessageDecomposer()
+	m, err := d.Decompose(raw, "")
+	if err != nil {
+		return nil, err
+	}
+	return m.Envelope(), nil
+}
+
+/**
+ * return the envelope of the message; the invalid address lists are empty
+ * and a body which can't be decoded is ""
+ */
+func (c *Message) Envelope() *Envelope {
+	e := &Envelope{
+		From:        envelopeAddresses(c.GetHeader("From")),
+		To:          envelopeAddresses(c.GetHeader("To")),
+		Cc:          envelopeAddresses(c.GetHeader("Cc")),
+		Bcc:         envelopeAddresses(c.GetHeader("Bcc")),
+		ReplyTo:     envelopeAddresses(c.GetHeader("Reply-To")),
+		Subject:     strings.TrimSpace(decodeHeaderWords(c.GetHeader("Subject"))),
+		Attachments: c.Attachments(),
+		Message:     c,
+	}
+	if date, ok := c.Date(); ok {
+		e.Date = date
+	}
+	if p := c.envelopeBody("text/plain"); p != nil {
+		e.Text, _ = p.DecodedText()
+	}
+	if p := c.envelopeBody("text/html"); p != nil {
+		e.HTML, _ = p.DecodedText()
+	}
+	return e
+}
+
+// the first body part of the given media type outside the attachments
+func (c *Message) envelopeBody(mediaType string) *Message {
+	var found *Message
+	c.Walk(func(p *Message) bool {
+		if found != nil || p.IsAttachment() {
+			return false
+		}
+		if p.isTextLeaf() && p.MediaType() == mediaType && p.Disposition() != "attachment" {
+			found = p
+		}
+		return true
+	})
+	return found
+}
+
+// parse an address list header value, nil if missing or invalid
+func envelopeAddresses(value string) []*mail.Address {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	list, err := mail.ParseAddressList(value)
+	if err != nil {
+		return nil
+	}
+	return list
+}
@@ -0,0 +1,111 @@
+package mailbuilder
+
+import (
+	"context"
+	"io/ioutil"
+)
+
+/**
+ * return the size of the built message (see MessageBuilder.EstimateSize)
+ * with the default builder
+ */
+func EstimateSize(m *Message) int64 {
+	b := NewMessageBuilder()
+	return b.EstimateSize(m)
+}
+
+/**
+ * return the size of the message Build would write (header folding,
+ * transfer encodings, boundaries and builder options included) without
+ * building it: only the headers are formatted; the decoded message/rfc822
+ * parts are built alone since their encoding depends on their content;
+ * used to enforce a SIZE limit before an expensive build
+ */
+func (c *MessageBuilder) EstimateSize(m *Message) int64 {
+	return c.size(c.withSafeBoundaries(c.prepare(m)))
+}
+
+// the size of a message or part of a tree with checked boundaries (see build)
+func (c *MessageBuilder) size(m *Message) int64 {
+	buff := getBuffer()
+	defer putBuffer(buff)
+	c.writeHeader(buff, m)
+	return int64(buff.Len()) + c.bodySize(m)
+}
+
+// the size of the body of a message or part (see bodyBlock and BuildBody)
+func (c *MessageBuilder) bodySize(m *Message) int64 {
+	if m.IsDecoded {
+		// written back raw or encoded again depending on the content
+		body, _ := c.encodedBody(context.Background(), m)
+		return int64(len(body))
+	}
+
+	var size int64
+	if m.IsRfc822() {
+		size += c.size(m.BodyMessage)
+	} else if len(m.Body) > 0 {
+		if m.ContentTransferEncoding() == "binary" {
+			size += int64(len(m.Body))
+		} else {
+			size += c.layoutSize(m, m.Body)
+		}
+	} else if m.IsBodyStored() {
+		if m.ContentTransferEncoding() == "binary" || !c.normalizeNewlines {
+			size += m.storedBody.Size()
+		} else if body, err := ioutil.ReadAll(m.BodyReader()); err == nil {
+			size += c.layoutSize(m, body)
+		}
+	}
+
+	if m.IsMultipart() {
+		nl := int64(len(c.newlineFor(m)))
+		boundary := int64(len(m.Boundary))
+		size += c.layoutSize(m, m.Preamble)
+
+		for idx, part := range m.Parts {
+			if c.stripResourceForks {
+				if ad := part.AppleDouble(); ad != nil {
+					part = ad.namedDataFork()
+				}
+			}
+			if isRawDelimiter(part.RawDelimiter, m.Boundary, false) {
+				size += c.layoutSize(m, part.RawDelimiter)
+			} else {
+				if idx > 0 {
+					size += nl
+				}
+				size += nl + 2 + boundary + nl
+			}
+			size += c.size(part)
+		}
+		if isRawDelimiter(m.RawCloseDelimiter, m.Boundary, true) {
+			size += c.layoutSize(m, m.RawCloseDelimiter)
+		} else {
+			size += nl + 2 + boundary + 2 + nl
+		}
+		size += c.layoutSize(m, m.Epilogue)
+	}
+	return size
+}
+
+// the length of layoutBytes(m, raw) without converting the line endings
+func (c *MessageBuilder) layoutSize(m *Message, raw []byte) int64 {
+	if !c.normalizeNewlines || len(raw) == 0 {
+		return int64(len(raw))
+	}
+	nl := int64(len(c.newlineFor(m)))
+	var size int64
+	for i := 0; i < len(raw); i++ {
+		switch {
+		case raw[i] == '\r' && i+1 < len(raw) && raw[i+1] == '\n':
+			size += nl
+			i++
+		case raw[i] == '\n':
+			size += nl
+		default:
+			size++
+		}
+	}
+	return size
+}
@@ -0,0 +1,92 @@
+package mailbuilder
+
+import (
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RFC 5322 date format used when setting date headers
+const headerDateFormat = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+/**
+ * return the expiration date of the message from Expiry-Date (RFC 4021)
+ * or from the older Expires header
+ */
+func (c *Message) ExpiryDate() (time.Time, bool) {
+	for _, field := range []string{"Expiry-Date", "Expires"} {
+		if value := strings.TrimSpace(c.GetHeader(field)); value != "" {
+			if t, err := mail.ParseDate(value); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// set the Expiry-Date header
+func (c *Message) SetExpiryDate(t time.Time) {
+	c.SetHeaderField("Expiry-Date", t.Format(headerDateFormat))
+}
+
+/**
+ * return the date when the message can be deleted from X-Auto-Delete-After;
+ * the value is a date or a delay relative to the Date header: a number of
+ * days ("30"), or a number followed by d, h or m ("30d", "12h")
+ */
+func (c *Message) AutoDeleteAfter() (time.Time, bool) {
+	value := strings.TrimSpace(c.GetHeader("X-Auto-Delete-After"))
+	if value == "" {
+		return time.Time{}, false
+	}
+	if t, err := mail.ParseDate(value); err == nil {
+		return t, true
+	}
+
+	delay, ok := parseRetentionDelay(value)
+	if !ok {
+		return time.Time{}, false
+	}
+	date, err := mail.ParseDate(strings.TrimSpace(c.GetHeader("Date")))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date.Add(delay), true
+}
+
+// set the X-Auto-Delete-After header to a date
+func (c *Message) SetAutoDeleteAfter(t time.Time) {
+	c.SetHeaderField("X-Auto-Delete-After", t.Format(headerDateFormat))
+}
+
+// check if the message is expired or can be deleted at the given time
+func (c *Message) IsExpired(now time.Time) bool {
+	if t, ok := c.ExpiryDate(); ok && !now.Before(t) {
+		return true
+	}
+	if t, ok := c.AutoDeleteAfter(); ok && !now.Before(t) {
+		return true
+	}
+	return false
+}
+
+// parse a retention delay: days or a number followed by d, h or m
+func parseRetentionDelay(value string) (time.Duration, bool) {
+	unit := 24 * time.Hour
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "d":
+		value = value[:len(value)-1]
+	case "h":
+		unit = time.Hour
+		value = value[:len(value)-1]
+	case "m":
+		unit = time.Minute
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
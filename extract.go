@@ -0,0 +1,136 @@
+package mailbuilder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// an attachment written by ExtractAttachments
+type ExtractedAttachment struct {
+	// part index in the message tree
+	Idx string
+
+	// the name given to the writer (sanitized and unique in the manifest)
+	Name string
+
+	// decoded size in bytes
+	Size int
+
+	// lower case media type
+	ContentType string
+
+	// hex encoded sha256 of the decoded content
+	SHA256 string
+}
+
+/**
+ * decode every attachment (transfer encoding and file name) and write it with
+ * a writer returned by create; an attached message is written whole as .eml;
+ * the names are sanitized (no directories) and made unique; returns the
+ * manifest of the written attachments and the first error
+ */
+func ExtractAttachments(m *Message, create func(name string) (io.WriteCloser, error)) ([]ExtractedAttachment, error) {
+	manifest := make([]ExtractedAttachment, 0)
+	names := make(map[string]bool)
+
+	var err error
+	m.Walk(func(p *Message) bool {
+		if err != nil {
+			return false
+		}
+		if p.Parent == nil || !p.IsAttachment() {
+			return true
+		}
+
+		var data []byte
+		if p.BodyMessage != nil {
+			b := MessageBuilder{}
+			data = b.Build(p.BodyMessage)
+		} else if data, err = p.DecodedBody(); err != nil {
+			return false
+		}
+
+		name := uniqueName(attachmentFileName(p), names)
+		names[strings.ToLower(name)] = true
+
+		var w io.WriteCloser
+		if w, err = create(name); err != nil {
+			return false
+		}
+		_, err = w.Write(data)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return false
+		}
+
+		sum := sha256.Sum256(data)
+		manifest = append(manifest, ExtractedAttachment{
+			Idx:         p.Idx,
+			Name:        name,
+			Size:        len(data),
+			ContentType: p.MediaType(),
+			SHA256:      hex.EncodeToString(sum[:]),
+		})
+		// the attached message is written whole
+		return false
+	})
+	return manifest, err
+}
+
+// return a create function for ExtractAttachments writing the files in dir
+func DirWriter(dir string) func(name string) (io.WriteCloser, error) {
+	return func(name string) (io.WriteCloser, error) {
+		return os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+}
+
+// the file name of an attachment without directories and control characters
+func attachmentFileName(p *Message) string {
+	name := strings.ReplaceAll(p.Filename(), "\\", "/")
+	name = path.Base(name)
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	if name == "" || name == "." || name == ".." || name == "/" {
+		name = "attachment-" + p.Idx
+		if p.BodyMessage != nil || p.MediaType() == "message/rfc822" {
+			name += ".eml"
+		} else if extensions, _ := mime.ExtensionsByType(p.MediaType()); len(extensions) > 0 {
+			name += extensions[0]
+		}
+	}
+	return name
+}
+
+/**
+ * add a counter to name ("invoice (2).pdf") while it is already used; used
+ * is keyed by the lower case names since the file systems may ignore the
+ * case
+ */
+func uniqueName(name string, used map[string]bool) string {
+	if !used[strings.ToLower(name)] {
+		return name
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := base + " (" + strconv.Itoa(i) + ")" + ext
+		if !used[strings.ToLower(candidate)] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractAttachments(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nthe body\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"../../etc/report.pdf\"\r\nContent-Transfer-Encoding: base64\r\n\r\nJVBERi0xLjQ=\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"C:\\\\docs\\\\report.pdf\"\r\n\r\nsecond\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"Report.PDF\"\r\n\r\nthird\r\n" +
+		"--b\r\nContent-Type: application/x-unnamed-test\r\nContent-Disposition: attachment\r\n\r\nno name\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment\r\n\r\nSubject: inner\r\n\r\ninner body\r\n" +
+		"--b--\r\n"
+
+	tests := []struct {
+		idx  string
+		name string
+		data string
+	}{
+		{"2", "report.pdf", "%PDF-1.4"},
+		{"3", "report (2).pdf", "second"},
+		{"4", "Report (3).PDF", "third"},
+		{"5", "attachment-5", "no name"},
+		{"6", "attachment-6.eml", "Subject: inner\r\n\r\ninner body"},
+	}
+
+	d := NewMessageDecomposer()
+	m, err := d.Decompose([]byte(raw), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	manifest, err := ExtractAttachments(m, DirWriter(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest) != len(tests) {
+		t.Fatalf("got %d attachments, want %d: %+v", len(manifest), len(tests), manifest)
+	}
+	for i, tt := range tests {
+		got := manifest[i]
+		if got.Idx != tt.idx || got.Name != tt.name || got.Size != len(tt.data) {
+			t.Errorf("attachment %d: got %s %q %d, want %s %q %d", i, got.Idx, got.Name, got.Size, tt.idx, tt.name, len(tt.data))
+		}
+		data, err := os.ReadFile(filepath.Join(dir, tt.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, []byte(tt.data)) {
+			t.Errorf("%s: got %q, want %q", tt.name, data, tt.data)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package mailbuilder
+
+import (
+	"html"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// options of NewForward
+type ForwardOptions struct {
+	// the sender and the recipients of the forward
+	From string
+	To   []string
+	Cc   []string
+
+	// the note written above the forwarded message (text and optional html)
+	Text string
+	HTML string
+}
+
+// a subject already marked as a forward: "Fwd:", "FW:"
+var forwardSubjectRegexp = regexp.MustCompile(`(?i)^\s*(fwd?|wg)\s*:`)
+
+/**
+ * create an inline forward of orig: the subject gets the "Fwd: " prefix
+ * if it has none, the body is the note followed by a summary of the
+ * original header (From, Date, Subject, To, Cc) and the original text
+ * (and html when the original or the note has one); the attachments of
+ * orig are carried over unchanged, the inline images referenced by the
+ * html stay with it (multipart/related); the invalid addresses are skipped
+ */
+func NewForward(orig *Message, opts ForwardOptions) *Message {
+	m := NewMessage()
+	m.SetDate(time.Now())
+
+	domain := "localhost"
+	if from, err := mail.ParseAddress(opts.From); err == nil {
+		m.SetHeaderField("From", from.String())
+		domain = addressDomain(from.Address)
+	}
+	for _, field := range []struct {
+		name      string
+		addresses []string
+	}{{"To", opts.To}, {"Cc", opts.Cc}} {
+		formatted := make([]string, 0, len(field.addresses))
+		for _, address := range field.addresses {
+			if list, err := mail.ParseAddressList(address); err == nil {
+				for _, a := range list {
+					formatted = append(formatted, a.String())
+				}
+			}
+		}
+		if len(formatted) > 0 {
+			m.SetHeaderField(field.name, strings.Join(formatted, ", "))
+		}
+	}
+
+	subject := strings.TrimSpace(decodeHeaderWords(orig.GetHeader("Subject")))
+	if !forwardSubjectRegexp.MatchString(subject) {
+		subject = "Fwd: " + subject
+	}
+	m.SetHeaderField("Subject", encodeWords(subject))
+	m.SetHeaderField("Message-ID", GenerateMessageID(domain))
+	m.SetHeaderField("MIME-Version", "1.0")
+
+	spec := MessageSpec{}
+	spec.Text, spec.HTML = forwardedBody(orig, opts.Text, opts.HTML)
+
+	// the inline images go with the html, the other attachments are copied as they are
+	var attachments []*Message
+	for _, a := range orig.Attachments() {
+		p := a.Part
+		if spec.HTML != "" && a.ContentID != "" && a.Disposition != "attachment" && !p.IsRfc822() {
+			if data, err := p.DecodedBody(); err == nil {
+				spec.Attachments = append(spec.Attachments, AttachmentSpec{
+					Filename:    attachmentFileName(p),
+					ContentType: p.Header.Get("Content-Type"),
+					Content:     data,
+					ContentID:   a.ContentID,
+					Inline:      true,
+				})
+				continue
+			}
+		}
+		attachments = append(attachments, p)
+	}
+
+	content, err := spec.content()
+	if err != nil {
+		// an inline image which can't be written again: send the text alone
+		spec.Attachments = nil
+		content, _ = spec.content()
+	}
+	if len(attachments) > 0 {
+		if content.MediaType() != "multipart/mixed" {
+			mixed := NewMultipart("mixed", nil)
+			mixed.AddPart(content)
+			content = mixed
+		}
+		for _, p := range attachments {
+			content.AddPart(copyPart(p, content.newPartIdx()))
+		}
+	}
+	adoptContent(m, content)
+	return m
+}
+
+// a copy of a part with the same bytes (header and encoded body)
+func copyPart(p *Message, idx string) *Message {
+	b := MessageBuilder{}
+	d := NewMessageDecomposer()
+	clone, err := d.Decompose(b.build(p), idx)
+	if err != nil {
+		// the part was decomposed once so this doesn't happen
+		return p
+	}
+	return clone
+}
+
+// the note followed by the summary of the original header and the original body
+func forwardedBody(orig *Message, text, htmlText string) (string, string) {
+	summary := []string{"---------- Forwarded message ----------"}
+	for _, field := range []string{"From", "Date", "Subject", "To", "Cc"} {
+		if value := strings.TrimSpace(decodeHeaderWords(orig.GetHeader(field))); value != "" {
+			summary = append(summary, field+": "+value)
+		}
+	}
+
+	var originalText string
+	if p := orig.envelopeBody("text/plain"); p != nil {
+		originalText, _ = p.DecodedText()
+	} else if p := orig.envelopeBody("text/html"); p != nil {
+		originalText, _ = p.readableText()
+	}
+	originalText = strings.ReplaceAll(originalText, "\r\n", "\n")
+
+	note := strings.TrimRight(text, "\r\n")
+	if note != "" {
+		note += "\n\n"
+	}
+	text = note + strings.Join(summary, "\n") + "\n\n" + originalText
+
+	originalHTML := orig.envelopeBody("text/html")
+	if htmlText == "" && originalHTML == nil {
+		return text, ""
+	}
+	var body string
+	if originalHTML != nil {
+		document, _ := originalHTML.DecodedText()
+		body = htmlBodyContent(document)
+	} else {
+		body = "<pre>" + html.EscapeString(originalText) + "</pre>"
+	}
+	escaped := make([]string, len(summary))
+	for i, line := range summary {
+		escaped[i] = html.EscapeString(line)
+	}
+	forwarded := "<div>" + strings.Join(escaped, "<br>\n") + "</div>\n<br>\n" + body
+
+	if locs := htmlBodyCloseRegexp.FindAllStringIndex(htmlText, -1); locs != nil {
+		offset := locs[len(locs)-1][0]
+		return text, htmlText[:offset] + forwarded + "\n" + htmlText[offset:]
+	}
+	if htmlText != "" {
+		htmlText += "\n"
+	}
+	return text, htmlText + forwarded
+}
@@ -0,0 +1,232 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/**
+ * developer utility to find why a DKIM signature broke after a rebuild: the
+ * header fields of the original and of the rebuilt message are paired by
+ * name and occurrence (counted from the bottom, the order used by DKIM to
+ * select the signed fields) and compared in their simple and relaxed
+ * canonical forms (RFC 6376 section 3.4)
+ */
+
+// a header field which differs between the original and the rebuilt message
+type HeaderDiff struct {
+	// field name as found in the original message (or in the rebuilt one if added)
+	Name string
+
+	// occurrence of the field counted from the bottom of the header (0 is the last one)
+	Occurrence int
+
+	// the raw fields (with folds and line ending); nil if the field is missing
+	Original []byte
+	Rebuilt  []byte
+
+	// offset of the first different byte of the canonical forms; -1 when equal
+	SimpleOffset  int
+	RelaxedOffset int
+}
+
+// a raw header field
+type rawHeaderField struct {
+	name string
+	raw  []byte
+}
+
+/**
+ * return the header fields which differ between the original and the rebuilt
+ * message in any of the DKIM canonical forms; the fields missing on one of
+ * the sides are reported too
+ */
+func DiffHeaders(original, rebuilt []byte) []HeaderDiff {
+	originalFields := rawHeaderFields(original)
+	rebuiltFields := rawHeaderFields(rebuilt)
+
+	result := make([]HeaderDiff, 0)
+	paired := make(map[int]bool)
+	for i, field := range originalFields {
+		occurrence := fieldOccurrence(originalFields, i)
+		diff := HeaderDiff{Name: field.name, Occurrence: occurrence, Original: field.raw}
+		if j := findFieldOccurrence(rebuiltFields, field.name, occurrence); j != -1 {
+			paired[j] = true
+			diff.Rebuilt = rebuiltFields[j].raw
+		}
+		if diff.compare() {
+			result = append(result, diff)
+		}
+	}
+	for j, field := range rebuiltFields {
+		if paired[j] {
+			continue
+		}
+		diff := HeaderDiff{Name: field.name, Occurrence: fieldOccurrence(rebuiltFields, j), Rebuilt: field.raw}
+		diff.compare()
+		result = append(result, diff)
+	}
+	return result
+}
+
+// fill the offsets; returns true if the field differs
+func (d *HeaderDiff) compare() bool {
+	d.SimpleOffset = diffOffset(CanonicalizeHeaderSimple(d.Original), CanonicalizeHeaderSimple(d.Rebuilt))
+	d.RelaxedOffset = diffOffset(CanonicalizeHeaderRelaxed(d.Original), CanonicalizeHeaderRelaxed(d.Rebuilt))
+	if d.Original == nil || d.Rebuilt == nil {
+		return true
+	}
+	return d.SimpleOffset != -1 || d.RelaxedOffset != -1
+}
+
+/**
+ * print the header fields which differ between the original and the rebuilt
+ * message, with their canonical forms and the offset of the first different
+ * byte; nothing is printed when the headers are equivalent
+ */
+func PrintHeaderDiff(w io.Writer, original, rebuilt []byte) error {
+	for _, d := range DiffHeaders(original, rebuilt) {
+		var err error
+		switch {
+		case d.Rebuilt == nil:
+			_, err = fmt.Fprintf(w, "%s[%d]: removed\n  - %q\n", d.Name, d.Occurrence, d.Original)
+		case d.Original == nil:
+			_, err = fmt.Fprintf(w, "%s[%d]: added\n  + %q\n", d.Name, d.Occurrence, d.Rebuilt)
+		default:
+			_, err = fmt.Fprintf(w, "%s[%d]: simple %s, relaxed %s\n  - simple:  %q\n  + simple:  %q\n",
+				d.Name, d.Occurrence, describeOffset(d.SimpleOffset), describeOffset(d.RelaxedOffset),
+				CanonicalizeHeaderSimple(d.Original), CanonicalizeHeaderSimple(d.Rebuilt))
+			if err == nil && d.RelaxedOffset != -1 {
+				_, err = fmt.Fprintf(w, "  - relaxed: %q\n  + relaxed: %q\n",
+					CanonicalizeHeaderRelaxed(d.Original), CanonicalizeHeaderRelaxed(d.Rebuilt))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeOffset(offset int) string {
+	if offset == -1 {
+		return "equal"
+	}
+	return fmt.Sprintf("differs at byte %d", offset)
+}
+
+// the "simple" canonical form of a raw header field: unchanged, with CRLF line endings
+func CanonicalizeHeaderSimple(field []byte) []byte {
+	if field == nil {
+		return nil
+	}
+	field = ConvertNewlines(field, "\r\n")
+	if !bytes.HasSuffix(field, []byte("\r\n")) {
+		field = append(field, "\r\n"...)
+	}
+	return field
+}
+
+/**
+ * the "relaxed" canonical form of a raw header field: lower case name,
+ * unfolded value, whitespace runs reduced to one space and removed around
+ * the colon and at the end
+ */
+func CanonicalizeHeaderRelaxed(field []byte) []byte {
+	if field == nil {
+		return nil
+	}
+	colon := bytes.IndexByte(field, ':')
+	if colon == -1 {
+		return CanonicalizeHeaderSimple(field)
+	}
+
+	name := strings.ToLower(strings.TrimRight(string(field[:colon]), " \t"))
+	value := strings.NewReplacer("\r\n", "", "\n", "").Replace(string(field[colon+1:]))
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte(':')
+	space := false
+	for i := 0; i < len(value); i++ {
+		if value[i] == ' ' || value[i] == '\t' {
+			space = true
+			continue
+		}
+		if space && b.Len() > len(name)+1 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteByte(value[i])
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// split the header of a raw message in fields, each with its folds and line ending
+func rawHeaderFields(message []byte) []rawHeaderField {
+	fields := make([]rawHeaderField, 0)
+	for pos := 0; pos < len(message); {
+		next := len(message)
+		if i := bytes.IndexByte(message[pos:], '\n'); i != -1 {
+			next = pos + i + 1
+		}
+		line := message[pos:next]
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			// the blank line ends the header
+			break
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			last := &fields[len(fields)-1]
+			last.raw = message[pos-len(last.raw) : next]
+		} else {
+			name := string(line)
+			if i := strings.IndexByte(name, ':'); i != -1 {
+				name = name[:i]
+			}
+			fields = append(fields, rawHeaderField{name: strings.TrimRight(name, " \t\r\n"), raw: line})
+		}
+		pos = next
+	}
+	return fields
+}
+
+// the occurrence of fields[i] among the fields with the same name, counted from the bottom
+func fieldOccurrence(fields []rawHeaderField, i int) int {
+	occurrence := 0
+	for j := i + 1; j < len(fields); j++ {
+		if strings.EqualFold(fields[j].name, fields[i].name) {
+			occurrence++
+		}
+	}
+	return occurrence
+}
+
+// return the index of the field with the name and occurrence or -1
+func findFieldOccurrence(fields []rawHeaderField, name string, occurrence int) int {
+	for j := len(fields) - 1; j >= 0; j-- {
+		if !strings.EqualFold(fields[j].name, name) {
+			continue
+		}
+		if occurrence == 0 {
+			return j
+		}
+		occurrence--
+	}
+	return -1
+}
+
+// offset of the first different byte or -1 if a and b are equal
+func diffOffset(a, b []byte) int {
+	offset := 0
+	for offset < len(a) && offset < len(b) && a[offset] == b[offset] {
+		offset++
+	}
+	if offset == len(a) && offset == len(b) {
+		return -1
+	}
+	return offset
+}
@@ -0,0 +1,159 @@
+package mailbuilder
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/textproto"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
+)
+
+/**
+ * read only the top level header of a message and keep the given fields
+ * (all of them if none is given); the body is never read
+ */
+func ReadHeaderFields(r io.Reader, fields ...string) (textproto.MIMEHeader, error) {
+	wanted := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		wanted[textproto.CanonicalMIMEHeaderKey(field)] = true
+	}
+
+	header := make(textproto.MIMEHeader, len(fields))
+	tp := mailtextproto.NewReader(bufio.NewReader(r))
+	for {
+		line, _, err := tp.ReadContinuedLineBytes()
+		if len(line) == 0 {
+			if err == io.EOF {
+				err = nil
+			}
+			return header, err
+		}
+
+		if i := bytes.IndexByte(line, ':'); i > 0 {
+			key := textproto.CanonicalMIMEHeaderKey(string(bytes.TrimRight(line[:i], " \t")))
+			if len(wanted) == 0 || wanted[key] {
+				header.Add(key, string(bytes.TrimLeft(line[i+1:], " \t")))
+			}
+		}
+
+		if err == io.EOF {
+			return header, nil
+		}
+		if err != nil {
+			return header, err
+		}
+	}
+}
+
+// a message given to a HeaderExtractor
+type HeaderJob struct {
+	// identifier returned with the result (a file name, a store key, ...)
+	ID string
+
+	// the raw message; when nil the message is read with Open
+	Raw  []byte
+	Open func() (io.ReadCloser, error)
+}
+
+// the header fields extracted from a message
+type HeaderResult struct {
+	ID     string
+	Header textproto.MIMEHeader
+	Err    error
+}
+
+/**
+ * extract header fields from batches of messages concurrently, for log
+ * enrichment or backfill jobs over large mail stores; only the headers of
+ * the messages are read
+ */
+type HeaderExtractor struct {
+	// the extracted fields; all the fields if empty
+	Fields []string
+
+	// number of concurrent workers; the number of CPUs if <= 0
+	Workers int
+}
+
+func NewHeaderExtractor(fields []string, workers int) *HeaderExtractor {
+	return &HeaderExtractor{Fields: fields, Workers: workers}
+}
+
+/**
+ * process the jobs until the channel is closed; the results are sent as
+ * soon as they are ready (not in the order of the jobs) and the returned
+ * channel is closed after the last one
+ */
+func (e *HeaderExtractor) Process(jobs <-chan HeaderJob) <-chan HeaderResult {
+	workers := e.workers()
+
+	results := make(chan HeaderResult, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- e.extract(job)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// extract the headers of raw messages; the results have the order of messages
+func (e *HeaderExtractor) Extract(messages [][]byte) []HeaderResult {
+	results := make([]HeaderResult, len(messages))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				results[idx] = e.extract(HeaderJob{ID: strconv.Itoa(idx), Raw: messages[idx]})
+			}
+		}()
+	}
+	for idx := range messages {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// return the number of workers to start
+func (e *HeaderExtractor) workers() int {
+	if e.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return e.Workers
+}
+
+// extract the header fields of one message
+func (e *HeaderExtractor) extract(job HeaderJob) HeaderResult {
+	result := HeaderResult{ID: job.ID}
+	if job.Raw != nil || job.Open == nil {
+		result.Header, result.Err = ReadHeaderFields(bytes.NewReader(job.Raw), e.Fields...)
+		return result
+	}
+
+	rc, err := job.Open()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer rc.Close()
+	result.Header, result.Err = ReadHeaderFields(rc, e.Fields...)
+	return result
+}
@@ -0,0 +1,93 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+)
+
+// a problem of the header found by ValidateHeaders
+type Violation struct {
+	// the field name ("" for a problem of the whole header)
+	Field string
+
+	Problem string
+}
+
+func (v Violation) String() string {
+	if v.Field == "" {
+		return v.Problem
+	}
+	return v.Field + ": " + v.Problem
+}
+
+// the fields which can appear at most once (RFC 5322 section 3.6)
+var singleFields = []string{"From", "Sender", "Reply-To", "To", "Cc", "Bcc", "Subject", "Date", "Message-Id", "In-Reply-To", "References"}
+
+// the fields every message must have
+var mandatoryFields = []string{"From", "Date"}
+
+// the length limit of a header line without the line ending (RFC 5322 section 2.1.1)
+const maxHeaderLineLength = 998
+
+/**
+ * check the header of the message (the root) before submission: the fields
+ * present more than once which can appear once, the missing From and
+ * Date, the field names with illegal characters, the values with
+ * unencoded 8-bit characters (not RFC 2047 encoded) and the lines longer
+ * than 998 characters as they would be written; returns nil for a valid header
+ */
+func ValidateHeaders(m *Message) []Violation {
+	var violations []Violation
+	m.LoadHeader()
+
+	for _, field := range singleFields {
+		if n := len(m.Header[field]); n > 1 {
+			violations = append(violations, Violation{Field: field, Problem: fmt.Sprintf("present %d times", n)})
+		}
+	}
+	for _, field := range mandatoryFields {
+		if len(m.Header[field]) == 0 {
+			violations = append(violations, Violation{Field: field, Problem: "missing"})
+		}
+	}
+
+	seen := make(map[string]bool)
+	m.rangeHeaders(func(name, value string) bool {
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		if !isValidFieldName(name) && !seen["name:"+key] {
+			seen["name:"+key] = true
+			violations = append(violations, Violation{Field: name, Problem: "illegal characters in the field name"})
+		}
+		if has8Bit([]byte(value)) && !seen["8bit:"+key] {
+			seen["8bit:"+key] = true
+			violations = append(violations, Violation{Field: name, Problem: "unencoded 8-bit characters"})
+		}
+		return true
+	})
+
+	b := MessageBuilder{}
+	for _, line := range bytes.Split(b.BuildHeader(m), []byte("\n")) {
+		if len(bytes.TrimRight(line, "\r")) > maxHeaderLineLength {
+			field := ""
+			if i := bytes.IndexByte(line, ':'); i != -1 && line[0] != ' ' && line[0] != '\t' {
+				field = string(line[:i])
+			}
+			violations = append(violations, Violation{Field: field, Problem: fmt.Sprintf("line longer than %d characters", maxHeaderLineLength)})
+		}
+	}
+	return violations
+}
+
+// a field name: printable ascii characters except the colon (RFC 5322 section 2.2)
+func isValidFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] < 33 || name[i] > 126 || name[i] == ':' {
+			return false
+		}
+	}
+	return true
+}
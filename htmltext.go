@@ -0,0 +1,283 @@
+package mailbuilder
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var ErrNoHTMLPart = errors.New("mailbuilder: the message has no text/html part")
+
+/**
+ * render the HTML body of the message as readable plain text: the tags are
+ * stripped, the links are kept as "text <url>", the lists as "- " or "1. "
+ * items and the quotes as "> " lines
+ */
+func (c *Message) PlainTextFromHTML() (string, error) {
+	p := c.findTextBody("text/html")
+	if p == nil {
+		return "", ErrNoHTMLPart
+	}
+	text, err := p.DecodedText()
+	if err != nil {
+		return "", err
+	}
+	return HTMLToText(text)
+}
+
+// render an HTML document as plain text; the lines are separated by \n
+func HTMLToText(document string) (string, error) {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", err
+	}
+	r := textRenderer{lineStart: true}
+	r.render(root)
+	return r.out.String(), nil
+}
+
+type textList struct {
+	ordered bool
+	n       int
+}
+
+// state of the HTML to text rendering
+type textRenderer struct {
+	out strings.Builder
+
+	// pending line breaks and space before the next text
+	newlines int
+	space    bool
+
+	// quote depth when the line breaks were asked for
+	breakQuote int
+
+	lineStart bool
+	pre       int
+	quote     int
+	lists     []textList
+}
+
+// ask for at least n line breaks before the next text (2 for a blank line)
+func (r *textRenderer) breakLine(n int) {
+	if r.newlines == 0 {
+		r.breakQuote = r.quote
+	}
+	if r.newlines < n {
+		r.newlines = n
+	}
+	r.space = false
+}
+
+// add a line break to the pending ones (<br>, <pre> lines)
+func (r *textRenderer) addLineBreak() {
+	if r.newlines == 0 {
+		r.breakQuote = r.quote
+	}
+	r.newlines++
+}
+
+// write s after the pending line breaks and space
+func (r *textRenderer) emit(s string) {
+	if r.out.Len() > 0 && r.newlines > 0 {
+		if r.newlines > 2 && r.pre == 0 {
+			r.newlines = 2
+		}
+		// the blank lines between two quotes stay in the outer one
+		depth := r.quote
+		if r.breakQuote < depth {
+			depth = r.breakQuote
+		}
+		prefix := strings.Repeat("> ", depth)
+		for i := 1; i < r.newlines; i++ {
+			r.out.WriteString("\n" + strings.TrimRight(prefix, " "))
+		}
+		r.out.WriteString("\n")
+		r.lineStart = true
+	}
+	r.newlines = 0
+
+	if r.lineStart {
+		r.out.WriteString(strings.Repeat("> ", r.quote))
+		r.lineStart = false
+	} else if r.space {
+		r.out.WriteByte(' ')
+	}
+	r.space = false
+	r.out.WriteString(s)
+}
+
+// write a text node collapsing the white space outside <pre>
+func (r *textRenderer) text(s string) {
+	if r.pre > 0 {
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				r.addLineBreak()
+			}
+			r.emit(strings.TrimRight(line, "\r"))
+		}
+		return
+	}
+
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			r.space = true
+		}
+		return
+	}
+	if strings.TrimLeft(s, " \t\r\n\f ") != s {
+		r.space = true
+	}
+	for i, word := range words {
+		if i > 0 {
+			r.space = true
+		}
+		r.emit(word)
+	}
+	if strings.TrimRight(s, " \t\r\n\f ") != s {
+		r.space = true
+	}
+}
+
+func (r *textRenderer) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		r.render(child)
+	}
+}
+
+func (r *textRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title, atom.Noscript, atom.Template:
+		return
+
+	case atom.Br:
+		if r.out.Len() > 0 {
+			r.addLineBreak()
+		}
+		r.space = false
+
+	case atom.Hr:
+		r.breakLine(1)
+		r.emit("----------")
+		r.breakLine(1)
+
+	case atom.Img:
+		if alt := strings.TrimSpace(htmlAttr(n, "alt")); alt != "" {
+			r.space = true
+			r.emit("[" + alt + "]")
+			r.space = true
+		}
+
+	case atom.A:
+		r.children(n)
+		href := strings.TrimSpace(htmlAttr(n, "href"))
+		text := strings.Join(strings.Fields(htmlText(n)), " ")
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return
+		}
+		if href == text || strings.TrimPrefix(href, "mailto:") == text {
+			return
+		}
+		if text != "" {
+			r.space = true
+		}
+		r.emit("<" + href + ">")
+
+	case atom.Ul, atom.Ol:
+		breaks := 2
+		if len(r.lists) > 0 {
+			breaks = 1
+		}
+		r.breakLine(breaks)
+		r.lists = append(r.lists, textList{ordered: n.DataAtom == atom.Ol})
+		r.children(n)
+		r.lists = r.lists[:len(r.lists)-1]
+		r.breakLine(breaks)
+
+	case atom.Li:
+		r.breakLine(1)
+		marker := "-"
+		if len(r.lists) > 0 {
+			list := &r.lists[len(r.lists)-1]
+			list.n++
+			if list.ordered {
+				marker = strconv.Itoa(list.n) + "."
+			}
+			marker = strings.Repeat("  ", len(r.lists)-1) + marker
+		}
+		r.emit(marker)
+		r.space = true
+		r.children(n)
+		r.breakLine(1)
+
+	case atom.Blockquote:
+		r.breakLine(2)
+		r.quote++
+		r.children(n)
+		r.quote--
+		r.breakLine(2)
+
+	case atom.Pre:
+		r.breakLine(2)
+		r.pre++
+		r.children(n)
+		r.pre--
+		r.breakLine(2)
+
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.breakLine(2)
+		r.children(n)
+		r.breakLine(2)
+
+	case atom.Div, atom.Table, atom.Tr, atom.Thead, atom.Tbody, atom.Tfoot, atom.Caption,
+		atom.Section, atom.Article, atom.Header, atom.Footer, atom.Nav, atom.Aside, atom.Main,
+		atom.Address, atom.Center, atom.Dl, atom.Dt, atom.Dd, atom.Form, atom.Fieldset, atom.Figure:
+		r.breakLine(1)
+		r.children(n)
+		r.breakLine(1)
+
+	case atom.Td, atom.Th:
+		r.space = true
+		r.children(n)
+		r.space = true
+
+	default:
+		r.children(n)
+	}
+}
+
+// return the value of an attribute of n
+func htmlAttr(n *html.Node, name string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// return the text content of n
+func htmlText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(htmlText(child))
+	}
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// returned by Section for an invalid or unresolvable section specification
+type SectionError struct {
+	Section string
+	Reason  string
+}
+
+func (e *SectionError) Error() string {
+	return "mailbuilder: section " + strconv.Quote(e.Section) + ": " + e.Reason
+}
+
+/**
+ * return the content of an IMAP FETCH BODY[] section (RFC 3501 6.4.5):
+ * "" (whole message), "HEADER", "TEXT", "HEADER.FIELDS (FROM TO)",
+ * "HEADER.FIELDS.NOT (...)", a part number ("2.1") optionally followed by
+ * "MIME" or, for a message/rfc822 part, by HEADER, TEXT or HEADER.FIELDS;
+ * unlike Idx, the parts of an attached message are numbered directly under
+ * it and a non multipart message has a single part 1 (its body); the
+ * content is returned encoded, as it would be sent by a server
+ */
+func (c *Message) Section(section string) ([]byte, error) {
+	spec := strings.TrimSpace(section)
+	b := MessageBuilder{}
+
+	// the part numbers
+	node := c
+	numbered := false
+	for spec != "" {
+		token := spec
+		rest := ""
+		if i := strings.IndexByte(spec, '.'); i != -1 {
+			token, rest = spec[:i], spec[i+1:]
+		}
+		n, err := strconv.Atoi(token)
+		if err != nil {
+			break
+		}
+		if n < 1 {
+			return nil, &SectionError{Section: section, Reason: "invalid part number " + token}
+		}
+		child := imapChild(node, n, numbered)
+		if child == nil {
+			return nil, &SectionError{Section: section, Reason: "no part " + token}
+		}
+		node, numbered, spec = child, true, rest
+	}
+
+	upper := strings.ToUpper(spec)
+	switch {
+	case upper == "":
+		if !numbered {
+			return b.Build(node), nil
+		}
+		return b.bodyBlock(node), nil
+
+	case upper == "MIME":
+		if !numbered {
+			return nil, &SectionError{Section: section, Reason: "MIME needs a part number"}
+		}
+		return b.headerBlock(node), nil
+	}
+
+	// HEADER, TEXT and HEADER.FIELDS apply to a message
+	message := node
+	if numbered {
+		if node.BodyMessage == nil {
+			return nil, &SectionError{Section: section, Reason: "the part is not a message/rfc822"}
+		}
+		message = node.BodyMessage
+	}
+
+	switch {
+	case upper == "HEADER":
+		return b.headerBlock(message), nil
+	case upper == "TEXT":
+		return b.bodyBlock(message), nil
+	case strings.HasPrefix(upper, "HEADER.FIELDS.NOT"):
+		return imapHeaderFields(b.headerBlock(message), spec[len("HEADER.FIELDS.NOT"):], true, section)
+	case strings.HasPrefix(upper, "HEADER.FIELDS"):
+		return imapHeaderFields(b.headerBlock(message), spec[len("HEADER.FIELDS"):], false, section)
+	}
+	return nil, &SectionError{Section: section, Reason: "unknown section text " + strconv.Quote(spec)}
+}
+
+/**
+ * return the n-th IMAP part of node: the root message or an attached
+ * message have their parts numbered from 1 (a non multipart one has only
+ * the part 1, itself); a multipart part has its own parts
+ */
+func imapChild(node *Message, n int, isPart bool) *Message {
+	if isPart && node.BodyMessage != nil {
+		node = node.BodyMessage
+		isPart = false
+	}
+	if node.IsMultipart() {
+		if n > len(node.Parts) {
+			return nil
+		}
+		return node.Parts[n-1]
+	}
+	if !isPart && n == 1 {
+		return node
+	}
+	return nil
+}
+
+// select the fields of a header block listed in "(FROM TO)" (or the other ones)
+func imapHeaderFields(header []byte, list string, not bool, section string) ([]byte, error) {
+	list = strings.TrimSpace(list)
+	if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return nil, &SectionError{Section: section, Reason: "missing field list"}
+	}
+	names := make(map[string]bool)
+	for _, name := range strings.Fields(list[1 : len(list)-1]) {
+		names[strings.ToLower(strings.Trim(name, `"`))] = true
+	}
+	if len(names) == 0 {
+		return nil, &SectionError{Section: section, Reason: "empty field list"}
+	}
+
+	nl := []byte("\r\n")
+	if i := bytes.IndexByte(header, '\n'); i != -1 && (i == 0 || header[i-1] != '\r') {
+		nl = []byte("\n")
+	}
+
+	var b bytes.Buffer
+	for _, field := range rawHeaderFields(header) {
+		if names[strings.ToLower(field.name)] == not {
+			continue
+		}
+		b.Write(field.raw)
+		if !bytes.HasSuffix(field.raw, []byte("\n")) {
+			b.Write(nl)
+		}
+	}
+	b.Write(nl)
+	return b.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+package mailbuilder
+
+import (
+	"encoding/base64"
+	"net/url"
+	"regexp"
+)
+
+// a cid: reference in HTML (attribute value or CSS url())
+var cidReferenceRegexp = regexp.MustCompile(`(?i)cid:([^"'\s<>()]+)`)
+
+/**
+ * inline the cid: images of the HTML parts as base64 data URIs for a
+ * self-contained HTML: the references are resolved against the Content-ID
+ * of the siblings in the multipart/related; with removeParts the inlined
+ * parts are removed (a multipart/related left with the HTML part only is
+ * replaced by it); returns the number of replaced references and the first
+ * error (the parts which can't be decoded are skipped)
+ */
+func InlineCIDImages(m *Message, removeParts bool) (int, error) {
+	replaced := 0
+	var firstErr error
+	var related []*Message
+	m.Walk(func(p *Message) bool {
+		if p.MediaType() != "multipart/related" {
+			return true
+		}
+		n, err := p.inlineRelated(removeParts)
+		replaced += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		related = append(related, p)
+		return true
+	})
+
+	if removeParts {
+		for _, p := range related {
+			if len(p.Parts) == 1 && p.Parent != nil && p.Parent.BodyMessage != p {
+				// the description of the removed multipart stays on its content
+				CopyContentHeaders(p.Parts[0], p)
+				p.Parent.ReplacePart(p, p.Parts[0])
+			}
+		}
+	}
+	return replaced, firstErr
+}
+
+// inline the resources of a multipart/related in its HTML parts
+func (c *Message) inlineRelated(removeParts bool) (int, error) {
+	resources := make(map[string]*Message)
+	for _, p := range c.Parts {
+		if cid := p.ContentID(); cid != "" && !p.IsMultipart() {
+			resources[cid] = p
+		}
+	}
+	if len(resources) == 0 {
+		return 0, nil
+	}
+
+	replaced := 0
+	var firstErr error
+	dataURIs := make(map[string]string)
+	inlined := make(map[*Message]bool)
+	for _, p := range c.Parts {
+		if !p.isTextLeaf() || p.MediaType() != "text/html" {
+			continue
+		}
+		document, err := p.DecodedText()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		n := 0
+		document = cidReferenceRegexp.ReplaceAllStringFunc(document, func(reference string) string {
+			cid := reference[len("cid:"):]
+			if unescaped, err := url.PathUnescape(cid); err == nil {
+				cid = unescaped
+			}
+			resource, ok := resources[cid]
+			if !ok {
+				return reference
+			}
+			uri, ok := dataURIs[cid]
+			if !ok {
+				data, err := resource.DecodedBody()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					return reference
+				}
+				uri = "data:" + resource.MediaType() + ";base64," + base64.StdEncoding.EncodeToString(data)
+				dataURIs[cid] = uri
+			}
+			inlined[resource] = true
+			n++
+			return uri
+		})
+		if n > 0 {
+			p.SetText(document)
+			replaced += n
+		}
+	}
+
+	if removeParts {
+		for resource := range inlined {
+			c.RemovePart(resource)
+		}
+	}
+	return replaced, firstErr
+}
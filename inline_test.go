@@ -0,0 +1,29 @@
+package mailbuilder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineCIDImagesKeepsContentHeaders(t *testing.T) {
+	raw := "Content-Type: multipart/related; boundary=r\r\nContent-Description: newsletter\r\n\r\n" +
+		"--r\r\nContent-Type: text/html\r\n\r\n<img src=\"cid:logo\">\r\n" +
+		"--r\r\nContent-Type: image/png\r\nContent-ID: <logo>\r\nContent-Transfer-Encoding: base64\r\n\r\niVBORw0KGgo=\r\n--r--\r\n"
+	wrapped := "Content-Type: multipart/mixed; boundary=m\r\n\r\n--m\r\n" + raw + "--m--\r\n"
+	d := NewMessageDecomposer()
+	m, err := d.Decompose([]byte(wrapped), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := InlineCIDImages(m, true); n != 1 || err != nil {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	html := m.Parts[0]
+	if html.MediaType() != "text/html" || html.Header.Get("Content-Description") != "newsletter" {
+		t.Errorf("got %s described as %q", html.MediaType(), html.Header.Get("Content-Description"))
+	}
+	if body, _ := html.DecodedBody(); !strings.Contains(string(body), "data:image/png;base64,") {
+		t.Errorf("the image is not inlined: %q", body)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build go1.23
+
+package mailbuilder
+
+import (
+	"iter"
+)
+
+// iterate the message and its descendants (parts and rfc822 body) depth first, like Walk
+func (c *Message) All() iter.Seq[*Message] {
+	return func(yield func(*Message) bool) {
+		c.all(yield)
+	}
+}
+
+// returns false when the iteration was stopped
+func (c *Message) all(yield func(*Message) bool) bool {
+	if !yield(c) {
+		return false
+	}
+	if c.BodyMessage != nil && !c.BodyMessage.all(yield) {
+		return false
+	}
+	for _, p := range c.Parts {
+		if !p.all(yield) {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * iterate the header fields (name and value) in the original order; a field
+ * found several times is returned once for each value and the fields without
+ * known order come last, sorted by name
+ */
+func (c *Message) HeadersInOrder() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		c.rangeHeaders(yield)
+	}
+}
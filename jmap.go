@@ -0,0 +1,472 @@
+package mailbuilder
+
+import (
+	"errors"
+	"mime"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * the JMAP Email object (RFC 8621 section 4.1) with the parsed forms of the
+ * common header fields; the text and html body values are fetched
+ */
+type JMAPEmail struct {
+	Headers       []JMAPEmailHeader        `json:"headers"`
+	MessageID     []string                 `json:"messageId,omitempty"`
+	InReplyTo     []string                 `json:"inReplyTo,omitempty"`
+	References    []string                 `json:"references,omitempty"`
+	Sender        []JMAPEmailAddress       `json:"sender,omitempty"`
+	From          []JMAPEmailAddress       `json:"from,omitempty"`
+	To            []JMAPEmailAddress       `json:"to,omitempty"`
+	Cc            []JMAPEmailAddress       `json:"cc,omitempty"`
+	Bcc           []JMAPEmailAddress       `json:"bcc,omitempty"`
+	ReplyTo       []JMAPEmailAddress       `json:"replyTo,omitempty"`
+	Subject       *string                  `json:"subject,omitempty"`
+	SentAt        *time.Time               `json:"sentAt,omitempty"`
+	BodyStructure *JMAPBodyPart            `json:"bodyStructure,omitempty"`
+	BodyValues    map[string]JMAPBodyValue `json:"bodyValues,omitempty"`
+	TextBody      []*JMAPBodyPart          `json:"textBody,omitempty"`
+	HTMLBody      []*JMAPBodyPart          `json:"htmlBody,omitempty"`
+	Attachments   []*JMAPBodyPart          `json:"attachments,omitempty"`
+	HasAttachment bool                     `json:"hasAttachment"`
+	Preview       string                   `json:"preview"`
+	Size          int                      `json:"size"`
+}
+
+// a header field in raw form: the value is everything after the colon, folding included
+type JMAPEmailHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type JMAPEmailAddress struct {
+	Name  *string `json:"name"`
+	Email string  `json:"email"`
+}
+
+// a part of the JMAP bodyStructure; the multiparts have subParts and no partId
+type JMAPBodyPart struct {
+	PartID      string            `json:"partId,omitempty"`
+	BlobID      string            `json:"blobId,omitempty"`
+	Size        int               `json:"size"`
+	Headers     []JMAPEmailHeader `json:"headers"`
+	Name        *string           `json:"name"`
+	Type        string            `json:"type"`
+	Charset     *string           `json:"charset"`
+	Disposition *string           `json:"disposition"`
+	Cid         *string           `json:"cid"`
+	SubParts    []*JMAPBodyPart   `json:"subParts,omitempty"`
+}
+
+type JMAPBodyValue struct {
+	Value             string `json:"value"`
+	IsEncodingProblem bool   `json:"isEncodingProblem"`
+	IsTruncated       bool   `json:"isTruncated"`
+}
+
+// options of ToJMAPEmail
+type JMAPOptions struct {
+	// return the blobId of a leaf part (storage specific); no blobId if nil
+	BlobID func(p *Message) string
+
+	// truncate the body values to this number of bytes (0 means no limit)
+	MaxBodyValueBytes int
+}
+
+var ErrNoJMAPBody = errors.New("mailbuilder: the JMAP Email has no body")
+
+/**
+ * map the message to a JMAP Email: the headers in raw and parsed forms, the
+ * bodyStructure (an attached message is a leaf), the textBody, htmlBody
+ * and attachments chosen with the RFC 8621 algorithm and the body values of
+ * the text and html bodies; the partIds are numbered in tree order
+ */
+func ToJMAPEmail(m *Message, opts JMAPOptions) *JMAPEmail {
+	b := MessageBuilder{}
+	e := &JMAPEmail{
+		Headers:    jmapHeaders(b.headerBlock(m)),
+		MessageID:  jmapMessageIDs(m.GetHeader("Message-Id")),
+		InReplyTo:  jmapMessageIDs(m.GetHeader("In-Reply-To")),
+		References: jmapMessageIDs(m.GetHeader("References")),
+		Sender:     jmapAddresses(m.GetHeader("Sender")),
+		From:       jmapAddresses(m.GetHeader("From")),
+		To:         jmapAddresses(m.GetHeader("To")),
+		Cc:         jmapAddresses(m.GetHeader("Cc")),
+		Bcc:        jmapAddresses(m.GetHeader("Bcc")),
+		ReplyTo:    jmapAddresses(m.GetHeader("Reply-To")),
+		BodyValues: make(map[string]JMAPBodyValue),
+		Preview:    m.Snippet(256),
+		Size:       len(b.Build(m)),
+	}
+	if subject := m.GetHeaderValues("Subject"); len(subject) > 0 {
+		decoded := strings.TrimSpace(decodeHeaderWords(subject[0]))
+		e.Subject = &decoded
+	}
+	if date, ok := m.Date(); ok {
+		e.SentAt = &date
+	}
+
+	parts := make(map[*JMAPBodyPart]*Message)
+	partID := 0
+	e.BodyStructure = jmapBodyPart(m, opts, parts, &partID)
+
+	e.TextBody, e.HTMLBody, e.Attachments = []*JMAPBodyPart{}, []*JMAPBodyPart{}, []*JMAPBodyPart{}
+	jmapParseStructure([]*JMAPBodyPart{e.BodyStructure}, "mixed", false, &e.HTMLBody, &e.TextBody, &e.Attachments)
+	e.HasAttachment = len(e.Attachments) > 0
+
+	for _, list := range [][]*JMAPBodyPart{e.TextBody, e.HTMLBody} {
+		for _, part := range list {
+			if _, ok := e.BodyValues[part.PartID]; ok || !strings.HasPrefix(part.Type, "text/") {
+				continue
+			}
+			e.BodyValues[part.PartID] = jmapBodyValue(parts[part], opts.MaxBodyValueBytes)
+		}
+	}
+	return e
+}
+
+// describe a node of the tree; the leaves get the next partId
+func jmapBodyPart(p *Message, opts JMAPOptions, parts map[*JMAPBodyPart]*Message, partID *int) *JMAPBodyPart {
+	b := MessageBuilder{}
+	part := &JMAPBodyPart{
+		Headers: jmapHeaders(b.headerBlock(p)),
+		Type:    p.MediaType(),
+	}
+	if p.Header.Get("Content-Type") == "" && p.Parent != nil && p.Parent.MediaType() == "multipart/digest" {
+		part.Type = "message/rfc822"
+	}
+	if name := p.Filename(); name != "" {
+		part.Name = &name
+	}
+	if disposition := p.Disposition(); disposition != "" {
+		part.Disposition = &disposition
+	}
+	if cid := p.ContentID(); cid != "" {
+		part.Cid = &cid
+	}
+	parts[part] = p
+
+	if p.IsMultipart() {
+		for _, child := range p.Parts {
+			part.SubParts = append(part.SubParts, jmapBodyPart(child, opts, parts, partID))
+		}
+		return part
+	}
+
+	*partID++
+	part.PartID = strconv.Itoa(*partID)
+	if opts.BlobID != nil {
+		part.BlobID = opts.BlobID(p)
+	}
+	if strings.HasPrefix(part.Type, "text/") {
+		charset := p.Charset()
+		if charset == "" {
+			charset = "us-ascii"
+		}
+		part.Charset = &charset
+	}
+	if p.BodyMessage != nil {
+		part.Size = len(b.Build(p.BodyMessage))
+	} else if size, err := p.decodedBodySize(); err == nil {
+		part.Size = size
+	} else {
+		part.Size = int(p.BodySize())
+	}
+	return part
+}
+
+// the decoded text of a body part
+func jmapBodyValue(p *Message, maxBytes int) JMAPBodyValue {
+	text, err := p.DecodedText()
+	value := JMAPBodyValue{Value: text}
+	if err != nil {
+		value.IsEncodingProblem = true
+		body, _ := p.rawBody()
+		value.Value = strings.ToValidUTF8(string(body), "�")
+	}
+	if maxBytes > 0 && len(value.Value) > maxBytes {
+		cut := maxBytes
+		for cut > 0 && !utf8RuneStart(value.Value[cut]) {
+			cut--
+		}
+		value.Value = value.Value[:cut]
+		value.IsTruncated = true
+	}
+	return value
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// check if a media type is shown inline by the mail clients
+func jmapInlineMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/")
+}
+
+// the textBody, htmlBody and attachments selection of RFC 8621 section 4.1.4; a nil list is null
+func jmapParseStructure(parts []*JMAPBodyPart, multipartType string, inAlternative bool, htmlBody, textBody, attachments *[]*JMAPBodyPart) {
+	textLength, htmlLength := -1, -1
+	if textBody != nil {
+		textLength = len(*textBody)
+	}
+	if htmlBody != nil {
+		htmlLength = len(*htmlBody)
+	}
+
+	for i, part := range parts {
+		isMultipart := strings.HasPrefix(part.Type, "multipart/")
+		isInline := (part.Disposition == nil || *part.Disposition != "attachment") &&
+			(part.Type == "text/plain" || part.Type == "text/html" || jmapInlineMediaType(part.Type)) &&
+			(i == 0 || (multipartType != "related" && (jmapInlineMediaType(part.Type) || part.Name == nil)))
+
+		switch {
+		case isMultipart:
+			subMultiType := strings.TrimPrefix(part.Type, "multipart/")
+			jmapParseStructure(part.SubParts, subMultiType, inAlternative || subMultiType == "alternative", htmlBody, textBody, attachments)
+
+		case isInline:
+			if multipartType == "alternative" {
+				switch part.Type {
+				case "text/plain":
+					if textBody != nil {
+						*textBody = append(*textBody, part)
+					}
+				case "text/html":
+					if htmlBody != nil {
+						*htmlBody = append(*htmlBody, part)
+					}
+				default:
+					*attachments = append(*attachments, part)
+				}
+				continue
+			}
+			text, html := textBody, htmlBody
+			if inAlternative {
+				if part.Type == "text/plain" {
+					html = nil
+				}
+				if part.Type == "text/html" {
+					text = nil
+				}
+			}
+			if text != nil {
+				*text = append(*text, part)
+			}
+			if html != nil {
+				*html = append(*html, part)
+			}
+			if (text == nil || html == nil) && jmapInlineMediaType(part.Type) {
+				*attachments = append(*attachments, part)
+			}
+
+		default:
+			*attachments = append(*attachments, part)
+		}
+	}
+
+	if multipartType == "alternative" && textBody != nil && htmlBody != nil {
+		// a missing alternative is replaced by the other one
+		if textLength == len(*textBody) && htmlLength != len(*htmlBody) {
+			*textBody = append(*textBody, (*htmlBody)[htmlLength:]...)
+		}
+		if htmlLength == len(*htmlBody) && textLength != len(*textBody) {
+			*htmlBody = append(*htmlBody, (*textBody)[textLength:]...)
+		}
+	}
+}
+
+// the fields of a header block in raw form
+func jmapHeaders(header []byte) []JMAPEmailHeader {
+	result := make([]JMAPEmailHeader, 0)
+	for _, field := range rawHeaderFields(header) {
+		value := strings.TrimRight(string(field.raw), "\r\n")
+		if i := strings.IndexByte(value, ':'); i != -1 {
+			value = value[i+1:]
+		}
+		result = append(result, JMAPEmailHeader{Name: field.name, Value: value})
+	}
+	return result
+}
+
+// the addresses of a header value in the JMAP form
+func jmapAddresses(value string) []JMAPEmailAddress {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	list, err := mail.ParseAddressList(value)
+	if err != nil {
+		return nil
+	}
+	result := make([]JMAPEmailAddress, len(list))
+	for i, address := range list {
+		result[i].Email = address.Address
+		if address.Name != "" {
+			name := address.Name
+			result[i].Name = &name
+		}
+	}
+	return result
+}
+
+// the message ids of a header value, without the angle brackets
+func jmapMessageIDs(value string) []string {
+	var result []string
+	for _, field := range strings.Fields(value) {
+		for _, id := range strings.Split(field, "><") {
+			if id = strings.Trim(id, "<>,"); id != "" {
+				result = append(result, id)
+			}
+		}
+	}
+	return result
+}
+
+/**
+ * create a message from a JMAP Email (as sent to Email/set create): the
+ * raw headers, the parsed address, subject, date and message id
+ * properties, then the body from bodyStructure or from the textBody,
+ * htmlBody and attachments shorthand; the text content is taken from
+ * bodyValues by partId, the other content from blob by blobId
+ */
+func FromJMAPEmail(e *JMAPEmail, blob func(blobID string) ([]byte, error)) (*Message, error) {
+	m := NewMessage()
+	for _, h := range e.Headers {
+		m.SetHeaderField(h.Name, strings.TrimSpace(h.Value))
+	}
+	for _, field := range []struct {
+		name      string
+		addresses []JMAPEmailAddress
+	}{{"From", e.From}, {"Sender", e.Sender}, {"To", e.To}, {"Cc", e.Cc}, {"Bcc", e.Bcc}, {"Reply-To", e.ReplyTo}} {
+		if len(field.addresses) == 0 {
+			continue
+		}
+		formatted := make([]string, len(field.addresses))
+		for i, address := range field.addresses {
+			a := mail.Address{Address: address.Email}
+			if address.Name != nil {
+				a.Name = *address.Name
+			}
+			formatted[i] = a.String()
+		}
+		m.SetHeaderField(field.name, strings.Join(formatted, ", "))
+	}
+	if e.Subject != nil {
+		m.SetHeaderField("Subject", encodeWords(*e.Subject))
+	}
+	if e.SentAt != nil {
+		m.SetDate(*e.SentAt)
+	}
+	for _, field := range []struct {
+		name string
+		ids  []string
+	}{{"Message-ID", e.MessageID}, {"In-Reply-To", e.InReplyTo}, {"References", e.References}} {
+		if len(field.ids) > 0 {
+			m.SetHeaderField(field.name, "<"+strings.Join(field.ids, "> <")+">")
+		}
+	}
+	if m.GetHeader("Mime-Version") == "" {
+		m.SetHeaderField("MIME-Version", "1.0")
+	}
+
+	var content *Message
+	var err error
+	if e.BodyStructure != nil {
+		content, err = jmapContent(e.BodyStructure, e.BodyValues, blob)
+	} else {
+		content, err = jmapShorthandContent(e, blob)
+	}
+	if err != nil {
+		return nil, err
+	}
+	adoptContent(m, content)
+	return m, nil
+}
+
+// build a node of the bodyStructure
+func jmapContent(part *JMAPBodyPart, values map[string]JMAPBodyValue, blob func(string) ([]byte, error)) (*Message, error) {
+	if strings.HasPrefix(part.Type, "multipart/") {
+		p := NewMultipart(strings.TrimPrefix(part.Type, "multipart/"), nil)
+		for _, sub := range part.SubParts {
+			child, err := jmapContent(sub, values, blob)
+			if err != nil {
+				return nil, err
+			}
+			p.AddPart(child)
+		}
+		return p, nil
+	}
+
+	params := map[string]string{}
+	if part.Name != nil {
+		params["name"] = *part.Name
+	}
+	mediaType := part.Type
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+
+	var p *Message
+	if value, ok := values[part.PartID]; ok && part.PartID != "" {
+		params["charset"] = "utf-8"
+		p = NewPart(mime.FormatMediaType(mediaType, params), nil, "7bit")
+		p.SetText(string(ConvertNewlines([]byte(value.Value), "\r\n")))
+	} else if part.BlobID != "" && blob != nil {
+		data, err := blob(part.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		if part.Charset != nil {
+			params["charset"] = *part.Charset
+		}
+		p = NewPart(mime.FormatMediaType(mediaType, params), nil, "7bit")
+		p.SetDecodedBody(data)
+	} else {
+		return nil, ErrNoJMAPBody
+	}
+
+	if part.Disposition != nil {
+		dispositionParams := map[string]string{}
+		if part.Name != nil {
+			dispositionParams["filename"] = *part.Name
+		}
+		p.SetHeaderField("Content-Disposition", mime.FormatMediaType(*part.Disposition, dispositionParams))
+	}
+	if part.Cid != nil {
+		p.SetHeaderField("Content-ID", "<"+*part.Cid+">")
+	}
+	return p, nil
+}
+
+// build the content from textBody, htmlBody and attachments
+func jmapShorthandContent(e *JMAPEmail, blob func(string) ([]byte, error)) (*Message, error) {
+	spec := MessageSpec{}
+	if len(e.TextBody) > 0 {
+		spec.Text = e.BodyValues[e.TextBody[0].PartID].Value
+	}
+	if len(e.HTMLBody) > 0 {
+		spec.HTML = e.BodyValues[e.HTMLBody[0].PartID].Value
+	}
+	for _, a := range e.Attachments {
+		if blob == nil {
+			return nil, ErrNoJMAPBody
+		}
+		data, err := blob(a.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		attachment := AttachmentSpec{Filename: "attachment", ContentType: a.Type, Content: data}
+		if a.Name != nil {
+			attachment.Filename = *a.Name
+		}
+		if a.Cid != nil {
+			attachment.ContentID = *a.Cid
+		}
+		attachment.Inline = a.Disposition != nil && *a.Disposition == "inline"
+		spec.Attachments = append(spec.Attachments, attachment)
+	}
+	return spec.content()
+}
@@ -0,0 +1,40 @@
+package mailbuilder
+
+import (
+	"testing"
+)
+
+func TestFromJMAPEmailMIMEVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []JMAPEmailHeader
+		want    string
+	}{
+		{"added", nil, "1.0"},
+		{"given", []JMAPEmailHeader{{Name: "MIME-Version", Value: "1.0 (generated)"}}, "1.0 (generated)"},
+		{"given lower case", []JMAPEmailHeader{{Name: "mime-version", Value: "1.0"}}, "1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &JMAPEmail{
+				Headers:    tt.headers,
+				TextBody:   []*JMAPBodyPart{{PartID: "1", Type: "text/plain"}},
+				BodyValues: map[string]JMAPBodyValue{"1": {Value: "hello"}},
+			}
+			m, err := FromJMAPEmail(e, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := NewMessageBuilder()
+			d := NewMessageDecomposer()
+			rebuilt, err := d.Decompose(b.Build(m), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if values := rebuilt.GetHeaderValues("Mime-Version"); len(values) != 1 || values[0] != tt.want {
+				t.Errorf("got MIME-Version %q, want %q once", values, tt.want)
+			}
+		})
+	}
+}
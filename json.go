@@ -0,0 +1,221 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/textproto"
+	"unicode/utf8"
+)
+
+/**
+ * the JSON form of a message (Message.MarshalJSON):
+ *
+ *   {
+ *     "idx":        "1-2",
+ *     "headers":    [{"name": "Subject", "value": "hello"}, ...],  in order, one entry per value
+ *     "rawHeader":  blob,        the header as received (byte fidelity)
+ *     "headerChanged": true,     the header was changed since decomposing
+ *     "body":       blob,        leaf body, with its Content-Transfer-Encoding
+ *     "text":       "...",       decoded text of the text parts (read only)
+ *     "boundary":   "...", "subtype": "mixed",
+ *     "parts":      [message, ...],
+ *     "message":    message,     body of a message/rfc822 part
+ *     "decoded":    true,        the message/rfc822 body was transfer decoded
+ *     "rawBody":    blob,        original encoding of a decoded message/rfc822 body
+ *     "newline", "headerTerminator", "preamble", "epilogue", "delimiter",
+ *     "closeDelimiter": the layout captured by the decomposer
+ *     "warnings", "suggestedEncoding", "detectedCharset"
+ *   }
+ *
+ * a blob is a string when the bytes are valid UTF-8, {"base64": "..."}
+ * otherwise; "text" is ignored when "body" is present, else it becomes the
+ * body (see SetText); a decomposed message survives the round trip
+ * byte for byte
+ */
+type jsonMessage struct {
+	Idx               string         `json:"idx,omitempty"`
+	Headers           []jsonHeader   `json:"headers"`
+	RawHeader         jsonBlob       `json:"rawHeader,omitempty"`
+	HeaderChanged     bool           `json:"headerChanged,omitempty"`
+	Body              jsonBlob       `json:"body,omitempty"`
+	Text              *string        `json:"text,omitempty"`
+	Boundary          string         `json:"boundary,omitempty"`
+	Subtype           string         `json:"subtype,omitempty"`
+	Parts             []*jsonMessage `json:"parts,omitempty"`
+	Message           *jsonMessage   `json:"message,omitempty"`
+	Decoded           bool           `json:"decoded,omitempty"`
+	RawBody           jsonBlob       `json:"rawBody,omitempty"`
+	Newline           string         `json:"newline,omitempty"`
+	HeaderTerminator  jsonBlob       `json:"headerTerminator,omitempty"`
+	Preamble          jsonBlob       `json:"preamble,omitempty"`
+	Epilogue          jsonBlob       `json:"epilogue,omitempty"`
+	Delimiter         jsonBlob       `json:"delimiter,omitempty"`
+	CloseDelimiter    jsonBlob       `json:"closeDelimiter,omitempty"`
+	Warnings          []string       `json:"warnings,omitempty"`
+	SuggestedEncoding string         `json:"suggestedEncoding,omitempty"`
+	DetectedCharset   string         `json:"detectedCharset,omitempty"`
+}
+
+type jsonHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// bytes written as a JSON string when valid UTF-8, as {"base64": "..."} otherwise
+type jsonBlob []byte
+
+func (b jsonBlob) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *jsonBlob) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var encoded struct {
+			Base64 string `json:"base64"`
+		}
+		if err := json.Unmarshal(data, &encoded); err != nil {
+			return err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+		if err != nil {
+			return err
+		}
+		*b = decoded
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*b = []byte(s)
+	return nil
+}
+
+// write the message tree as JSON (see jsonMessage for the schema)
+func (c *Message) MarshalJSON() ([]byte, error) {
+	j, err := c.toJSON(true)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+// read a message tree written by MarshalJSON
+func (c *Message) UnmarshalJSON(data []byte) error {
+	var j jsonMessage
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*c = Message{}
+	c.fromJSON(&j, nil, 0)
+	return nil
+}
+
+// withText adds the decoded text of the text parts
+func (c *Message) toJSON(withText bool) (*jsonMessage, error) {
+	// a body kept by a BodyStore is read without releasing it
+	body, err := c.rawBody()
+	if err != nil {
+		return nil, err
+	}
+	j := &jsonMessage{
+		Idx:               c.Idx,
+		Headers:           make([]jsonHeader, 0, len(c.Header)),
+		RawHeader:         c.RawOriginalHeader,
+		HeaderChanged:     c.HeaderIsChanged,
+		Body:              body,
+		Boundary:          c.Boundary,
+		Subtype:           c.MultipartSubtype,
+		Decoded:           c.IsDecoded,
+		Newline:           c.Newline,
+		HeaderTerminator:  c.HeaderTerminator,
+		Preamble:          c.Preamble,
+		Epilogue:          c.Epilogue,
+		Delimiter:         c.RawDelimiter,
+		CloseDelimiter:    c.RawCloseDelimiter,
+		Warnings:          c.Warnings,
+		SuggestedEncoding: c.SuggestedEncoding,
+		DetectedCharset:   c.DetectedCharset,
+	}
+	c.rangeHeaders(func(name, value string) bool {
+		j.Headers = append(j.Headers, jsonHeader{Name: name, Value: value})
+		return true
+	})
+
+	if withText && c.isTextLeaf() {
+		if text, err := c.DecodedText(); err == nil {
+			j.Text = &text
+		}
+	}
+	if c.BodyMessage != nil {
+		if j.Message, err = c.BodyMessage.toJSON(withText); err != nil {
+			return nil, err
+		}
+		if c.RawBody != nil {
+			// only while the message still builds to the original content
+			b := MessageBuilder{}
+			if sha256.Sum256(b.Build(c.BodyMessage)) == c.decodedBodySum {
+				j.RawBody = c.RawBody
+			}
+		}
+	}
+	for _, p := range c.Parts {
+		part, err := p.toJSON(withText)
+		if err != nil {
+			return nil, err
+		}
+		j.Parts = append(j.Parts, part)
+	}
+	return j, nil
+}
+
+func (c *Message) fromJSON(j *jsonMessage, parent *Message, depth int) {
+	c.Idx = j.Idx
+	c.Parent = parent
+	c.rfc822Depth = depth
+	c.Header = make(textproto.MIMEHeader)
+	c.HeaderOrder = make([]string, 0, len(j.Headers))
+	for _, h := range j.Headers {
+		c.Header.Add(h.Name, h.Value)
+		c.HeaderOrder = append(c.HeaderOrder, h.Name)
+	}
+	c.RawOriginalHeader = j.RawHeader
+	c.HeaderIsChanged = j.HeaderChanged
+	c.Boundary = j.Boundary
+	c.MultipartSubtype = j.Subtype
+	c.IsDecoded = j.Decoded
+	c.Newline = j.Newline
+	c.HeaderTerminator = j.HeaderTerminator
+	c.Preamble = j.Preamble
+	c.Epilogue = j.Epilogue
+	c.RawDelimiter = j.Delimiter
+	c.RawCloseDelimiter = j.CloseDelimiter
+	c.Warnings = j.Warnings
+	c.SuggestedEncoding = j.SuggestedEncoding
+	c.DetectedCharset = j.DetectedCharset
+
+	c.Body = j.Body
+	if j.Body == nil && j.Text != nil && j.Message == nil && len(j.Parts) == 0 {
+		c.SetText(*j.Text)
+	}
+
+	if j.Message != nil {
+		c.BodyMessage = &Message{}
+		c.BodyMessage.fromJSON(j.Message, c, depth+1)
+		if j.RawBody != nil {
+			b := MessageBuilder{}
+			c.RawBody = j.RawBody
+			c.decodedBodySum = sha256.Sum256(b.Build(c.BodyMessage))
+		}
+	}
+	for _, pj := range j.Parts {
+		p := &Message{}
+		p.fromJSON(pj, c, depth)
+		c.Parts = append(c.Parts, p)
+	}
+}
@@ -0,0 +1,147 @@
+package mailbuilder
+
+import (
+	"bufio"
+	"bytes"
+	"net/textproto"
+	"strings"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
+)
+
+/**
+ * read-only view over a raw header: a field is parsed (unfolded, like
+ * ReadMIMEHeader does) the first time it is asked for; classification
+ * pipelines reading two or three fields skip the canonicalized map of all
+ * the others
+ */
+type HeaderView struct {
+	raw []byte
+
+	// the raw fields, split on the first access
+	fields []rawHeaderField
+	split  bool
+
+	// parsed values by canonical key
+	values map[string][]string
+}
+
+func NewHeaderView(raw []byte) *HeaderView {
+	return &HeaderView{raw: raw, values: make(map[string][]string)}
+}
+
+// return the first value of the field or ""
+func (v *HeaderView) Get(key string) string {
+	values := v.Values(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// return all the values of the field in header order
+func (v *HeaderView) Values(key string) []string {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if values, ok := v.values[key]; ok {
+		return values
+	}
+
+	if !v.split {
+		v.fields = rawHeaderFields(v.raw)
+		v.split = true
+	}
+	var values []string
+	for _, field := range v.fields {
+		if strings.EqualFold(field.name, key) {
+			values = append(values, parseHeaderField(field.raw)...)
+		}
+	}
+	v.values[key] = values
+	return values
+}
+
+// parse the whole header
+func (v *HeaderView) Header() textproto.MIMEHeader {
+	return parseRawHeader(v.raw)
+}
+
+// parse the Content-* fields, the ones needed to decompose the MIME structure
+func (v *HeaderView) contentHeader() textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	if !v.split {
+		v.fields = rawHeaderFields(v.raw)
+		v.split = true
+	}
+	for _, field := range v.fields {
+		if len(field.name) > 8 && strings.EqualFold(field.name[:8], "Content-") {
+			key := textproto.CanonicalMIMEHeaderKey(field.name)
+			if _, ok := header[key]; !ok {
+				header[key] = v.Values(key)
+			}
+		}
+	}
+	return header
+}
+
+// parse a raw field the way the decomposer does
+func parseHeaderField(raw []byte) []string {
+	for key, values := range parseRawHeader(raw) {
+		if key != "" {
+			return values
+		}
+	}
+	return nil
+}
+
+// parse raw header fields (without the blank line)
+func parseRawHeader(raw []byte) textproto.MIMEHeader {
+	data := make([]byte, 0, len(raw)+4)
+	data = append(data, raw...)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, "\r\n"...)
+	}
+	data = append(data, "\r\n"...)
+
+	header, _, _ := mailtextproto.NewReader(bufio.NewReader(bytes.NewReader(data))).ReadMIMEHeader()
+	return textproto.MIMEHeader(header)
+}
+
+/**
+ * return the header of the message loading it first when the decomposer
+ * only parsed the Content-* fields (see MessageDecomposer.SetLazyHeaders)
+ */
+func (c *Message) LoadHeader() textproto.MIMEHeader {
+	if c.lazyHeader != nil {
+		header := c.lazyHeader.Header()
+		for key := range header {
+			if strings.HasPrefix(key, "Content-") {
+				delete(header, key)
+			}
+		}
+		for key, values := range c.Header {
+			// the parsed fields, changed since decomposing or not
+			header[key] = values
+		}
+		c.Header = header
+		c.lazyHeader = nil
+	}
+	return c.Header
+}
+
+// return the first value of a header field, without loading a lazy header
+func (c *Message) GetHeader(key string) string {
+	values := c.GetHeaderValues(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// return all the values of a header field, without loading a lazy header
+func (c *Message) GetHeaderValues(key string) []string {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if c.lazyHeader != nil && !strings.HasPrefix(key, "Content-") {
+		return c.lazyHeader.Values(key)
+	}
+	return c.Header[key]
+}
@@ -0,0 +1,69 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// a message with a long trace header, as received by a classification pipeline
+func longHeaderMessage() []byte {
+	var b bytes.Buffer
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&b, "Received: from relay%d.example.com (relay%d.example.com [192.0.2.%d])\r\n\tby mx.example.com with ESMTPS id %d\r\n\tfor <user@example.com>; Mon, 1 Jan 2024 00:00:00 +0000\r\n", i, i, i, i)
+	}
+	b.WriteString("From: Sender <sender@example.com>\r\nTo: user@example.com\r\nSubject: classification\r\n")
+	b.WriteString("X-Spam-Score: 1.5\r\nContent-Type: text/plain\r\n\r\nbody\r\n")
+	return b.Bytes()
+}
+
+func TestLazyHeaders(t *testing.T) {
+	raw := longHeaderMessage()
+	eager := NewMessageDecomposer()
+	lazy := NewMessageDecomposer()
+	lazy.SetLazyHeaders(true)
+
+	e, err := eager.Decompose(raw, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := lazy.Decompose(raw, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"From", "subject", "Received", "Content-Type", "X-Missing"} {
+		if got, want := fmt.Sprint(l.GetHeaderValues(key)), fmt.Sprint(e.GetHeaderValues(key)); got != want {
+			t.Errorf("%s: got %s, want %s", key, got, want)
+		}
+	}
+	b := NewMessageBuilder()
+	if !bytes.Equal(b.Build(l), raw) {
+		t.Error("the lazy message rebuilt differently")
+	}
+}
+
+// the classification-only workload: decompose then read three fields
+func benchmarkHeaders(b *testing.B, lazy bool) {
+	raw := longHeaderMessage()
+	d := NewMessageDecomposer()
+	d.SetLazyHeaders(lazy)
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m, err := d.Decompose(raw, "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if m.GetHeader("From") == "" || m.GetHeader("Subject") == "" || m.GetHeader("X-Spam-Score") == "" {
+			b.Fatal("missing field")
+		}
+	}
+}
+
+func BenchmarkHeadersEager(b *testing.B) {
+	benchmarkHeaders(b, false)
+}
+
+func BenchmarkHeadersLazy(b *testing.B) {
+	benchmarkHeaders(b, true)
+}
@@ -0,0 +1,173 @@
+package mailbuilder
+
+import (
+	"errors"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidListID = errors.New("mailbuilder: invalid List-Id identifier")
+
+	// returned for a List-* URL which is not absolute (scheme required)
+	ErrInvalidListURL = errors.New("mailbuilder: invalid List-* URL")
+)
+
+// the identifier of a List-Id (RFC 2919): a dot-atom ("list-id.example.com")
+var listIDRegexp = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+/=?^_` + "`" + `{|}~-]+(\.[A-Za-z0-9!#$%&'*+/=?^_` + "`" + `{|}~-]+)+$`)
+
+// the List-Id of a mailing list message
+type ListID struct {
+	// the decoded phrase before the identifier ("" if none)
+	Description string
+
+	// the identifier without the angle brackets
+	ID string
+}
+
+// return the List-Id of the message; ok is false when it is missing or has no <identifier>
+func (c *Message) ListID() (ListID, bool) {
+	value := stripListComments(decodeHeaderWords(c.GetHeader("List-Id")))
+	start := strings.LastIndexByte(value, '<')
+	end := strings.LastIndexByte(value, '>')
+	if start == -1 || end < start {
+		return ListID{}, false
+	}
+	id := ListID{
+		Description: strings.TrimSpace(value[:start]),
+		ID:          strings.TrimSpace(value[start+1 : end]),
+	}
+	if len(id.Description) >= 2 && strings.HasPrefix(id.Description, `"`) && strings.HasSuffix(id.Description, `"`) {
+		quoted := id.Description[1 : len(id.Description)-1]
+		id.Description = strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(quoted)
+	}
+	return id, id.ID != ""
+}
+
+// set the List-Id; description may be empty
+func (c *Message) SetListID(description, id string) error {
+	id = strings.Trim(strings.TrimSpace(id), "<>")
+	if !listIDRegexp.MatchString(id) {
+		return ErrInvalidListID
+	}
+	value := "<" + id + ">"
+	if description != "" {
+		value = listPhrase(description) + " " + value
+	}
+	c.SetHeaderField("List-Id", value)
+	return nil
+}
+
+/**
+ * return the URLs of a List-* field (RFC 2369): the elements in angle
+ * brackets, in order of preference, the comments and the invalid URLs
+ * skipped
+ */
+func (c *Message) ListURLs(field string) []*url.URL {
+	var urls []*url.URL
+	value := stripListComments(c.GetHeader(field))
+	for {
+		start := strings.IndexByte(value, '<')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(value[start:], '>')
+		if end == -1 {
+			break
+		}
+		// the URLs can be folded
+		raw := strings.Join(strings.Fields(value[start+1:start+end]), "")
+		if u, err := url.Parse(raw); err == nil && u.Scheme != "" {
+			urls = append(urls, u)
+		}
+		value = value[start+end+1:]
+	}
+	return urls
+}
+
+// set a List-* field to the URLs, in order of preference
+func (c *Message) SetListURLs(field string, urls ...string) error {
+	if len(urls) == 0 {
+		return ErrInvalidListURL
+	}
+	elements := make([]string, len(urls))
+	for i, raw := range urls {
+		u, err := url.Parse(strings.Trim(strings.TrimSpace(raw), "<>"))
+		if err != nil || u.Scheme == "" {
+			return ErrInvalidListURL
+		}
+		elements[i] = "<" + u.String() + ">"
+	}
+	c.SetHeaderField(field, strings.Join(elements, ", "))
+	return nil
+}
+
+func (c *Message) ListUnsubscribe() []*url.URL {
+	return c.ListURLs("List-Unsubscribe")
+}
+
+func (c *Message) SetListUnsubscribe(urls ...string) error {
+	return c.SetListURLs("List-Unsubscribe", urls...)
+}
+
+// return the posting URLs; noPosting is true for "List-Post: NO" (posting not allowed)
+func (c *Message) ListPost() (urls []*url.URL, noPosting bool) {
+	if strings.EqualFold(strings.TrimSpace(stripListComments(c.GetHeader("List-Post"))), "NO") {
+		return nil, true
+	}
+	return c.ListURLs("List-Post"), false
+}
+
+// set the posting URLs; none writes "List-Post: NO"
+func (c *Message) SetListPost(urls ...string) error {
+	if len(urls) == 0 {
+		c.SetHeaderField("List-Post", "NO")
+		return nil
+	}
+	return c.SetListURLs("List-Post", urls...)
+}
+
+func (c *Message) ListArchive() []*url.URL {
+	return c.ListURLs("List-Archive")
+}
+
+func (c *Message) SetListArchive(urls ...string) error {
+	return c.SetListURLs("List-Archive", urls...)
+}
+
+// the description of a List-Id: quoted if it has special characters, the non-ascii words encoded
+func listPhrase(description string) string {
+	if has8Bit([]byte(description)) {
+		return mime.QEncoding.Encode("utf-8", description)
+	}
+	if strings.ContainsAny(description, `()<>@,;:\".[]`) {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(description) + `"`
+	}
+	return description
+}
+
+// remove the comments (in parentheses, outside the angle brackets) of a List-* field
+func stripListComments(value string) string {
+	var b strings.Builder
+	depth, inURL := 0, false
+	for _, r := range value {
+		switch {
+		case r == '<' && depth == 0:
+			inURL = true
+		case r == '>' && depth == 0:
+			inURL = false
+		case r == '(' && !inURL:
+			depth++
+			continue
+		case r == ')' && !inURL && depth > 0:
+			depth--
+			continue
+		}
+		if depth == 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,233 @@
+package lmtp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/axigenmessaging/mailbuilder"
+)
+
+// returned by Deliver called without recipients
+var ErrNoRecipients = errors.New("lmtp: no recipients")
+
+// returned by Deliver when the sender or a recipient holds a line break (as net/smtp)
+var ErrInvalidLine = errors.New("lmtp: a line must not contain CR or LF")
+
+// a negative reply of the server to a command
+type ReplyError struct {
+	Command string
+	Code    int
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("lmtp: %s: %d %s", e.Command, e.Code, e.Message)
+}
+
+// check if the reply is a temporary failure (4xx)
+func (e *ReplyError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// the delivery status of a recipient: the reply to RCPT TO if it was
+// rejected, the reply after the data (one per recipient) otherwise
+type RecipientStatus struct {
+	Recipient string
+	Code      int
+	Message   string
+}
+
+// check if the message was delivered to the recipient
+func (s RecipientStatus) OK() bool {
+	return s.Code >= 200 && s.Code < 300
+}
+
+// check if the delivery failed temporarily (4xx) and can be retried
+func (s RecipientStatus) Temporary() bool {
+	return s.Code >= 400 && s.Code < 500
+}
+
+// an LMTP (RFC 2033) client connection
+type Client struct {
+	text    *textproto.Conn
+	conn    net.Conn
+	builder mailbuilder.MessageBuilder
+
+	// the LHLO extensions of the server (upper case keyword -> parameters)
+	extensions map[string]string
+}
+
+/**
+ * connect to an LMTP server: network is "unix" for a local socket or "tcp";
+ * the greeting is read and LHLO sent with the host name
+ */
+func Dial(network, address string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	localName, err := os.Hostname()
+	if err != nil {
+		localName = "localhost"
+	}
+	c, err := NewClient(conn, localName)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// start the LMTP session on an open connection: read the greeting and send LHLO localName
+func NewClient(conn net.Conn, localName string) (*Client, error) {
+	c := &Client{
+		text:       textproto.NewConn(conn),
+		conn:       conn,
+		builder:    mailbuilder.NewMessageBuilder(),
+		extensions: make(map[string]string),
+	}
+	if _, _, err := c.reply("greeting", 220); err != nil {
+		return nil, err
+	}
+	_, msg, err := c.command("LHLO", 250, "LHLO %s", localName)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1:] {
+		keyword, params, _ := strings.Cut(line, " ")
+		c.extensions[strings.ToUpper(keyword)] = params
+	}
+	return c, nil
+}
+
+// set the builder used by Deliver
+func (c *Client) SetBuilder(builder mailbuilder.MessageBuilder) {
+	c.builder = builder
+}
+
+func (c *Client) GetBuilder() mailbuilder.MessageBuilder {
+	return c.builder
+}
+
+// check that a command argument holds no line break
+func validateLine(line string) error {
+	if strings.ContainsAny(line, "\r\n") {
+		return ErrInvalidLine
+	}
+	return nil
+}
+
+// check if the server announced the extension (8BITMIME, PIPELINING, ...) and return its parameters
+func (c *Client) Extension(name string) (bool, string) {
+	params, ok := c.extensions[strings.ToUpper(name)]
+	return ok, params
+}
+
+/**
+ * deliver the message from the envelope sender to the recipients; the
+ * result has the status of every recipient in order (the rejected ones
+ * with the reply to RCPT TO); the error is a *ReplyError when the server
+ * refuses the transaction (MAIL FROM, DATA) and the session can be used
+ * again for the next message
+ */
+func (c *Client) Deliver(m *mailbuilder.Message, from string, recipients []string) ([]RecipientStatus, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	// checked before sending anything: a line break would add commands
+	if err := validateLine(from); err != nil {
+		return nil, err
+	}
+	for _, rcpt := range recipients {
+		if err := validateLine(rcpt); err != nil {
+			return nil, err
+		}
+	}
+
+	mailCmd := "MAIL FROM:<%s>"
+	if ok, _ := c.Extension("8BITMIME"); ok {
+		mailCmd += " BODY=8BITMIME"
+	}
+	if _, _, err := c.command("MAIL FROM", 250, mailCmd, from); err != nil {
+		return nil, err
+	}
+
+	result := make([]RecipientStatus, len(recipients))
+	accepted := make([]int, 0, len(recipients))
+	for i, rcpt := range recipients {
+		result[i].Recipient = rcpt
+		code, msg, err := c.command("RCPT TO", 25, "RCPT TO:<%s>", rcpt)
+		result[i].Code, result[i].Message = code, msg
+		if err == nil {
+			accepted = append(accepted, i)
+			continue
+		}
+		var replyErr *ReplyError
+		if !errors.As(err, &replyErr) {
+			return nil, err
+		}
+	}
+	if len(accepted) == 0 {
+		_, _, err := c.command("RSET", 250, "RSET")
+		return result, err
+	}
+
+	if _, _, err := c.command("DATA", 354, "DATA"); err != nil {
+		return nil, err
+	}
+	w := c.text.DotWriter()
+	if _, err := w.Write(c.builder.Build(m)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	// one reply per accepted recipient
+	for _, i := range accepted {
+		code, msg, err := c.reply("DATA", 25)
+		var replyErr *ReplyError
+		if err != nil && !errors.As(err, &replyErr) {
+			return nil, err
+		}
+		result[i].Code, result[i].Message = code, msg
+	}
+	return result, nil
+}
+
+// send QUIT and close the connection
+func (c *Client) Quit() error {
+	_, _, err := c.command("QUIT", 221, "QUIT")
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// close the connection
+func (c *Client) Close() error {
+	return c.text.Close()
+}
+
+// send a command and read the reply
+func (c *Client) command(name string, expectCode int, format string, args ...interface{}) (int, string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.reply(name, expectCode)
+}
+
+// read a reply; a negative one is returned as a *ReplyError
+func (c *Client) reply(name string, expectCode int) (int, string, error) {
+	code, msg, err := c.text.ReadResponse(expectCode)
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return code, msg, &ReplyError{Command: name, Code: code, Message: msg}
+	}
+	return code, msg, err
+}
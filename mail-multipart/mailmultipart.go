@@ -45,6 +45,18 @@ type Part struct {
 
 	RawOriginalHeader []byte
 
+	// the bytes between the last header field and the body: the ending
+	// of the last field and the blank line
+	HeaderTerminator []byte
+
+	// the bytes read between the previous part body (or the preamble) and
+	// the header: the line ending before the boundary and the boundary line
+	RawDelimiter []byte
+
+	// BodyOffset is the offset of the body from the start of the
+	// multipart body read by the Reader.
+	BodyOffset int64
+
 	disposition       string
 	dispositionParams map[string]string
 
@@ -67,8 +79,10 @@ type Part struct {
 // parse such headers.
 func NewReader(r io.Reader, boundary string) *Reader {
 	b := []byte("\r\n--" + boundary + "--")
+	src := &stickyErrorReader{r: r}
 	return &Reader{
-		bufReader:        bufio.NewReaderSize(&stickyErrorReader{r: r}, peekBufferSize),
+		src:              src,
+		bufReader:        bufio.NewReaderSize(src, peekBufferSize),
 		nl:               b[:2],
 		nlDashBoundary:   b[:len(b)-2],
 		dashBoundaryDash: b[2:],
@@ -81,9 +95,11 @@ func NewReader(r io.Reader, boundary string) *Reader {
 // interface's contract promises nothing about the return values of
 // Read calls after an error, yet this package does do multiple Reads
 // after error)
+// It counts the bytes read so far.
 type stickyErrorReader struct {
 	r   io.Reader
 	err error
+	n   int64
 }
 
 func (r *stickyErrorReader) Read(p []byte) (n int, _ error) {
@@ -91,6 +107,7 @@ func (r *stickyErrorReader) Read(p []byte) (n int, _ error) {
 		return 0, r.err
 	}
 	n, r.err = r.r.Read(p)
+	r.n += int64(n)
 	return n, r.err
 }
 
@@ -108,11 +125,14 @@ func newPart(mr *Reader) (*Part, error) {
 }
 
 func (bp *Part) populateHeaders() error {
-	r := mailtextproto.NewReader(bp.mr.bufReader)
+	r := mailtextproto.GetReader(bp.mr.bufReader)
+	defer mailtextproto.PutReader(r)
+	r.SetLimits(bp.mr.Limits)
 	header, rawHeader, err := r.ReadMIMEHeader()
 	if err == nil {
 		bp.Header = header
 		bp.RawOriginalHeader = bytes.TrimRight(rawHeader, "\r\n")
+		bp.HeaderTerminator = rawHeader[len(bp.RawOriginalHeader):]
 	}
 	return err
 }
@@ -252,6 +272,7 @@ func (p *Part) Close() error {
 // Reader's underlying parser consumes its input as needed. Seeking
 // isn't supported.
 type Reader struct {
+	src       *stickyErrorReader
 	bufReader *bufio.Reader
 
 	currentPart *Part
@@ -261,6 +282,21 @@ type Reader struct {
 	nlDashBoundary   []byte // nl + "--boundary"
 	dashBoundaryDash []byte // "--boundary--"
 	dashBoundary     []byte // "--boundary"
+
+	// the bytes before the first boundary line
+	Preamble []byte
+
+	// the line ending before the final boundary and the final boundary line
+	RawCloseDelimiter []byte
+
+	// Limits are applied to the reading of the part headers.
+	Limits mailtextproto.Limits
+}
+
+// Epilogue returns the bytes after the final boundary line; it must be
+// called after NextPart returned io.EOF.
+func (r *Reader) Epilogue() ([]byte, error) {
+	return ioutil.ReadAll(r.bufReader)
 }
 
 // NextPart returns the next part in the multipart or an error.
@@ -273,6 +309,8 @@ func (r *Reader) NextPart() (*Part, error) {
 		return nil, fmt.Errorf("multipart: boundary is empty")
 	}
 	expectNewPart := false
+	// the raw bytes of the delimiter
+	var delimiter []byte
 	for {
 		line, err := r.bufReader.ReadSlice('\n')
 
@@ -282,24 +320,38 @@ func (r *Reader) NextPart() (*Part, error) {
 			// (since it's missing the '\n'), but this is a valid
 			// multipart EOF so we need to return io.EOF instead of
 			// a fmt-wrapped one.
+			r.RawCloseDelimiter = append(delimiter, line...)
 			return nil, io.EOF
 		}
+		if err == bufio.ErrBufferFull && r.partsRead == 0 {
+			// a long preamble line
+			r.Preamble = append(r.Preamble, line...)
+			continue
+		}
 		if err != nil {
 			return nil, fmt.Errorf("multipart: NextPart: %v", err)
 		}
 
 		if r.isBoundaryDelimiterLine(line) {
 			r.partsRead++
+			delimiter = append(delimiter, line...)
 			bp, err := newPart(r)
+			if err == io.EOF {
+				// a truncated multipart, not its end
+				return nil, io.ErrUnexpectedEOF
+			}
 			if err != nil {
 				return nil, err
 			}
+			bp.RawDelimiter = delimiter
+			bp.BodyOffset = r.offset()
 			r.currentPart = bp
 			return bp, nil
 		}
 
 		if r.isFinalBoundary(line) {
 			// Expected EOF
+			r.RawCloseDelimiter = append(delimiter, line...)
 			return nil, io.EOF
 		}
 
@@ -309,6 +361,7 @@ func (r *Reader) NextPart() (*Part, error) {
 
 		if r.partsRead == 0 {
 			// skip line
+			r.Preamble = append(r.Preamble, line...)
 			continue
 		}
 
@@ -318,6 +371,7 @@ func (r *Reader) NextPart() (*Part, error) {
 		// end boundary)
 		if bytes.Equal(line, r.nl) {
 			expectNewPart = true
+			delimiter = append(delimiter, line...)
 			continue
 		}
 
@@ -325,6 +379,11 @@ func (r *Reader) NextPart() (*Part, error) {
 	}
 }
 
+// offset returns the number of bytes consumed from the multipart body.
+func (r *Reader) offset() int64 {
+	return r.src.n - int64(r.bufReader.Buffered())
+}
+
 // isFinalBoundary reports whether line is the final boundary line
 // indicating that all parts are over.
 // It matches `^--boundary--[ \t]*(\r\n)?$`
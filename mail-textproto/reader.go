@@ -7,11 +7,13 @@ package mailtextproto
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/textproto"
+	"strconv"
+	"sync"
 //	"fmt"
-	//"strconv"
 	//"strings"
 )
 
@@ -21,6 +23,94 @@ type Reader struct {
 	R   *bufio.Reader
 	dot *dotReader
 	buf []byte // a re-usable buffer for readContinuedLineSlice
+
+	// MaxLineBytes limits the length of a line, without its ending.
+	// A longer line makes the read fail with a *LineTooLongError and
+	// the rest of the line is left unread. Zero means no limit.
+	MaxLineBytes int
+
+	// MaxHeaderBytes limits the size of a header read by ReadMIMEHeader,
+	// line endings and the blank line included; a larger header makes it
+	// fail with a *HeaderTooLargeError. Zero means no limit.
+	MaxHeaderBytes int
+
+	// MaxHeaderFields limits the number of fields of a header read by
+	// ReadMIMEHeader; one more makes it fail with a *TooManyFieldsError.
+	// Zero means no limit.
+	MaxHeaderFields int
+
+	// MaxFieldBytes limits the size of a single field read by
+	// ReadMIMEHeader, continuation lines and line endings included; a
+	// longer field makes it fail with a *FieldTooLongError. Zero means
+	// no limit.
+	MaxFieldBytes int
+}
+
+// A LineTooLongError is returned when a line is longer than
+// Reader.MaxLineBytes.
+type LineTooLongError struct {
+	Limit int
+}
+
+func (e *LineTooLongError) Error() string {
+	return "mailtextproto: line longer than " + strconv.Itoa(e.Limit) + " bytes"
+}
+
+// A HeaderTooLargeError is returned by ReadMIMEHeader when the header is
+// larger than Reader.MaxHeaderBytes.
+type HeaderTooLargeError struct {
+	Limit int
+}
+
+func (e *HeaderTooLargeError) Error() string {
+	return "mailtextproto: header larger than " + strconv.Itoa(e.Limit) + " bytes"
+}
+
+// A TooManyFieldsError is returned by ReadMIMEHeader when the header has
+// more than Reader.MaxHeaderFields fields.
+type TooManyFieldsError struct {
+	Limit int
+}
+
+func (e *TooManyFieldsError) Error() string {
+	return "mailtextproto: header with more than " + strconv.Itoa(e.Limit) + " fields"
+}
+
+// A FieldTooLongError is returned by ReadMIMEHeader when a field is
+// longer than Reader.MaxFieldBytes. Field is the canonical name of the
+// field, empty if it could not be read.
+type FieldTooLongError struct {
+	Field string
+	Limit int
+}
+
+func (e *FieldTooLongError) Error() string {
+	return "mailtextproto: header field " + strconv.Quote(e.Field) + " longer than " + strconv.Itoa(e.Limit) + " bytes"
+}
+
+// noLimit is the read limit of the lines read outside ReadMIMEHeader.
+const noLimit = int(^uint(0) >> 1)
+
+// errReadLimit is returned by readLineSlice and readContinuedLineSlice
+// when the original line goes over the limit; ReadMIMEHeader turns it into
+// the error of the limit reached.
+var errReadLimit = errors.New("mailtextproto: read limit exceeded")
+
+// Limits holds the limits of a Reader, as its fields of the same name;
+// zero means no limit.
+type Limits struct {
+	MaxLineBytes    int
+	MaxHeaderBytes  int
+	MaxHeaderFields int
+	MaxFieldBytes   int
+}
+
+// SetLimits sets the limits of r.
+func (r *Reader) SetLimits(l Limits) {
+	r.MaxLineBytes = l.MaxLineBytes
+	r.MaxHeaderBytes = l.MaxHeaderBytes
+	r.MaxHeaderFields = l.MaxHeaderFields
+	r.MaxFieldBytes = l.MaxFieldBytes
 }
 
 // NewReader returns a new Reader reading from r.
@@ -32,16 +122,48 @@ func NewReader(r *bufio.Reader) *Reader {
 	return &Reader{R: r}
 }
 
+var readerPool sync.Pool
+
+// maxPooledBufSize is the capacity above which the buffer of a Reader
+// put back by PutReader is dropped rather than kept in the pool.
+const maxPooledBufSize = 64 << 10
+
+// GetReader is like NewReader but takes the Reader, with the buffer
+// it reads the continued lines into, from a pool. The limits of the
+// returned Reader are zero. The Reader should be given back with
+// PutReader once no longer used.
+func GetReader(r *bufio.Reader) *Reader {
+	if v := readerPool.Get(); v != nil {
+		tr := v.(*Reader)
+		tr.R = r
+		return tr
+	}
+	return NewReader(r)
+}
+
+// PutReader puts r back in the pool used by GetReader. r must not be
+// used after the call; the bufio.Reader it read from is left as is and
+// may still be used.
+func PutReader(r *Reader) {
+	buf := r.buf[:0]
+	if cap(buf) > maxPooledBufSize {
+		buf = nil
+	}
+	*r = Reader{buf: buf}
+	readerPool.Put(r)
+}
+
 // ReadLine reads a single line from r,
-// eliding the final \n or \r\n from the returned string.
+// eliding the final \n or \r\n from the returned string;
+// the original line is returned with its ending.
 func (r *Reader) ReadLine() (string, string, error) {
-	line, originalLine, err := r.readLineSlice()
+	line, originalLine, err := r.readLineSlice(nil, noLimit)
 	return string(line), string(originalLine), err
 }
 
 // ReadLineBytes is like ReadLine but returns a []byte instead of a string.
 func (r *Reader) ReadLineBytes() ([]byte, []byte, error) {
-	line, originalLine, err := r.readLineSlice()
+	line, originalLine, err := r.readLineSlice(nil, noLimit)
 	if line != nil {
 		buf := make([]byte, len(line))
 		copy(buf, line)
@@ -50,26 +172,49 @@ func (r *Reader) ReadLineBytes() ([]byte, []byte, error) {
 	return line, originalLine, err
 }
 
-func (r *Reader) readLineSlice() ([]byte,[]byte, error) {
+// readLineSlice returns the line without its ending and appends the
+// original line, with its exact ending ("\r\n", "\n" or none at the end of
+// the input), to orig; an original line longer than limit bytes makes it
+// fail with errReadLimit
+func (r *Reader) readLineSlice(orig []byte, limit int) ([]byte, []byte, error) {
 	r.closeDot()
-	var (
-		line []byte
-		originalLine []byte
-	)
+	start := len(orig)
+	var line []byte
 	for {
-		l, more, err := r.R.ReadLine()
-		if err != nil {
-			return nil, originalLine, err
+		l, err := r.R.ReadSlice('\n')
+		if err == io.EOF && len(l) > 0 {
+			// the last line has no ending; report io.EOF on the next call
+			err = nil
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, orig, err
 		}
+		more := err == bufio.ErrBufferFull
 
-		if len(originalLine) > 0 {
-			originalLine = append(originalLine, []byte("\r\n")...)
+		orig = append(orig, l...)
+
+		if !more {
+			if len(l) > 0 && l[len(l)-1] == '\n' {
+				l = l[:len(l)-1]
+				if len(l) > 0 && l[len(l)-1] == '\r' {
+					l = l[:len(l)-1]
+				} else if len(l) == 0 && len(line) > 0 && line[len(line)-1] == '\r' {
+					// the \r was returned with the previous chunk
+					line = line[:len(line)-1]
+				}
+			}
+		}
+
+		if r.MaxLineBytes > 0 && len(line)+len(l) > r.MaxLineBytes {
+			return nil, orig, &LineTooLongError{Limit: r.MaxLineBytes}
+		}
+		if len(orig)-start > limit {
+			return nil, orig, errReadLimit
 		}
-		originalLine = append(originalLine, l...)
 
 		// Avoid the copy if the first call produced a full line.
 		if line == nil && !more {
-			return l, originalLine, nil
+			return l, orig, nil
 		}
 		line = append(line, l...)
 
@@ -77,7 +222,7 @@ func (r *Reader) readLineSlice() ([]byte,[]byte, error) {
 			break
 		}
 	}
-	return line, originalLine, nil
+	return line, orig, nil
 }
 
 // ReadContinuedLine reads a possibly continued line from r,
@@ -100,7 +245,7 @@ func (r *Reader) readLineSlice() ([]byte,[]byte, error) {
 // A line consisting of only white space is never continued.
 //
 func (r *Reader) ReadContinuedLine() (string, string, error) {
-	line, originalLine, err := r.readContinuedLineSlice()
+	line, originalLine, err := r.readContinuedLineSlice(nil, noLimit)
 	return string(line), string(originalLine), err
 }
 
@@ -121,7 +266,7 @@ func trim(s []byte) []byte {
 // ReadContinuedLineBytes is like ReadContinuedLine but
 // returns a []byte instead of a string.
 func (r *Reader) ReadContinuedLineBytes() ([]byte, []byte, error) {
-	line, originalLine, err := r.readContinuedLineSlice()
+	line, originalLine, err := r.readContinuedLineSlice(nil, noLimit)
 	if line != nil {
 		buf := make([]byte, len(line))
 		copy(buf, line)
@@ -130,17 +275,21 @@ func (r *Reader) ReadContinuedLineBytes() ([]byte, []byte, error) {
 	return line, originalLine, err
 }
 
-func (r *Reader) readContinuedLineSlice() ([]byte, []byte, error) {
+// readContinuedLineSlice appends the original lines to orig like
+// readLineSlice; it fails with errReadLimit when the original line, its
+// continuation lines included, is longer than limit bytes.
+func (r *Reader) readContinuedLineSlice(orig []byte, limit int) ([]byte, []byte, error) {
+	start := len(orig)
 
 	// Read the first line.
-	line, originalLine, err := r.readLineSlice()
+	line, orig, err := r.readLineSlice(orig, limit)
 
 	if err != nil {
-		return nil, originalLine, err
+		return nil, orig, err
 	}
 
 	if len(line) == 0 { // blank line - no continuation
-		return line, originalLine, nil
+		return line, orig, nil
 	}
 
 	// Optimistically assume that we have started to buffer the next line
@@ -151,36 +300,34 @@ func (r *Reader) readContinuedLineSlice() ([]byte, []byte, error) {
 		peek, _ := r.R.Peek(2)
 		if len(peek) > 0 && (isASCIILetter(peek[0]) || peek[0] == '\n') ||
 			len(peek) == 2 && peek[0] == '\r' && peek[1] == '\n' {
-			return trim(line), originalLine, nil
+			return trim(line), orig, nil
 		}
 	}
 
-	bf := bytes.NewBuffer([]byte{})
-	bf.Grow(len(originalLine))
-	bf.Write(originalLine)
-
 	// ReadByte or the next readLineSlice will flush the read buffer;
 	// copy the slice into buf.
 	r.buf = append(r.buf[:0], trim(line)...)
 
 	// Read continuation lines.
-	for  {
-		skipped, skippedNo := r.skipSpace()
+	for {
+		var skipped int
+		orig, skipped = r.skipSpace(orig, limit-(len(orig)-start))
 
-		if skippedNo <= 0 {
+		if skipped <= 0 {
 			break
 		}
+		if len(orig)-start > limit {
+			return nil, orig, errReadLimit
+		}
 
-		bf.Grow(len("\r\n"))
-		bf.WriteString("\r\n")
-
-		line, originalLine2, err := r.readLineSlice()
-
-		bf.Grow(len(skipped))
-		bf.Write(skipped)
-		bf.Grow(len(originalLine2))
-		bf.Write(originalLine2)
+		line, orig, err = r.readLineSlice(orig, limit-(len(orig)-start))
 
+		if err == errReadLimit {
+			return nil, orig, err
+		}
+		if _, ok := err.(*LineTooLongError); ok {
+			return nil, orig, err
+		}
 		if err != nil {
 			break
 		}
@@ -188,16 +335,15 @@ func (r *Reader) readContinuedLineSlice() ([]byte, []byte, error) {
 		r.buf = append(r.buf, trim(line)...)
 	}
 
-	//fmt.Printf("\r\nHeader Line: %s", bf.Bytes());
-	return r.buf, bf.Bytes(), nil
+	return r.buf, orig, nil
 }
 
-// skipSpace skips R over all spaces and returns the number of bytes skipped.
-func (r *Reader) skipSpace() ([]byte, int) {
+// skipSpace skips R over all spaces, appending them to orig, and returns
+// the number of bytes skipped; it stops after max+1 bytes.
+func (r *Reader) skipSpace(orig []byte, max int) ([]byte, int) {
 	n := 0
 
-	b := []byte{}
-	for {
+	for n <= max {
 		c, err := r.R.ReadByte()
 		if err != nil {
 			// Bufio will keep err until next read.
@@ -207,10 +353,10 @@ func (r *Reader) skipSpace() ([]byte, int) {
 			r.R.UnreadByte()
 			break
 		}
-		b = append(b, c)
+		orig = append(orig, c)
 		n++
 	}
-	return b, n
+	return orig, n
 }
 
 
@@ -403,28 +549,34 @@ func (r *Reader) ReadDotLines() ([]string, error) {
 //		"Long-Key": {"Even Longer Value"},
 //	}
 //
+// The raw header is returned too, byte for byte: the original line endings
+// and the terminating blank line are kept.
+//
 func (r *Reader) ReadMIMEHeader() (textproto.MIMEHeader, []byte, error) {
 	// Avoid lots of small slice allocations later by allocating one
 	// large one ahead of time which we'll cut up into smaller
 	// slices. If this isn't big enough later, we allocate small ones.
 	var strs []string
-	hint := r.upcomingHeaderNewlines()
+	hint, size := r.upcomingHeader()
 	if hint > 0 {
 		strs = make([]string, hint)
 	}
 
+	// the original lines, the blank line included, are appended in place;
+	// sized for the whole header when it is already buffered
 	var originalHeader []byte
+	if size > 0 {
+		originalHeader = make([]byte, 0, size)
+	}
 	m := make(textproto.MIMEHeader, hint)
 
 	// The first line cannot start with a leading space.
 	if buf, err := r.R.Peek(1); err == nil && (buf[0] == ' ' || buf[0] == '\t') {
-		line, originalLine, err := r.readLineSlice()
+		var line []byte
+		line, originalHeader, err = r.readLineSlice(originalHeader, r.readLimit(0))
 
-		if (originalLine != nil && len(originalLine)>0 ) {
-			if len(originalHeader) > 0 {
-				originalHeader = append(originalHeader, []byte("\r\n")...)
-			}
-			originalHeader = append(originalHeader, originalLine...);
+		if err == errReadLimit {
+			return m, originalHeader, r.limitError(originalHeader)
 		}
 		if err != nil {
 			return m,originalHeader,  err
@@ -432,13 +584,15 @@ func (r *Reader) ReadMIMEHeader() (textproto.MIMEHeader, []byte, error) {
 		return m, originalHeader, textproto.ProtocolError("malformed MIME header initial line: " + string(line))
 	}
 
+	fields := 0
 	for {
-		kv, originalLine, err := r.readContinuedLineSlice()
-		if len(originalLine) > 0 {
-			if len(originalHeader) > 0 {
-				originalHeader = append(originalHeader, []byte("\n")...)
-			}
-			originalHeader = append(originalHeader, []byte(originalLine)...)
+		start := len(originalHeader)
+		var kv []byte
+		var err error
+		kv, originalHeader, err = r.readContinuedLineSlice(originalHeader, r.readLimit(start))
+
+		if err == errReadLimit {
+			return m, originalHeader, r.limitError(originalHeader[start:])
 		}
 
 		if len(kv) == 0 {
@@ -465,6 +619,11 @@ func (r *Reader) ReadMIMEHeader() (textproto.MIMEHeader, []byte, error) {
 			continue
 		}
 
+		fields++
+		if r.MaxHeaderFields > 0 && fields > r.MaxHeaderFields {
+			return m, originalHeader, &TooManyFieldsError{Limit: r.MaxHeaderFields}
+		}
+
 		// Skip initial spaces in value.
 		i++ // skip colon
 		for i < len(kv) && (kv[i] == ' ' || kv[i] == '\t') {
@@ -491,9 +650,38 @@ func (r *Reader) ReadMIMEHeader() (textproto.MIMEHeader, []byte, error) {
 	}
 }
 
-// upcomingHeaderNewlines returns an approximation of the number of newlines
-// that will be in this header. If it gets confused, it returns 0.
-func (r *Reader) upcomingHeaderNewlines() (n int) {
+// readLimit returns the number of bytes the next field of a header can
+// take, read already bytes of the header being read.
+func (r *Reader) readLimit(read int) int {
+	limit := noLimit
+	if r.MaxFieldBytes > 0 {
+		limit = r.MaxFieldBytes
+	}
+	if r.MaxHeaderBytes > 0 && r.MaxHeaderBytes-read < limit {
+		limit = r.MaxHeaderBytes - read
+		if limit < 0 {
+			limit = 0
+		}
+	}
+	return limit
+}
+
+// limitError returns the error of the limit reached reading originalLine.
+func (r *Reader) limitError(originalLine []byte) error {
+	if r.MaxFieldBytes > 0 && len(originalLine) > r.MaxFieldBytes {
+		field := ""
+		if i := bytes.IndexByte(originalLine, ':'); i > 0 {
+			field = CanonicalMIMEHeaderKey(string(bytes.TrimRight(originalLine[:i], " ")))
+		}
+		return &FieldTooLongError{Field: field, Limit: r.MaxFieldBytes}
+	}
+	return &HeaderTooLargeError{Limit: r.MaxHeaderBytes}
+}
+
+// upcomingHeader returns an approximation of the number of newlines
+// that will be in this header and of its size, the blank line included.
+// If it gets confused, it returns 0 newlines.
+func (r *Reader) upcomingHeader() (n, size int) {
 	// Try to determine the 'hint' size.
 	r.R.Peek(1) // force a buffer load if empty
 	s := r.R.Buffered()
@@ -503,15 +691,19 @@ func (r *Reader) upcomingHeaderNewlines() (n int) {
 	peek, _ := r.R.Peek(s)
 	for len(peek) > 0 {
 		i := bytes.IndexByte(peek, '\n')
+		if i < 0 {
+			// the header goes on past the buffered bytes
+			return n, s
+		}
 		if i < 3 {
-			// Not present (-1) or found within the next few bytes,
+			// Found within the next few bytes,
 			// implying we're at the end ("\r\n\r\n" or "\n\n")
-			return
+			return n, s - len(peek) + i + 1
 		}
 		n++
 		peek = peek[i+1:]
 	}
-	return
+	return n, s
 }
 
 // CanonicalMIMEHeaderKey returns the canonical format of the
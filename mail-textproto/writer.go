@@ -0,0 +1,189 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mailtextproto
+
+import (
+	"bufio"
+	"bytes"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// maxLineLength is the length after which the reconstructed header
+// lines are folded (RFC 5322 section 2.1.1).
+const maxLineLength = 78
+
+// A Writer implements convenience methods for writing
+// message headers.
+type Writer struct {
+	W *bufio.Writer
+
+	// Newline ends the reconstructed header lines; "\r\n" if empty.
+	Newline string
+}
+
+// NewWriter returns a new Writer writing to w.
+func NewWriter(w *bufio.Writer) *Writer {
+	return &Writer{W: w}
+}
+
+// WriteMIMEHeader writes a message header followed by the blank line
+// and flushes the writer.
+//
+// If raw is not empty it is the preserved original header and it is
+// written unchanged (a missing blank line is added with the line ending
+// of raw). Otherwise the header is reconstructed from hdr: the fields
+// follow order (the nth occurrence of a name takes the nth value of the
+// field), the fields missing from order follow sorted by name and the
+// long lines are folded at white space.
+func (w *Writer) WriteMIMEHeader(hdr textproto.MIMEHeader, raw []byte, order []string) error {
+	nl := w.newline()
+	if len(raw) > 0 {
+		w.W.Write(raw)
+		switch {
+		case bytes.HasSuffix(raw, []byte("\n\n")), bytes.HasSuffix(raw, []byte("\r\n\r\n")):
+		case bytes.HasSuffix(raw, []byte("\r\n")):
+			w.W.WriteString("\r\n")
+		case bytes.HasSuffix(raw, []byte("\n")):
+			w.W.WriteString("\n")
+		default:
+			w.W.WriteString(nl + nl)
+		}
+		return w.W.Flush()
+	}
+
+	w.W.Write(FormatMIMEHeader(hdr, order, nl))
+	w.W.WriteString(nl)
+	return w.W.Flush()
+}
+
+func (w *Writer) newline() string {
+	if w.Newline == "" {
+		return "\r\n"
+	}
+	return w.Newline
+}
+
+// FormatMIMEHeader returns the header fields of hdr in the order
+// described by WriteMIMEHeader, each line ending with nl; the fields
+// missing from order which have an empty value are skipped.
+func FormatMIMEHeader(hdr textproto.MIMEHeader, order []string, nl string) []byte {
+	var b bytes.Buffer
+	RangeMIMEHeader(hdr, order, func(name, value string, ordered bool) bool {
+		if ordered || value != "" {
+			b.WriteString(FoldHeaderField(name, value, nl))
+			b.WriteString(nl)
+		}
+		return true
+	})
+	return b.Bytes()
+}
+
+// RangeMIMEHeader calls fn for each field value of hdr, first in the
+// order given by order then, for the fields missing from order, sorted
+// by name; ordered tells which group the field is in. The iteration
+// stops when fn returns false.
+func RangeMIMEHeader(hdr textproto.MIMEHeader, order []string, fn func(name, value string, ordered bool) bool) {
+	used := make(map[string]int)
+	for _, name := range order {
+		key := CanonicalMIMEHeaderKey(name)
+		values := hdr[key]
+		if used[key] >= len(values) {
+			continue
+		}
+		value := values[used[key]]
+		used[key]++
+		if !fn(name, value, true) {
+			return
+		}
+	}
+
+	keys := make([]string, 0, len(hdr))
+	for key := range hdr {
+		if used[key] < len(hdr[key]) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range hdr[key][used[key]:] {
+			if !fn(key, value, false) {
+				return
+			}
+		}
+	}
+}
+
+// FoldHeaderField returns the header line "name: value" without its
+// ending; the lines longer than 78 characters are folded at white space
+// with nl. A value already folded, each line break followed by a line
+// starting with white space and not blank, is kept with its line breaks
+// replaced with nl; any other line break is unfolded so the value can't
+// start a new field or end the header.
+func FoldHeaderField(name, value, nl string) string {
+	if strings.ContainsAny(value, "\r\n") {
+		value = strings.ReplaceAll(value, "\r\n", "\n")
+		lines := strings.Split(strings.ReplaceAll(value, "\r", "\n"), "\n")
+		if isFolded(lines) {
+			return name + ": " + strings.Join(lines, nl)
+		}
+		value = unfold(lines)
+	}
+
+	line := name + ": " + value
+	if len(line) <= maxLineLength {
+		return line
+	}
+
+	var b strings.Builder
+	start := 0
+	for len(line)-start > maxLineLength {
+		// the last white space fitting the line, after the field name
+		cut := strings.LastIndexAny(line[start:start+maxLineLength+1], " \t")
+		if cut <= 0 || start+cut <= len(name)+1 {
+			// a long word: fold at the next white space
+			next := strings.IndexAny(line[start+maxLineLength:], " \t")
+			if next == -1 {
+				break
+			}
+			cut = maxLineLength + next
+		}
+		b.WriteString(line[start : start+cut])
+		b.WriteString(nl)
+		start += cut
+	}
+	b.WriteString(line[start:])
+	return b.String()
+}
+
+// isFolded reports whether the lines after the first are continuation
+// lines: starting with white space and not blank.
+func isFolded(lines []string) bool {
+	for _, line := range lines[1:] {
+		if strings.Trim(line, " \t") == "" || (line[0] != ' ' && line[0] != '\t') {
+			return false
+		}
+	}
+	return true
+}
+
+// unfold joins lines into a single line; a line not starting with
+// white space is separated from the previous one by a space and the
+// blank lines are dropped.
+func unfold(lines []string) string {
+	var b strings.Builder
+	b.WriteString(lines[0])
+	for _, line := range lines[1:] {
+		if strings.Trim(line, " \t") == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
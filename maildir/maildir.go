@@ -0,0 +1,179 @@
+package maildir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/axigenmessaging/mailbuilder"
+)
+
+// returned when a key doesn't name a message of the Maildir
+var ErrMessageNotFound = errors.New("maildir: no message with this key")
+
+// the subdirectories of a Maildir
+var subdirs = []string{"tmp", "new", "cur"}
+
+// deliveries made by the process, part of the unique names
+var deliveries uint64
+
+// a Maildir: messages written in tmp/ and moved into new/ when complete
+type Maildir struct {
+	path    string
+	builder mailbuilder.MessageBuilder
+}
+
+// a message stored in the Maildir
+type Entry struct {
+	// the unique name of the message, without the info (":2,flags")
+	Key string
+
+	// the file path
+	Path string
+
+	// true for the messages in new/ (not seen by a reader yet)
+	New bool
+
+	// the flags of the info part (cur/ messages): "S", "RS", ...
+	Flags string
+}
+
+func NewMaildir(path string) *Maildir {
+	return &Maildir{path: path, builder: mailbuilder.NewMessageBuilder()}
+}
+
+// set the builder used by Deliver (newline policy, ...)
+func (m *Maildir) SetBuilder(builder mailbuilder.MessageBuilder) {
+	m.builder = builder
+}
+
+func (m *Maildir) GetBuilder() mailbuilder.MessageBuilder {
+	return m.builder
+}
+
+func (m *Maildir) Path() string {
+	return m.path
+}
+
+// create the tmp, new and cur directories if missing
+func (m *Maildir) Create() error {
+	for _, dir := range subdirs {
+		if err := os.MkdirAll(filepath.Join(m.path, dir), 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// build the message and deliver it; returns its key
+func (m *Maildir) Deliver(msg *mailbuilder.Message) (string, error) {
+	return m.DeliverRaw(m.builder.Build(msg))
+}
+
+/**
+ * deliver a raw message: it is written and synced in tmp/ under a unique
+ * name holding its size (",S=") then moved into new/; returns its key
+ */
+func (m *Maildir) DeliverRaw(raw []byte) (string, error) {
+	key := uniqueName(len(raw))
+	tmpPath := filepath.Join(m.path, "tmp", key)
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(raw)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filepath.Join(m.path, "new", key))
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return key, nil
+}
+
+// return the messages of new/ and cur/ sorted by key
+func (m *Maildir) List() ([]Entry, error) {
+	entries := make([]Entry, 0)
+	for _, dir := range []string{"new", "cur"} {
+		files, err := os.ReadDir(filepath.Join(m.path, dir))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			entries = append(entries, newEntry(filepath.Join(m.path, dir), file.Name(), dir == "new"))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// return the message with the key
+func (m *Maildir) Get(key string) (Entry, error) {
+	entries, err := m.List()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, entry := range entries {
+		if entry.Key == key {
+			return entry, nil
+		}
+	}
+	return Entry{}, ErrMessageNotFound
+}
+
+// read the message
+func (e Entry) Read() ([]byte, error) {
+	return os.ReadFile(e.Path)
+}
+
+// read and decompose the message
+func (e Entry) Decompose(d *mailbuilder.MessageDecomposer) (*mailbuilder.Message, error) {
+	raw, err := e.Read()
+	if err != nil {
+		return nil, err
+	}
+	return d.Decompose(raw, "")
+}
+
+// describe a file of new/ or cur/
+func newEntry(dir, name string, isNew bool) Entry {
+	entry := Entry{Key: name, Path: filepath.Join(dir, name), New: isNew}
+	if i := strings.Index(name, ":2,"); i != -1 {
+		entry.Key = name[:i]
+		entry.Flags = name[i+3:]
+	}
+	return entry
+}
+
+/**
+ * return a unique file name: time, microseconds, process and delivery
+ * counter, host name (with '/' and ':' escaped) and the message size
+ */
+func uniqueName(size int) string {
+	now := time.Now()
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+	n := atomic.AddUint64(&deliveries, 1)
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s,S=%d", now.Unix(), now.Nanosecond()/1000, os.Getpid(), n, host, size)
+}
@@ -0,0 +1,128 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// returned when the input doesn't start with a "From " line
+var ErrNotMbox = errors.New("mbox: the input doesn't start with a From line")
+
+/**
+ * read the messages of an mbox archive; a message starts with a "From "
+ * line at the beginning of the input or after a blank line, the blank line
+ * ending the previous message is not part of it; the quoted ">From " lines
+ * (">>From ", ... as written by mboxrd) lose one '>'
+ */
+type Reader struct {
+	r *bufio.Reader
+
+	// the "From " line of the next message, read with the previous one
+	next []byte
+
+	// the "From " line of the last returned message
+	separator []byte
+
+	started bool
+	done    bool
+}
+
+func NewMboxReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+/**
+ * return the next raw message, ready for MessageDecomposer.Decompose;
+ * io.EOF when there are no more messages
+ */
+func (m *Reader) Next() ([]byte, error) {
+	if !m.started {
+		m.started = true
+		line, err := m.readLine()
+		if len(line) == 0 && err == io.EOF {
+			m.done = true
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if !isSeparator(line) {
+			return nil, ErrNotMbox
+		}
+		m.next = line
+	}
+	if m.done || m.next == nil {
+		return nil, io.EOF
+	}
+
+	m.separator = bytes.TrimRight(m.next, "\r\n")
+	m.next = nil
+
+	var message bytes.Buffer
+	blank := false
+	for {
+		line, err := m.readLine()
+		if blank && isSeparator(line) {
+			m.next = line
+			break
+		}
+		if len(line) > 0 {
+			blank = len(bytes.TrimRight(line, "\r\n")) == 0
+			message.Write(unquoteFrom(line))
+		}
+		if err == io.EOF {
+			m.done = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := message.Bytes()
+	if m.next != nil {
+		// the blank line before the next "From " belongs to the mbox format
+		data = trimBlankLine(data)
+	}
+	return data, nil
+}
+
+// return the "From " line (without the line ending) of the last message returned by Next
+func (m *Reader) Separator() string {
+	return string(m.separator)
+}
+
+// read a line with its line ending
+func (m *Reader) readLine() ([]byte, error) {
+	return m.r.ReadBytes('\n')
+}
+
+// check if a line separates the messages
+func isSeparator(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+// remove one '>' from the quoted "From " lines
+func unquoteFrom(line []byte) []byte {
+	i := 0
+	for i < len(line) && line[i] == '>' {
+		i++
+	}
+	if i > 0 && bytes.HasPrefix(line[i:], []byte("From ")) {
+		return line[1:]
+	}
+	return line
+}
+
+// remove the last blank line of a message
+func trimBlankLine(data []byte) []byte {
+	if bytes.HasSuffix(data, []byte("\r\n")) {
+		return data[:len(data)-2]
+	}
+	if bytes.HasSuffix(data, []byte("\n")) {
+		return data[:len(data)-1]
+	}
+	return data
+}
@@ -0,0 +1,105 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/axigenmessaging/mailbuilder"
+)
+
+// the quoting of the "From " lines of the bodies
+type Format int
+
+const (
+	// ">From " lines are quoted too, so the reading restores every line
+	MboxRD Format = iota
+
+	// only the "From " lines are quoted; the reading can't tell them from the ">From " ones
+	MboxO
+)
+
+// append messages to an mbox archive
+type Writer struct {
+	w       io.Writer
+	format  Format
+	builder mailbuilder.MessageBuilder
+}
+
+func NewMboxWriter(w io.Writer) *Writer {
+	return &Writer{w: w, builder: mailbuilder.NewMessageBuilder()}
+}
+
+func (m *Writer) SetFormat(format Format) {
+	m.format = format
+}
+
+func (m *Writer) GetFormat() Format {
+	return m.format
+}
+
+// set the builder used by Append (newline policy, ...)
+func (m *Writer) SetBuilder(builder mailbuilder.MessageBuilder) {
+	m.builder = builder
+}
+
+func (m *Writer) GetBuilder() mailbuilder.MessageBuilder {
+	return m.builder
+}
+
+/**
+ * build the message and append it with its "From " line (envelope sender
+ * and delivery date) and the blank line separating it from the next one
+ */
+func (m *Writer) Append(msg *mailbuilder.Message, envelopeFrom string, date time.Time) error {
+	return m.AppendRaw(m.builder.Build(msg), envelopeFrom, date)
+}
+
+// append a raw message; the lines of the message use the line ending of its first line
+func (m *Writer) AppendRaw(raw []byte, envelopeFrom string, date time.Time) error {
+	nl := "\n"
+	if i := bytes.IndexByte(raw, '\n'); i > 0 && raw[i-1] == '\r' {
+		nl = "\r\n"
+	}
+
+	envelopeFrom = strings.Join(strings.Fields(envelopeFrom), "")
+	if envelopeFrom == "" {
+		envelopeFrom = "MAILER-DAEMON"
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(raw) + 128)
+	b.WriteString("From " + envelopeFrom + " " + date.UTC().Format(time.ANSIC) + nl)
+	for pos := 0; pos < len(raw); {
+		next := len(raw)
+		if i := bytes.IndexByte(raw[pos:], '\n'); i != -1 {
+			next = pos + i + 1
+		}
+		line := raw[pos:next]
+		if m.needsQuoting(line) {
+			b.WriteByte('>')
+		}
+		b.Write(line)
+		pos = next
+	}
+	if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+		b.WriteString(nl)
+	}
+	b.WriteString(nl)
+
+	_, err := m.w.Write(b.Bytes())
+	return err
+}
+
+// check if a line of a message has to be quoted with '>'
+func (m *Writer) needsQuoting(line []byte) bool {
+	if m.format == MboxO {
+		return bytes.HasPrefix(line, []byte("From "))
+	}
+	i := 0
+	for i < len(line) && line[i] == '>' {
+		i++
+	}
+	return bytes.HasPrefix(line[i:], []byte("From "))
+}
@@ -0,0 +1,250 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
+)
+
+var (
+	ErrNotMDN = errors.New("mailbuilder: not a message disposition notification")
+
+	// returned by NewMDN for a message without Disposition-Notification-To
+	ErrNoMDNRequest = errors.New("mailbuilder: the message doesn't request a disposition notification")
+
+	ErrInvalidDisposition = errors.New("mailbuilder: invalid disposition (mode or type)")
+)
+
+var mdnActionModes = map[string]bool{"manual-action": true, "automatic-action": true}
+var mdnSendingModes = map[string]bool{"mdn-sent-manually": true, "mdn-sent-automatically": true}
+var mdnDispositionTypes = map[string]bool{"displayed": true, "deleted": true, "dispatched": true, "processed": true}
+
+// a message disposition notification (RFC 8098)
+type Disposition struct {
+	// the user agent and the addresses without their type ("rfc822;")
+	ReportingUA       string
+	OriginalRecipient string
+	FinalRecipient    string
+
+	OriginalMessageID string
+
+	// manual-action or automatic-action, MDN-sent-manually or MDN-sent-automatically
+	ActionMode  string
+	SendingMode string
+
+	// displayed, deleted, dispatched or processed, with its modifiers ("error")
+	Type      string
+	Modifiers []string
+
+	// the Error field
+	Error string
+
+	// the human readable explanation
+	Text string
+
+	// the original message or only its header; nil if not returned
+	Original *Message
+}
+
+// options of NewMDN
+type MDNOptions struct {
+	// the user agent sending the notification ("host; product")
+	ReportingUA string
+
+	// the sender of the notification and the recipient of the original message
+	From string
+
+	// displayed (default), deleted, dispatched or processed
+	Type string
+
+	// the notification is sent automatically (without asking the user) and the
+	// disposition was done automatically
+	AutomaticSending bool
+	AutomaticAction  bool
+
+	// the human readable explanation; generated by default
+	Text string
+
+	// return the whole message instead of its header
+	ReturnFull bool
+}
+
+// the Disposition field value: "action-mode/sending-mode; type[/modifier,...]"
+func (d *Disposition) Format() string {
+	value := d.ActionMode + "/" + d.SendingMode + "; " + d.Type
+	if len(d.Modifiers) > 0 {
+		value += "/" + strings.Join(d.Modifiers, ",")
+	}
+	return value
+}
+
+/**
+ * create a message disposition notification (RFC 8098) answering the
+ * Disposition-Notification-To of orig: a multipart/report with the human
+ * readable text, the message/disposition-notification part and the original
+ * message (ReturnFull) or its header
+ */
+func NewMDN(orig *Message, opts MDNOptions) (*Message, error) {
+	to := envelopeAddresses(orig.GetHeader("Disposition-Notification-To"))
+	if len(to) == 0 {
+		return nil, ErrNoMDNRequest
+	}
+
+	d := Disposition{
+		ReportingUA:       opts.ReportingUA,
+		OriginalRecipient: dsnTypedValue(orig.GetHeader("Original-Recipient")),
+		FinalRecipient:    opts.From,
+		OriginalMessageID: strings.TrimSpace(orig.GetHeader("Message-ID")),
+		ActionMode:        "manual-action",
+		SendingMode:       "MDN-sent-manually",
+		Type:              strings.ToLower(opts.Type),
+	}
+	if address := envelopeAddresses(opts.From); len(address) == 1 {
+		d.FinalRecipient = address[0].Address
+	}
+	if d.Type == "" {
+		d.Type = "displayed"
+	}
+	if !mdnDispositionTypes[d.Type] || d.FinalRecipient == "" {
+		return nil, ErrInvalidDisposition
+	}
+	if opts.AutomaticAction {
+		d.ActionMode = "automatic-action"
+	}
+	if opts.AutomaticSending {
+		d.SendingMode = "MDN-sent-automatically"
+	}
+
+	m := NewMessage()
+	m.SetDate(time.Now())
+	m.SetHeaderField("From", opts.From)
+	m.SetHeaderField("To", to[0].String())
+	m.SetHeaderField("Subject", "Disposition notification ("+d.Type+")")
+	m.SetHeaderField("Message-ID", GenerateMessageID(addressDomain(d.FinalRecipient)))
+	if d.OriginalMessageID != "" {
+		m.SetHeaderField("In-Reply-To", d.OriginalMessageID)
+		m.SetHeaderField("References", d.OriginalMessageID)
+	}
+	if opts.AutomaticSending {
+		m.SetHeaderField("Auto-Submitted", "auto-replied")
+	}
+	m.SetHeaderField("MIME-Version", "1.0")
+	m.setMultipartContentType("report", map[string]string{"report-type": "disposition-notification"})
+
+	text := opts.Text
+	if text == "" {
+		text = "The message sent to " + d.FinalRecipient + " was " + d.Type + "."
+		if subject := strings.TrimSpace(decodeHeaderWords(orig.GetHeader("Subject"))); subject != "" {
+			text = "The message \"" + subject + "\" sent to " + d.FinalRecipient + " was " + d.Type + "."
+		}
+		text += "\r\n"
+	}
+	m.AddPart(NewTextPart(text))
+	m.AddPart(NewPart("message/disposition-notification", d.fields(), "7bit"))
+
+	if err := addReported(m, orig, opts.ReturnFull); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// the body of the disposition notification part
+func (d *Disposition) fields() []byte {
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if value != "" {
+			b.WriteString(mailtextproto.FoldHeaderField(name, value, "\r\n") + "\r\n")
+		}
+	}
+	if d.ReportingUA != "" {
+		field("Reporting-UA", d.ReportingUA)
+	}
+	if d.OriginalRecipient != "" {
+		field("Original-Recipient", "rfc822; "+d.OriginalRecipient)
+	}
+	field("Final-Recipient", "rfc822; "+d.FinalRecipient)
+	field("Original-Message-ID", d.OriginalMessageID)
+	field("Disposition", d.Format())
+	field("Error", d.Error)
+	return b.Bytes()
+}
+
+/**
+ * parse a message disposition notification: the first multipart/report with
+ * report-type=disposition-notification of the message
+ */
+func ParseMDN(m *Message) (*Disposition, error) {
+	report := findReport(m, "disposition-notification")
+	if report == nil {
+		return nil, ErrNotMDN
+	}
+
+	d := &Disposition{}
+	found := false
+	for i, p := range report.Parts {
+		switch mediaType := p.MediaType(); {
+		case i == 0 && strings.HasPrefix(mediaType, "text/"):
+			d.Text, _ = p.DecodedText()
+
+		case mediaType == "message/disposition-notification" || mediaType == "message/global-disposition-notification":
+			body, err := p.DecodedBody()
+			if err != nil {
+				return nil, err
+			}
+			groups := dsnFieldGroups(body)
+			if len(groups) == 0 {
+				return nil, ErrNotMDN
+			}
+			fields := groups[0]
+			d.ReportingUA = strings.TrimSpace(fields.Get("Reporting-Ua"))
+			d.OriginalRecipient = dsnTypedValue(fields.Get("Original-Recipient"))
+			d.FinalRecipient = dsnTypedValue(fields.Get("Final-Recipient"))
+			d.OriginalMessageID = strings.TrimSpace(fields.Get("Original-Message-Id"))
+			d.Error = strings.TrimSpace(fields.Get("Error"))
+			if err := d.parseDisposition(fields.Get("Disposition")); err != nil {
+				return nil, err
+			}
+			found = true
+
+		case p.IsRfc822() || reportedMediaTypes[mediaType]:
+			d.Original = reportedMessage(p)
+		}
+	}
+	if !found {
+		return nil, ErrNotMDN
+	}
+	return d, nil
+}
+
+// parse "action-mode/sending-mode; type[/modifier,...]"
+func (d *Disposition) parseDisposition(value string) error {
+	if c := strings.IndexByte(value, '('); c != -1 {
+		// a comment ends the field
+		value = value[:c]
+	}
+	i := strings.IndexByte(value, ';')
+	if i == -1 {
+		return ErrInvalidDisposition
+	}
+	modes := strings.SplitN(value[:i], "/", 2)
+	if len(modes) != 2 {
+		return ErrInvalidDisposition
+	}
+	d.ActionMode = strings.TrimSpace(modes[0])
+	d.SendingMode = strings.TrimSpace(modes[1])
+
+	dispositionType, modifiers, _ := strings.Cut(value[i+1:], "/")
+	d.Type = strings.ToLower(strings.TrimSpace(dispositionType))
+	for _, modifier := range strings.Split(modifiers, ",") {
+		if modifier = strings.TrimSpace(modifier); modifier != "" {
+			d.Modifiers = append(d.Modifiers, strings.ToLower(modifier))
+		}
+	}
+	if !mdnActionModes[strings.ToLower(d.ActionMode)] || !mdnSendingModes[strings.ToLower(d.SendingMode)] || !mdnDispositionTypes[d.Type] {
+		return ErrInvalidDisposition
+	}
+	return nil
+}
@@ -4,8 +4,12 @@ import (
 	"net/textproto"
 	"strings"
 	"bytes"
-	"bufio"
+	"mime"
+	"crypto/sha256"
+	"unicode/utf8"
 	//"fmt"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
 )
 
 type Message struct {
@@ -16,6 +20,13 @@ type Message struct {
 	// original raw header extracted with decomposer
 	RawOriginalHeader []byte
 
+	// the bytes between the raw header and the body: the ending of the last
+	// field and the blank line
+	HeaderTerminator  []byte
+
+	// the line ending of the message ("\r\n" or "\n"), found when decomposing
+	Newline           string
+
 	// original headers orders
 	HeaderOrder       []string
 
@@ -30,16 +41,73 @@ type Message struct {
 
 	// boundary used for multiparts
 	Boundary          string
+
+	// lower case subtype of a multipart (mixed, alternative, parallel,
+	// x-mixed-replace or an unknown one); used by the builder when the
+	// Content-Type has to be written again
+	MultipartSubtype  string
+
+	// multipart: the bytes before the first boundary line and after the
+	// final boundary line
+	Preamble          []byte
+	Epilogue          []byte
+
+	// the raw boundary line before the part (with the line ending of the
+	// previous part body) and, for multiparts, the raw final boundary line
+	RawDelimiter      []byte
+	RawCloseDelimiter []byte
+
+	// stable address of the part: assigned when decomposing (or adding the
+	// part) and kept when siblings are inserted or removed; see CurrentIdx
 	Idx               string
 
 	// specify if the message body is mime decoded
 	IsDecoded         bool
 
+	// the original encoded body of a decoded message/rfc822 part; written
+	// back unchanged while the inner message builds to the same content
+	RawBody           []byte
+	decodedBodySum    [sha256.Size]byte
+
+	// sha256 of the content of a decomposed multipart: built the same, it
+	// keeps its boundary (see MessageBuilder.withSafeBoundaries)
+	contentSum        []byte
+
+	// problems found while decoding the message (broken encodings, ...)
+	Warnings          []string
+
+	// transfer encoding guessed for a body sent without one (see
+	// MessageDecomposer.SetDetectEncoding); never applied automatically
+	SuggestedEncoding string
+
+	// charset found by a CharsetDetector when it differs from the declared
+	// one; trusted over the Content-Type by the text converters
+	DetectedCharset   string
+
 	// rfc822 depth
 	rfc822Depth       int
 
 	// the parent of the Message/Part
 	Parent       *Message
+
+	// the SMTP transaction carrying the message (root only, nil if unknown);
+	// never written in the header, see MessageBuilder.SetSyncReturnPath
+	SMTPEnvelope      *SMTPEnvelope
+
+	// last number used for the Idx of a child part
+	lastPartIdx       int64
+
+	// the raw header not parsed yet (only the Content-* fields are in Header)
+	lazyHeader        *HeaderView
+
+	// the header changes recorded as milter operations (see RecordChanges)
+	changes           *milterLog
+
+	// what the changes of the signed content do (root only, see ProtectSignatures)
+	signatureProtection SignatureProtection
+
+	// the body kept by a BodyStore while Body is empty (see BodyReader)
+	storedBody        StoredBody
 }
 
 // check if the message is multipart
@@ -52,6 +120,9 @@ func (c *Message) IsMultipart() bool {
 
 // append a part to message
 func (c *Message) AddPart(p *Message) {
+	if p.Idx == "" {
+		p.Idx = c.newPartIdx()
+	}
 	p.Parent = c
 	c.Parts = append(c.Parts, p)
 }
@@ -61,40 +132,182 @@ func (c *Message) IsRfc822() bool {
 	return  c.BodyMessage != nil
 }
 
+// visit the message and its descendants (parts and rfc822 body) depth first;
+// when fn returns false the children of that node are skipped
+func (c *Message) Walk(fn func(p *Message) bool) {
+	if !fn(c) {
+		return
+	}
+	if c.BodyMessage != nil {
+		c.BodyMessage.Walk(fn)
+	}
+	for _, p := range c.Parts {
+		p.Walk(fn)
+	}
+}
 
-// set the original header when decompose
-func (c *Message) SetOriginalHeaderOrder(body []byte) {
-	bReader := bytes.NewReader(body)
-	r := bufio.NewReader(bReader)
+// return the lower case media type from Content-Type; text/plain if missing
+func (c *Message) MediaType() string {
+	contentType := c.Header.Get("Content-Type")
+	if strings.TrimSpace(contentType) == "" {
+		return "text/plain"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// keep what is before the parameters
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mediaType
+}
 
+// return the lower case Content-Transfer-Encoding
+func (c *Message) ContentTransferEncoding() string {
+	return strings.ToLower(strings.TrimSpace(c.Header.Get("Content-Transfer-Encoding")))
+}
+
+// return the body decoded according to the Content-Transfer-Encoding; a stored body is kept by its store
+func (c *Message) DecodedBody() ([]byte, error) {
+	if c.IsBodyStored() {
+		return c.decodeStoredBody()
+	}
+	data, _, warnings, err := DecodeByContentEncodingWithWarnings(c.Body, c.ContentTransferEncoding())
+	c.AddWarnings(warnings...)
+	return data, err
+}
+
+// record decoding problems; a warning already recorded is not added again
+func (c *Message) AddWarnings(warnings ...string) {
+	for _, warning := range warnings {
+		found := false
+		for _, existing := range c.Warnings {
+			if existing == warning {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Warnings = append(c.Warnings, warning)
+		}
+	}
+}
+
+/**
+ * replace the body with data encoded using the Content-Transfer-Encoding;
+ * the headers are kept consistent with the new content: a 7bit (or missing)
+ * encoding is upgraded to quoted-printable or base64 for 8-bit data or too
+ * long lines and a text declared as us-ascii becomes utf-8 for UTF-8 data
+ */
+func (c *Message) SetDecodedBody(data []byte) {
+	c.dropStoredBody()
+	text := strings.HasPrefix(c.MediaType(), "text/")
+
+	cte := c.ContentTransferEncoding()
+	longLines := hasLongLines(string(data), 998)
+	if ((cte == "" || cte == "7bit") && (has8Bit(data) || longLines)) || (cte == "8bit" && longLines) {
+		cte = "base64"
+		if text && mostlyASCII(data) {
+			cte = "quoted-printable"
+		}
+		c.SetHeaderField("Content-Transfer-Encoding", cte)
+	}
+
+	if text && has8Bit(data) && isUTF8Compatible(c.Charset()) && c.Charset() != "utf-8" && utf8.Valid(data) {
+		c.setContentTypeParam("charset", "utf-8")
+	}
+
+	if text && cte == "quoted-printable" {
+		// keep the text line breaks
+		c.Body = EncodeQuotedPrintableText(data)
+		return
+	}
+	c.Body = EncodeByContentEncoding(data, cte)
+}
+
+// set a header field keeping the original raw header in sync
+func (c *Message) SetHeaderField(field, value string) {
+	// the added lines use the line ending of the message
+	b := MessageBuilder{}
+	b.SetHeaderField(c, field, value)
+}
+
+
+// set the original header when decompose; the raw header is kept byte for
+// byte, the line ending of the last field and the blank line apart
+func (c *Message) SetOriginalHeaderOrder(body []byte) {
 	c.HeaderOrder = make([]string, 0)
 
-	for {
-		lineByte, _, err := r.ReadLine()
-		lineString := string(lineByte)
+	end := 0
+	for pos := 0; pos < len(body); {
+		next := len(body)
+		if i := bytes.IndexByte(body[pos:], '\n'); i != -1 {
+			next = pos + i + 1
+		}
+		line := bytes.TrimRight(body[pos:next], "\r\n")
+		pos = next
 
-		if err != nil {
+		if len(line) == 0 {
+			// the blank line ends the header
+			end = next
 			break
 		}
-		if len(lineString) > 0 {
-			lineParts := strings.Split(lineString, ":")
-			if !strings.HasPrefix(lineParts[0], " ") && !strings.HasPrefix(lineParts[0], "\t") {
-				c.HeaderOrder = append(c.HeaderOrder, strings.Trim(lineParts[0], ""))
-			}
-		} else {
-			//fmt.Println("BREAK EMPTY LINE", len(lineString))
-			break
+		if line[0] != ' ' && line[0] != '\t' {
+			lineParts := strings.Split(string(line), ":")
+			c.HeaderOrder = append(c.HeaderOrder, lineParts[0])
 		}
+		end = next
+	}
 
-		if len(c.RawOriginalHeader) > 0 {
-			c.RawOriginalHeader = append(c.RawOriginalHeader, []byte("\n")...)
+	header := bytes.TrimRight(body[:end], "\r\n")
+	c.RawOriginalHeader = append(c.RawOriginalHeader, header...)
+	c.HeaderTerminator = append([]byte(nil), body[len(header):end]...)
+}
+
+// insert a header field at the top of the header keeping the original raw header in sync
+func (c *Message) PrependHeaderField(field, value string) {
+	b := MessageBuilder{}
+	b.PrependHeaderField(c, field, value)
+}
+
+// add an occurrence of a header field keeping the original raw header in sync
+func (c *Message) AddHeaderField(field, value string) {
+	b := MessageBuilder{}
+	b.AddHeaderField(c, field, value)
+}
+
+// remove a header field keeping the original raw header in sync
+func (c *Message) DelHeaderField(field string) {
+	b := MessageBuilder{}
+	b.DelHeaderField(c, field)
+}
+
+// return the header order; parts only have the order of their raw header
+func (c *Message) headerOrder() []string {
+	if len(c.HeaderOrder) > 0 || len(c.RawOriginalHeader) == 0 {
+		return c.HeaderOrder
+	}
+	order := make([]string, 0)
+	for _, line := range bytes.Split(c.RawOriginalHeader, []byte("\n")) {
+		if len(line) == 0 || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if i := bytes.IndexByte(line, ':'); i > 0 {
+			order = append(order, strings.TrimRight(string(line[:i]), " \t"))
 		}
-		c.RawOriginalHeader = append(c.RawOriginalHeader, lineByte...)
 	}
+	return order
+}
+
+// call fn for each header field value in the original order (see HeadersInOrder) until it returns false
+func (c *Message) rangeHeaders(fn func(name, value string) bool) {
+	c.LoadHeader()
+	mailtextproto.RangeMIMEHeader(c.Header, c.headerOrder(), func(name, value string, ordered bool) bool {
+		return fn(name, value)
+	})
 }
 
 // copy into c Message the properties from m Message
 func (c *Message) Merge(m *Message) {
+	c.LoadHeader()
 	// keep the original headers, and rewrite only the new ones
 	for key, val := range m.Header {
 		if val[0] != "" {
@@ -106,6 +319,10 @@ func (c *Message) Merge(m *Message) {
 
 	c.BodyMessage  = m.BodyMessage
 	c.Body  = m.Body
+	if c.storedBody != m.storedBody {
+		c.dropStoredBody()
+	}
+	c.storedBody = m.storedBody
 	c.Boundary  = m.Boundary
 	c.Parts = m.Parts
 	c.HeaderIsChanged = true
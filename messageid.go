@@ -0,0 +1,51 @@
+package mailbuilder
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * return a new Message-ID value for domain ("localhost" if empty):
+ * "<time.random@domain>" with the time in base 36 and 96 random bits,
+ * so two ids collide only if generated in the same nanosecond with the
+ * same random bits
+ */
+func GenerateMessageID(domain string) string {
+	domain = strings.Trim(strings.TrimSpace(domain), "<>@")
+	if domain == "" {
+		domain = "localhost"
+	}
+	var buf [12]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		panic(err)
+	}
+	return "<" + strconv.FormatInt(time.Now().UnixNano(), 36) + "." + hex.EncodeToString(buf[:]) + "@" + domain + ">"
+}
+
+/**
+ * set a generated Message-ID (see GenerateMessageID) on the built messages
+ * without one; each build of such a message gets a new id, set it on the
+ * message to keep it; "" (default) disables the generation
+ */
+func (c *MessageBuilder) SetMessageIDDomain(domain string) {
+	c.messageIDDomain = domain
+}
+
+func (c *MessageBuilder) GetMessageIDDomain() string {
+	return c.messageIDDomain
+}
+
+// return m with a generated Message-ID if it has none; m itself is not modified
+func withMessageID(m *Message, domain string) *Message {
+	if strings.TrimSpace(m.GetHeader("Message-Id")) != "" {
+		return m
+	}
+	root := copyRootHeader(m)
+	root.SetHeaderField("Message-ID", GenerateMessageID(domain))
+	return root
+}
@@ -0,0 +1,114 @@
+package mailbuilder
+
+import (
+	"crypto/sha256"
+)
+
+// a milter message modification (the smfi_* library calls)
+type MilterCommand string
+
+const (
+	// add a header field at the end of the header (smfi_addheader)
+	MilterAddHeader MilterCommand = "addheader"
+
+	// insert a header field at a position of the header, 0 for the top (smfi_insheader)
+	MilterInsertHeader MilterCommand = "insheader"
+
+	// change the nth occurrence of a header field, an empty value removes it (smfi_chgheader)
+	MilterChangeHeader MilterCommand = "chgheader"
+
+	// replace the body (smfi_replacebody)
+	MilterReplaceBody MilterCommand = "replacebody"
+)
+
+// a modification to send to the MTA instead of the whole rebuilt message
+type MilterOp struct {
+	Command MilterCommand
+
+	// the header field name and value (addheader, chgheader)
+	Name  string
+	Value string
+
+	// 1-based occurrence of the header field (chgheader) or the
+	// position of the inserted field (insheader)
+	Index int
+
+	// the new body, CRLF line endings (replacebody)
+	Body []byte
+}
+
+// the recorded header changes and the sum of the body when the recording started
+type milterLog struct {
+	ops     []MilterOp
+	bodySum [sha256.Size]byte
+}
+
+func (l *milterLog) setHeader(field, value string, exists bool) {
+	if l == nil {
+		return
+	}
+	if exists {
+		// the first occurrence is replaced in the raw header
+		l.ops = append(l.ops, MilterOp{Command: MilterChangeHeader, Name: field, Value: value, Index: 1})
+		return
+	}
+	l.ops = append(l.ops, MilterOp{Command: MilterAddHeader, Name: field, Value: value})
+}
+
+func (l *milterLog) prependHeader(field, value string) {
+	if l == nil {
+		return
+	}
+	l.ops = append(l.ops, MilterOp{Command: MilterInsertHeader, Name: field, Value: value})
+}
+
+func (l *milterLog) delHeader(field string, occurrences int) {
+	if l == nil {
+		return
+	}
+	// the last occurrence first so the indexes stay valid
+	for i := occurrences; i > 0; i-- {
+		l.ops = append(l.ops, MilterOp{Command: MilterChangeHeader, Name: field, Index: i})
+	}
+}
+
+/**
+ * start recording the modifications of the message (the root of a
+ * decomposed message) as milter operations: the header fields set,
+ * added, inserted or removed with SetHeaderField, AddHeaderField,
+ * PrependHeaderField and DelHeaderField and the changes of the body
+ * (parts, attachments, texts, ...); the changes made directly to the
+ * Header map are not recorded. See MilterOps
+ */
+func (c *Message) RecordChanges() {
+	c.changes = &milterLog{bodySum: sha256.Sum256(milterBody(c))}
+}
+
+// stop recording the modifications
+func (c *Message) StopRecordingChanges() {
+	c.changes = nil
+}
+
+/**
+ * return the milter operations turning the message as it was when
+ * RecordChanges was called into the current message: the header
+ * operations in the order they were made followed by a replacebody if
+ * the body changed; nil if the changes are not recorded
+ */
+func (c *Message) MilterOps() []MilterOp {
+	if c.changes == nil {
+		return nil
+	}
+	ops := append([]MilterOp(nil), c.changes.ops...)
+	if body := milterBody(c); sha256.Sum256(body) != c.changes.bodySum {
+		ops = append(ops, MilterOp{Command: MilterReplaceBody, Body: body})
+	}
+	return ops
+}
+
+// the body as the MTA has it, with CRLF line endings
+func milterBody(m *Message) []byte {
+	b := NewMessageBuilder()
+	b.SetNormalizeNewlines(true)
+	return append([]byte(nil), b.bodyBlock(m)...)
+}
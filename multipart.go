@@ -0,0 +1,90 @@
+package mailbuilder
+
+import (
+	"mime"
+	"strings"
+)
+
+// multipart subtypes with a meaning of their own (RFC 2046, RFC 1847, RFC 2387, ...)
+var knownMultipartSubtypes = map[string]bool{
+	"mixed":           true,
+	"alternative":     true,
+	"digest":          true,
+	"parallel":        true,
+	"related":         true,
+	"signed":          true,
+	"encrypted":       true,
+	"report":          true,
+	"x-mixed-replace": true,
+	"appledouble":     true,
+	"voice-message":   true,
+	"form-data":       true,
+}
+
+// return the subtype of a multipart media type, "" for the other media types
+func multipartSubtype(mediaType string) string {
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return ""
+	}
+	return strings.TrimPrefix(mediaType, "multipart/")
+}
+
+/**
+ * check if the message is a multipart of an unknown subtype; RFC 2046 asks
+ * to handle these as multipart/mixed, which is what the text and attachment
+ * helpers do
+ */
+func (c *Message) IsUnknownMultipart() bool {
+	if !c.IsMultipart() {
+		return false
+	}
+	subtype := c.MultipartSubtype
+	if subtype == "" {
+		subtype = multipartSubtype(c.MediaType())
+	}
+	return !knownMultipartSubtypes[subtype]
+}
+
+/**
+ * be sure the Content-Type of a multipart declares its boundary: a missing
+ * boundary is generated and a Content-Type lost or not multipart is written
+ * again with the tracked subtype (mixed if unknown) and a valid boundary
+ * (see ValidateBoundary), quoted when it has specials
+ */
+func (c *Message) ensureMultipartContentType() {
+	if c.Boundary == "" {
+		c.Boundary = RandomBoundary()
+	}
+
+	if c.declaresBoundary() {
+		return
+	}
+	mediaType, params, err := mime.ParseMediaType(c.Header.Get("Content-Type"))
+
+	if ValidateBoundary(c.Boundary) != nil {
+		// the Content-Type is written again: use a valid boundary
+		c.Boundary = RandomBoundary()
+	}
+	subtype := c.MultipartSubtype
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		subtype = multipartSubtype(mediaType)
+	} else {
+		// the parameters of another media type don't apply
+		params = make(map[string]string)
+	}
+	if subtype == "" {
+		subtype = "mixed"
+	}
+	params["boundary"] = c.Boundary
+	c.MultipartSubtype = subtype
+	c.SetHeaderField("Content-Type", mime.FormatMediaType("multipart/"+subtype, params))
+}
+
+// check if the Content-Type is a multipart one declaring the boundary
+func (c *Message) declaresBoundary() bool {
+	if c.Boundary == "" {
+		return false
+	}
+	mediaType, params, err := mime.ParseMediaType(c.Header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "multipart/") && params["boundary"] == c.Boundary
+}
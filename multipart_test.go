@@ -0,0 +1,45 @@
+package mailbuilder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMultipartSubtypes(t *testing.T) {
+	tests := []struct {
+		subtype string
+		unknown bool
+		text    string
+	}{
+		{"x-mixed-replace", false, "frame 2"},
+		{"parallel", false, "frame 1\n\nframe 2"},
+		{"X-Unknown", true, "frame 1\n\nframe 2"},
+	}
+	for _, test := range tests {
+		raw := "Content-Type: multipart/" + test.subtype + "; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: text/plain\r\n\r\nframe 1\r\n--b\r\nContent-Type: text/plain\r\n\r\nframe 2\r\n--b--\r\n"
+		d := NewMessageDecomposer()
+		m, err := d.Decompose([]byte(raw), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		subtype := strings.ToLower(test.subtype)
+		if len(m.Parts) != 2 || m.MultipartSubtype != subtype || m.IsUnknownMultipart() != test.unknown {
+			t.Errorf("%s: got %d parts of subtype %q (unknown %v)", test.subtype, len(m.Parts), m.MultipartSubtype, m.IsUnknownMultipart())
+		}
+		if text, err := ExtractText(m); err != nil || text != test.text {
+			t.Errorf("%s: got text %q, %v", test.subtype, text, err)
+		}
+		b := NewMessageBuilder()
+		if out := string(b.Build(m)); out != raw {
+			t.Errorf("%s: rebuilt as %q", test.subtype, out)
+		}
+
+		// a lost Content-Type is written again with the tracked subtype
+		m.DelHeaderField("Content-Type")
+		if out := string(b.Build(m)); !strings.HasPrefix(out, "Content-Type: multipart/"+subtype+"; boundary=b\r\n") {
+			t.Errorf("%s: rebuilt without Content-Type as %q", test.subtype, out)
+		}
+	}
+}
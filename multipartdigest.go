@@ -0,0 +1,52 @@
+package mailbuilder
+
+import (
+	"strconv"
+	"strings"
+)
+
+/**
+ * create a digest of messages (RFC 2046 section 5.1.5): a multipart/mixed
+ * with a text/plain table of contents (number, subject, sender and date of
+ * each message) followed by the multipart/digest; the digest parts have no
+ * header so they are message/rfc822 by default and hold a copy of each
+ * message as it is built; the message header (Subject, From, ...) is left
+ * to the caller
+ */
+func NewDigest(messages []*Message) (*Message, error) {
+	digest := NewMultipart("digest", nil)
+	d := NewMessageDecomposer()
+	b := MessageBuilder{}
+
+	contents := make([]string, 0, len(messages))
+	for i, msg := range messages {
+		p := NewMessage()
+		p.Idx = digest.newPartIdx()
+		inner, err := d.Decompose(b.Build(msg), p.Idx+"-0")
+		if err != nil {
+			return nil, err
+		}
+		inner.Parent = p
+		inner.rfc822Depth = 1
+		p.BodyMessage = inner
+		digest.AddPart(p)
+
+		entry := strconv.Itoa(i+1) + ". " + strings.TrimSpace(decodeHeaderWords(msg.GetHeader("Subject")))
+		var details []string
+		if from := strings.TrimSpace(decodeHeaderWords(msg.GetHeader("From"))); from != "" {
+			details = append(details, from)
+		}
+		if date, ok := msg.Date(); ok {
+			details = append(details, date.Format("2 Jan 2006 15:04"))
+		}
+		if len(details) > 0 {
+			entry += " (" + strings.Join(details, ", ") + ")"
+		}
+		contents = append(contents, entry)
+	}
+
+	m := NewMultipart("mixed", nil)
+	m.AddPart(NewTextPart("Contents:\r\n\r\n" + strings.Join(contents, "\r\n") + "\r\n"))
+	m.AddPart(digest)
+	return m, nil
+}
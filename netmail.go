@@ -0,0 +1,114 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
+)
+
+var ErrNotMultipart = errors.New("mailbuilder: the message is not multipart")
+
+/**
+ * create a message from a net/mail message; the body is read and the
+ * message decomposed, the header fields are written sorted by name since
+ * mail.Header doesn't keep their order
+ */
+func FromNetMail(msg *mail.Message) (*Message, error) {
+	var b bytes.Buffer
+	writeSortedHeader(&b, textproto.MIMEHeader(msg.Header))
+	if _, err := io.Copy(&b, msg.Body); err != nil {
+		return nil, err
+	}
+	d := NewMessageDecomposer()
+	return d.Decompose(b.Bytes(), "")
+}
+
+// return the message as a net/mail message reading the built message
+func (c *Message) AsNetMail() (*mail.Message, error) {
+	b := MessageBuilder{}
+	msg, _, err := ReadMessage(bytes.NewReader(b.Build(c)))
+	return msg, err
+}
+
+// return a mime/multipart reader of the parts of a multipart message
+func (c *Message) MultipartReader() (*multipart.Reader, error) {
+	if !c.IsMultipart() {
+		return nil, ErrNotMultipart
+	}
+	b := MessageBuilder{}
+	safe := b.withSafeBoundaries(c)
+	body, _ := b.encodedBody(context.Background(), safe)
+	return multipart.NewReader(bytes.NewReader(body), safe.Boundary), nil
+}
+
+/**
+ * create a multipart message of the given subtype from the parts of a
+ * mime/multipart reader; the parts are read raw (without decoding the
+ * quoted-printable ones) and decomposed, their header fields sorted by name
+ */
+func FromMultipartReader(r *multipart.Reader, subtype string) (*Message, error) {
+	m := NewMultipart(subtype, nil)
+	d := NewMessageDecomposer()
+	for {
+		part, err := r.NextRawPart()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var b bytes.Buffer
+		writeSortedHeader(&b, part.Header)
+		if _, err := io.Copy(&b, part); err != nil {
+			return nil, err
+		}
+		p, err := d.Decompose(b.Bytes(), m.newPartIdx())
+		if err != nil {
+			return nil, err
+		}
+		m.AddPart(p)
+	}
+}
+
+/**
+ * write the parts of a multipart message with a mime/multipart writer (the
+ * boundary is the one of the writer); each part keeps its header fields
+ * and its encoded body
+ */
+func (c *Message) WriteMultipart(w *multipart.Writer) error {
+	if !c.IsMultipart() {
+		return ErrNotMultipart
+	}
+	b := MessageBuilder{}
+	for _, p := range c.Parts {
+		// the header and the body agree on the boundary
+		p = b.withSafeBoundaries(p)
+		header := make(textproto.MIMEHeader, len(p.Header))
+		p.rangeHeaders(func(name, value string) bool {
+			header.Add(name, value)
+			return true
+		})
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		body, _ := b.encodedBody(context.Background(), p)
+		if _, err := part.Write(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write the header fields sorted by name followed by the blank line
+func writeSortedHeader(w *bytes.Buffer, header textproto.MIMEHeader) {
+	w.Write(mailtextproto.FormatMIMEHeader(header, nil, "\r\n"))
+	w.WriteString("\r\n")
+}
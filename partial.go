@@ -0,0 +1,191 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// the fields of the original message copied in the header of each fragment
+var partialHeaderFields = []string{"From", "To", "Cc", "Date", "Subject"}
+
+/**
+ * split the message in message/partial fragments (RFC 2046 section 5.2.2)
+ * of maxSize bytes at most: the message is converted to 7bit (see
+ * Downgrade8Bit) on a copy and cut at line boundaries; each fragment gets
+ * the From, To, Cc, Date and Subject fields of the message, a new
+ * Message-ID and the id, number and total parameters; a message which
+ * fits in maxSize is returned alone, unchanged
+ */
+func SplitPartial(m *Message, maxSize int) []*Message {
+	b := MessageBuilder{}
+	raw := b.Build(m)
+	if len(raw) <= maxSize || maxSize <= 0 {
+		return []*Message{m}
+	}
+
+	d := NewMessageDecomposer()
+	if copied, err := d.Decompose(raw, ""); err == nil {
+		Downgrade8Bit(copied)
+		raw = b.Build(copied)
+	}
+
+	domain := "localhost"
+	if from := envelopeAddresses(m.GetHeader("From")); len(from) > 0 {
+		domain = addressDomain(from[0].Address)
+	}
+	id := GenerateMessageID(domain)
+
+	// the room left for the body by the largest fragment header
+	header := partialFragment(m, id, len(raw), len(raw), domain)
+	budget := maxSize - len(b.headerBlock(header))
+	if budget < 1 {
+		budget = 1
+	}
+
+	var chunks [][]byte
+	for len(raw) > 0 {
+		size := budget
+		if size >= len(raw) {
+			size = len(raw)
+		} else if i := bytes.LastIndexByte(raw[:size], '\n'); i != -1 {
+			// keep the lines whole
+			size = i + 1
+		}
+		chunks = append(chunks, raw[:size])
+		raw = raw[size:]
+	}
+
+	fragments := make([]*Message, len(chunks))
+	for i, chunk := range chunks {
+		fragments[i] = partialFragment(m, id, i+1, len(chunks), domain)
+		fragments[i].Body = chunk
+	}
+	return fragments
+}
+
+// the header of a fragment
+func partialFragment(m *Message, id string, number, total int, domain string) *Message {
+	f := NewMessage()
+	for _, field := range partialHeaderFields {
+		if value := strings.TrimSpace(m.GetHeader(field)); value != "" {
+			f.SetHeaderField(field, value)
+		}
+	}
+	f.SetHeaderField("Message-ID", GenerateMessageID(domain))
+	f.SetHeaderField("MIME-Version", "1.0")
+	f.SetHeaderField("Content-Type", mime.FormatMediaType("message/partial", map[string]string{
+		"id":     id,
+		"number": strconv.Itoa(number),
+		"total":  strconv.Itoa(total),
+	}))
+	return f
+}
+
+// returned by ReassemblePartial for fragments which can't be put together
+type PartialError struct {
+	Reason string
+}
+
+func (e *PartialError) Error() string {
+	return "mailbuilder: message/partial: " + e.Reason
+}
+
+// the fields of the enclosed message kept by the reassembly, with the Content-* ones
+var partialEnclosedFields = map[string]bool{
+	"subject":      true,
+	"message-id":   true,
+	"encrypted":    true,
+	"mime-version": true,
+}
+
+/**
+ * put the message/partial fragments (any order) back together: they must
+ * have the same id, numbers from 1 to total (given by one of them at
+ * least) without gaps or duplicates; the header is merged as RFC 2046
+ * requires: the fields of the first fragment header except the Content-*,
+ * Subject, Message-ID, Encrypted and MIME-Version ones, followed by these
+ * fields of the enclosed message (its other fields are dropped); the
+ * result is decomposed
+ */
+func ReassemblePartial(parts []*Message) (*Message, error) {
+	if len(parts) == 0 {
+		return nil, &PartialError{Reason: "no fragments"}
+	}
+
+	var id string
+	total := 0
+	fragments := make(map[int]*Message)
+	for i, p := range parts {
+		mediaType, params, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if err != nil || mediaType != "message/partial" {
+			return nil, &PartialError{Reason: "fragment " + strconv.Itoa(i) + " is not message/partial"}
+		}
+		if params["id"] == "" || (id != "" && params["id"] != id) {
+			return nil, &PartialError{Reason: "missing or different id"}
+		}
+		id = params["id"]
+		number, err := strconv.Atoi(params["number"])
+		if err != nil || number < 1 {
+			return nil, &PartialError{Reason: "invalid number " + strconv.Quote(params["number"])}
+		}
+		if fragments[number] != nil {
+			return nil, &PartialError{Reason: "duplicate fragment " + strconv.Itoa(number)}
+		}
+		fragments[number] = p
+		if params["total"] != "" {
+			n, err := strconv.Atoi(params["total"])
+			if err != nil || n < 1 || (total != 0 && n != total) {
+				return nil, &PartialError{Reason: "invalid or different total"}
+			}
+			total = n
+		}
+	}
+	if total == 0 {
+		return nil, &PartialError{Reason: "no fragment gives the total"}
+	}
+	if len(fragments) != total {
+		return nil, &PartialError{Reason: strconv.Itoa(len(fragments)) + " fragments of " + strconv.Itoa(total)}
+	}
+
+	var enclosed []byte
+	for number := 1; number <= total; number++ {
+		p := fragments[number]
+		if p == nil {
+			return nil, &PartialError{Reason: "missing fragment " + strconv.Itoa(number)}
+		}
+		body, err := p.DecodedBody()
+		if err != nil {
+			return nil, &PartialError{Reason: "fragment " + strconv.Itoa(number) + ": " + err.Error()}
+		}
+		enclosed = append(enclosed, body...)
+	}
+
+	b := MessageBuilder{}
+	var result bytes.Buffer
+	for _, field := range rawHeaderFields(b.build(fragments[1])) {
+		if !isPartialEnclosedField(field.name) {
+			result.Write(field.raw)
+		}
+	}
+	enclosedFields := rawHeaderFields(enclosed)
+	headerEnd := 0
+	for _, field := range enclosedFields {
+		headerEnd += len(field.raw)
+		if isPartialEnclosedField(field.name) {
+			result.Write(field.raw)
+		}
+	}
+	// the blank line and the body
+	result.Write(enclosed[headerEnd:])
+
+	d := NewMessageDecomposer()
+	return d.Decompose(result.Bytes(), "")
+}
+
+// check if the field comes from the enclosed message
+func isPartialEnclosedField(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "content-") || partialEnclosedFields[name]
+}
@@ -0,0 +1,176 @@
+package mailbuilder
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrPartNotFound = errors.New("mailbuilder: the part is not a child of the message")
+
+/**
+ * Idx semantics: the Idx of a part is a stable address. It is assigned when
+ * the message is decomposed ("1", "1-2", "1-2-0" for the body of a
+ * message/rfc822 part) or when a part is added, and it doesn't change when
+ * siblings are inserted or removed, so references held by external systems
+ * stay resolvable with FindByIdx. A removed Idx is never reused for a new
+ * part of the same parent. CurrentIdx returns the positional address of the
+ * part in the current tree and Reindex renumbers the tree positionally.
+ */
+
+// return the next unused Idx for a child part
+func (c *Message) newPartIdx() string {
+	c.initPartIdx()
+	c.lastPartIdx++
+	return childIdx(c.Idx, c.lastPartIdx)
+}
+
+// initialize the last child number from the existing parts
+func (c *Message) initPartIdx() {
+	if c.lastPartIdx > 0 {
+		return
+	}
+	for _, p := range c.Parts {
+		suffix := p.Idx
+		if i := strings.LastIndex(suffix, "-"); i != -1 {
+			suffix = suffix[i+1:]
+		}
+		if n, err := strconv.ParseInt(suffix, 10, 64); err == nil && n > c.lastPartIdx {
+			c.lastPartIdx = n
+		}
+	}
+	if int64(len(c.Parts)) > c.lastPartIdx {
+		c.lastPartIdx = int64(len(c.Parts))
+	}
+}
+
+// return the position of a child part or -1
+func (c *Message) partPosition(p *Message) int {
+	for i, part := range c.Parts {
+		if part == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// return the positional address of the part in the current tree
+func (c *Message) CurrentIdx() string {
+	if c.Parent == nil {
+		return c.Idx
+	}
+	parentIdx := c.Parent.CurrentIdx()
+	if c.Parent.BodyMessage == c {
+		return parentIdx + "-0"
+	}
+	position := c.Parent.partPosition(c)
+	if position == -1 {
+		return c.Idx
+	}
+	return childIdx(parentIdx, int64(position+1))
+}
+
+// find a part by its stable Idx
+func (c *Message) FindByIdx(idx string) *Message {
+	var result *Message
+	c.Walk(func(p *Message) bool {
+		if result == nil && p.Idx == idx {
+			result = p
+		}
+		return result == nil
+	})
+	return result
+}
+
+// find a part by its positional address
+func (c *Message) FindByCurrentIdx(idx string) *Message {
+	var result *Message
+	c.Walk(func(p *Message) bool {
+		if result == nil && p.CurrentIdx() == idx {
+			result = p
+		}
+		return result == nil
+	})
+	return result
+}
+
+/**
+ * insert a part at the given position; a part without Idx gets a new one
+ * which was never used by a sibling
+ */
+func (c *Message) InsertPart(position int, p *Message) error {
+	if position < 0 || position > len(c.Parts) {
+		return errors.New("mailbuilder: part position out of range")
+	}
+	if err := checkSignatureProtection(c); err != nil {
+		return err
+	}
+	if p.Idx == "" {
+		p.Idx = c.newPartIdx()
+	} else {
+		c.initPartIdx()
+	}
+	p.Parent = c
+
+	c.Parts = append(c.Parts, nil)
+	copy(c.Parts[position+1:], c.Parts[position:])
+	c.Parts[position] = p
+	return nil
+}
+
+// remove a child part; the Idx of the siblings is kept
+func (c *Message) RemovePart(p *Message) error {
+	position := c.partPosition(p)
+	if position == -1 {
+		return ErrPartNotFound
+	}
+	if err := checkSignatureProtection(c); err != nil {
+		return err
+	}
+	// remember the removed numbers so they are not reused
+	c.initPartIdx()
+
+	c.Parts = append(c.Parts[:position], c.Parts[position+1:]...)
+	p.Parent = nil
+	return nil
+}
+
+// replace a child part; the replacement takes the Idx of the replaced part
+func (c *Message) ReplacePart(old, p *Message) error {
+	position := c.partPosition(old)
+	if position == -1 {
+		return ErrPartNotFound
+	}
+	if err := checkSignatureProtection(c); err != nil {
+		return err
+	}
+	p.Idx = old.Idx
+	p.Parent = c
+	c.Parts[position] = p
+	old.Parent = nil
+	return nil
+}
+
+/**
+ * renumber the tree positionally (Idx becomes CurrentIdx); returns the
+ * mapping old Idx -> new Idx of the parts whose address changed
+ */
+func (c *Message) Reindex() map[string]string {
+	mapping := make(map[string]string)
+	c.reindex(c.Idx, mapping)
+	return mapping
+}
+
+func (c *Message) reindex(idx string, mapping map[string]string) {
+	if c.Idx != idx {
+		mapping[c.Idx] = idx
+		c.Idx = idx
+	}
+	if c.BodyMessage != nil {
+		c.BodyMessage.reindex(idx+"-0", mapping)
+	}
+	for i, p := range c.Parts {
+		p.reindex(childIdx(idx, int64(i+1)), mapping)
+	}
+	c.lastPartIdx = int64(len(c.Parts))
+}
@@ -0,0 +1,85 @@
+package mailbuilder
+
+import (
+	"strings"
+)
+
+// the priority of a message, the values of X-Priority
+type Priority int
+
+const (
+	PriorityHighest Priority = iota + 1
+	PriorityHigh
+	PriorityNormal
+	PriorityLow
+	PriorityLowest
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHighest:
+		return "Highest"
+	case PriorityHigh:
+		return "High"
+	case PriorityLow:
+		return "Low"
+	case PriorityLowest:
+		return "Lowest"
+	}
+	return "Normal"
+}
+
+// the fields written by SetPriority
+var priorityFields = []string{"X-Priority", "Importance", "Priority", "X-MSMail-Priority"}
+
+/**
+ * return the priority of the message from the first field set of
+ * X-Priority ("1 (Highest)"), Importance (high, normal, low), Priority
+ * (urgent, normal, non-urgent) and X-MSMail-Priority; PriorityNormal when
+ * none is set or understood
+ */
+func (c *Message) Priority() Priority {
+	if value := strings.TrimSpace(c.GetHeader("X-Priority")); value != "" {
+		if value[0] >= '1' && value[0] <= '5' {
+			return Priority(value[0] - '0')
+		}
+	}
+	for _, field := range []string{"Importance", "Priority", "X-MSMail-Priority"} {
+		switch strings.ToLower(strings.TrimSpace(c.GetHeader(field))) {
+		case "high", "urgent":
+			return PriorityHigh
+		case "low", "non-urgent":
+			return PriorityLow
+		case "normal":
+			return PriorityNormal
+		}
+	}
+	return PriorityNormal
+}
+
+/**
+ * write the priority in all the fields read by the mail clients:
+ * X-Priority, Importance, Priority and X-MSMail-Priority; PriorityNormal
+ * removes them
+ */
+func (c *Message) SetPriority(p Priority) {
+	var importance, priority, msmail string
+	switch p {
+	case PriorityHighest, PriorityHigh:
+		importance, priority, msmail = "high", "urgent", "High"
+	case PriorityLow, PriorityLowest:
+		importance, priority, msmail = "low", "non-urgent", "Low"
+	default:
+		for _, field := range priorityFields {
+			if len(c.GetHeaderValues(field)) > 0 {
+				c.DelHeaderField(field)
+			}
+		}
+		return
+	}
+
+	c.SetHeaderField("X-Priority", string(rune('0'+p))+" ("+p.String()+")")
+	c.SetHeaderField("Importance", importance)
+	c.SetHeaderField("Priority", priority)
+	c.SetHeaderField("X-MSMail-Priority", msmail)
+}
@@ -0,0 +1,88 @@
+package mailbuilder
+
+import (
+	"fmt"
+)
+
+// what the modifications do with a part covered by a signature (see ProtectSignatures)
+type SignatureProtection int
+
+const (
+	// the parts can be changed (default)
+	SignatureProtectionOff SignatureProtection = iota
+
+	// the change is refused with a *SignatureError
+	SignatureProtectionRefuse
+
+	// the change is done and a warning is added to the root message
+	SignatureProtectionWarn
+)
+
+// returned when a change would break a signature covering the part
+type SignatureError struct {
+	Idx string
+
+	// multipart/signed or DKIM-Signature
+	Signature string
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("mailbuilder: changing part %q would break its %s", e.Idx, e.Signature)
+}
+
+/**
+ * protect the signed content of the message: the subtrees of the
+ * multipart/signed parts and the body of the messages having a
+ * DKIM-Signature; RemovePart, ReplacePart, InsertPart, ReplaceAttachment
+ * and InsertBanner then refuse or warn (mode) when they change it;
+ * SignatureProtectionOff is the override
+ */
+func (c *Message) ProtectSignatures(mode SignatureProtection) {
+	c.signatureProtection = mode
+}
+
+func (c *Message) GetSignatureProtection() SignatureProtection {
+	return c.signatureProtection
+}
+
+/**
+ * return the signature covering the content of the part ("" if none):
+ * multipart/signed for the part and the descendants of a multipart/signed,
+ * DKIM-Signature for the body of a message with that field (the DKIM body
+ * length limit, l=, is not taken into account)
+ */
+func (c *Message) SignedBy() string {
+	for node := c; node != nil; node = node.Parent {
+		if node.MediaType() == "multipart/signed" {
+			return "multipart/signed"
+		}
+		isMessage := node.Parent == nil || node.Parent.BodyMessage == node
+		if isMessage && node.GetHeader("DKIM-Signature") != "" {
+			return "DKIM-Signature"
+		}
+	}
+	return ""
+}
+
+/**
+ * check if the content of p can be changed according to the protection of
+ * the root message; the warning is recorded on the root
+ */
+func checkSignatureProtection(p *Message) error {
+	root := p
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	if root.signatureProtection == SignatureProtectionOff {
+		return nil
+	}
+	signature := p.SignedBy()
+	if signature == "" {
+		return nil
+	}
+	if root.signatureProtection == SignatureProtectionWarn {
+		root.AddWarnings(fmt.Sprintf("part %q changed, its %s is broken", p.Idx, signature))
+		return nil
+	}
+	return &SignatureError{Idx: p.Idx, Signature: signature}
+}
@@ -0,0 +1,111 @@
+package mailbuilder
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+
+	"github.com/axigenmessaging/mailbuilder/mail-textproto"
+)
+
+// size band of a message, used to choose its processing lane
+type SizeBand int
+
+const (
+	SizeBandSmall SizeBand = iota
+	SizeBandMedium
+	SizeBandLarge
+	SizeBandHuge
+)
+
+// upper limits (inclusive) of the small, medium and large bands
+var SizeBandLimits = [3]int64{64 << 10, 1 << 20, 10 << 20}
+
+func (b SizeBand) String() string {
+	switch b {
+	case SizeBandSmall:
+		return "small"
+	case SizeBandMedium:
+		return "medium"
+	case SizeBandLarge:
+		return "large"
+	}
+	return "huge"
+}
+
+// result of QuickSize
+type QuickSizeInfo struct {
+	// the top level header
+	Header textproto.MIMEHeader
+
+	// size of the raw header, with the blank line
+	HeaderSize int64
+
+	// bytes read; the size of the message when Complete
+	Size int64
+
+	// the whole message was read
+	Complete bool
+
+	// the message is larger than the limit
+	OverLimit bool
+
+	// band of Size; a lower bound when the reading stopped at the limit
+	Band SizeBand
+}
+
+/**
+ * classify a message in a size band reading only the header and enough of
+ * the body to decide the band (the body is discarded); with a limit > 0 the
+ * reading stops too after limit bytes and OverLimit is set if the message
+ * is larger; a header past the reading stop is not read whole (Header is
+ * nil); the message isn't decomposed
+ */
+func QuickSize(r io.Reader, limit int64) (QuickSizeInfo, error) {
+	info := QuickSizeInfo{}
+
+	// a message larger than the last band limit is huge, whatever its size
+	stop := SizeBandLimits[len(SizeBandLimits)-1]
+	if limit > 0 && limit < stop {
+		stop = limit
+	}
+
+	br := bufio.NewReader(r)
+	tp := mailtextproto.NewReader(br)
+	// the header isn't buffered past the stop either
+	tp.MaxHeaderBytes, tp.MaxLineBytes = int(stop), int(stop)
+	header, rawHeader, err := tp.ReadMIMEHeader()
+	var tooLarge *mailtextproto.HeaderTooLargeError
+	var tooLong *mailtextproto.LineTooLongError
+	if errors.As(err, &tooLarge) || errors.As(err, &tooLong) {
+		// more than stop bytes, as a body read to the stop
+		info.Size = stop + 1
+	} else if err != nil && !(err == io.EOF && len(rawHeader) > 0) {
+		return info, err
+	} else {
+		info.Header = header
+		info.HeaderSize = int64(len(rawHeader))
+		info.Size = info.HeaderSize
+	}
+
+	if info.Size <= stop {
+		n, err := io.CopyN(ioutil.Discard, br, stop-info.Size+1)
+		info.Size += n
+		if err != nil && err != io.EOF {
+			return info, err
+		}
+		info.Complete = err == io.EOF
+	}
+
+	info.OverLimit = limit > 0 && info.Size > limit
+	info.Band = SizeBandHuge
+	for band, bandLimit := range SizeBandLimits {
+		if info.Size <= bandLimit {
+			info.Band = SizeBand(band)
+			break
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,21 @@
+package mailbuilder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuickSize(t *testing.T) {
+	raw := "Subject: small\r\n\r\nbody\r\n"
+	info, err := QuickSize(strings.NewReader(raw), 1024)
+	if err != nil || !info.Complete || info.OverLimit || info.Size != int64(len(raw)) || info.Band != SizeBandSmall || info.Header.Get("Subject") != "small" {
+		t.Errorf("got %+v, %v", info, err)
+	}
+
+	// a header larger than the limit stops the reading too
+	raw = "Subject: " + strings.Repeat("long ", 400) + "\r\n\r\nbody\r\n"
+	info, err = QuickSize(strings.NewReader(raw), 1024)
+	if err != nil || info.Complete || !info.OverLimit || info.Size != 1025 || info.Header != nil {
+		t.Errorf("got %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,172 @@
+package mailbuilder
+
+import (
+	"strings"
+	"time"
+)
+
+// a hop of the delivery path, parsed from a Received header
+type Hop struct {
+	// the sending host as it introduced itself (HELO/EHLO name)
+	From string
+
+	// the comment after the from host: the reverse DNS name and the IP
+	// address as seen by the receiving server ("mail.example.com [192.0.2.1]")
+	FromComment string
+
+	// the IP address of the sending host ("" if not found)
+	FromIP string
+
+	// the receiving host
+	By string
+
+	// the protocol (SMTP, ESMTPS, LMTP, ...), the link (via) and the queue id
+	With string
+	Via  string
+	ID   string
+
+	// the recipient the message was received for, without the angle brackets
+	For string
+
+	// the date after the semicolon; zero if missing or invalid
+	Timestamp time.Time
+
+	// time spent since the previous hop (0 if one of the timestamps is missing)
+	Delay time.Duration
+
+	// the header value
+	Raw string
+}
+
+/**
+ * parse the Received headers of the message; the hops are returned in the
+ * delivery order (the first is the origin, the last the final server).
+ * The clauses can be missing, in any order or in comments (qmail "invoked
+ * by" headers); the unknown words are skipped
+ */
+func ParseReceivedChain(m *Message) []Hop {
+	values := m.GetHeaderValues("Received")
+	hops := make([]Hop, 0, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		hop := ParseReceived(values[i])
+		if n := len(hops); n > 0 && !hop.Timestamp.IsZero() && !hops[n-1].Timestamp.IsZero() {
+			hop.Delay = hop.Timestamp.Sub(hops[n-1].Timestamp)
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// parse a Received header value
+func ParseReceived(value string) Hop {
+	hop := Hop{Raw: value}
+	clauses := value
+	if i := strings.LastIndexByte(value, ';'); i != -1 {
+		clauses = value[:i]
+		hop.Timestamp = parseReceivedDate(value[i+1:])
+	}
+
+	tokens := receivedTokens(clauses)
+	for i := 0; i < len(tokens); i++ {
+		keyword := strings.ToLower(tokens[i])
+		if i+1 >= len(tokens) || isReceivedComment(tokens[i+1]) {
+			continue
+		}
+		var field *string
+		switch keyword {
+		case "from":
+			field = &hop.From
+		case "by":
+			field = &hop.By
+		case "with":
+			field = &hop.With
+		case "via":
+			field = &hop.Via
+		case "id":
+			field = &hop.ID
+		case "for":
+			field = &hop.For
+		default:
+			continue
+		}
+		if *field != "" {
+			continue
+		}
+		i++
+		*field = strings.Trim(tokens[i], "<>")
+		if keyword == "from" && i+1 < len(tokens) && isReceivedComment(tokens[i+1]) {
+			hop.FromComment = strings.TrimSpace(tokens[i+1][1 : len(tokens[i+1])-1])
+		}
+	}
+
+	hop.FromIP = receivedIP(hop.FromComment)
+	if hop.FromIP == "" {
+		hop.FromIP = receivedIP(hop.From)
+	}
+	return hop
+}
+
+// split the clauses in words and comments (kept with their parentheses, nested ones included)
+func receivedTokens(value string) []string {
+	var tokens []string
+	for i := 0; i < len(value); {
+		switch c := value[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			depth, j := 0, i
+			for ; j < len(value); j++ {
+				if value[j] == '(' {
+					depth++
+				} else if value[j] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if j == len(value) {
+				// not closed
+				tokens = append(tokens, value[i:]+")")
+				return tokens
+			}
+			tokens = append(tokens, value[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(value) && !strings.ContainsRune(" \t\r\n(", rune(value[j])) {
+				j++
+			}
+			tokens = append(tokens, value[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+func isReceivedComment(token string) bool {
+	return strings.HasPrefix(token, "(")
+}
+
+// the IP address in brackets of a from clause or comment ("[192.0.2.1]", "[IPv6:2001:db8::1]")
+func receivedIP(value string) string {
+	start := strings.IndexByte(value, '[')
+	if start == -1 {
+		return ""
+	}
+	end := strings.IndexByte(value[start:], ']')
+	if end == -1 {
+		return ""
+	}
+	ip := value[start+1 : start+end]
+	if len(ip) > 5 && strings.EqualFold(ip[:5], "ipv6:") {
+		ip = ip[5:]
+	}
+	return ip
+}
+
+// parse the date of a Received header (see ParseDate)
+func parseReceivedDate(value string) time.Time {
+	t, _ := ParseDate(value)
+	return t
+}
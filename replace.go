@@ -0,0 +1,96 @@
+package mailbuilder
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// returned when no attachment matches the selector
+var ErrAttachmentNotFound = errors.New("mailbuilder: no attachment with this file name or Content-ID")
+
+/**
+ * replace the content of the attachment whose decoded file name or
+ * Content-ID is selector; the data is encoded with the existing
+ * Content-Transfer-Encoding (upgraded if it can't carry it), newContentType
+ * (if not empty) replaces the media type keeping the name parameter and the
+ * size parameter, Content-Length and Content-MD5 are updated; the signed or
+ * encrypted subtrees are not searched (see ProtectSignatures for DKIM)
+ */
+func (c *Message) ReplaceAttachment(selector string, newData []byte, newContentType string) error {
+	p := c.findAttachment(selector)
+	if p == nil {
+		return ErrAttachmentNotFound
+	}
+	if err := checkSignatureProtection(p); err != nil {
+		return err
+	}
+
+	if newContentType != "" {
+		p.setContentTypeKeepingName(newContentType)
+	}
+
+	p.BodyMessage, p.IsDecoded, p.RawBody = nil, false, nil
+	p.SetDecodedBody(newData)
+
+	if _, params, err := mime.ParseMediaType(p.Header.Get("Content-Disposition")); err == nil {
+		if _, ok := params["size"]; ok {
+			p.setDispositionParam("size", strconv.Itoa(len(newData)))
+		}
+	}
+	if p.Header.Get("Content-Length") != "" {
+		p.SetHeaderField("Content-Length", strconv.Itoa(len(p.Body)))
+	}
+	if p.Header.Get("Content-Md5") != "" {
+		sum := md5.Sum(newData)
+		p.SetHeaderField("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	return nil
+}
+
+// return the first attachment with the file name or Content-ID or nil
+func (c *Message) findAttachment(selector string) *Message {
+	cid := strings.Trim(strings.TrimSpace(selector), "<>")
+	var found *Message
+	c.Walk(func(p *Message) bool {
+		if found != nil || isSignedOrEncrypted(p) {
+			return false
+		}
+		if p.IsMultipart() {
+			return true
+		}
+		if (p.Filename() != "" && p.Filename() == selector) || (cid != "" && p.ContentID() == cid) {
+			found = p
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// set the Content-Type keeping the name parameter of the current one
+func (c *Message) setContentTypeKeepingName(contentType string) {
+	_, oldParams, _ := mime.ParseMediaType(c.Header.Get("Content-Type"))
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		c.SetHeaderField("Content-Type", contentType)
+		return
+	}
+	if _, ok := params["name"]; !ok && oldParams["name"] != "" {
+		params["name"] = oldParams["name"]
+	}
+	c.SetHeaderField("Content-Type", mime.FormatMediaType(mediaType, params))
+}
+
+// set a Content-Disposition parameter keeping the disposition type and the other parameters
+func (c *Message) setDispositionParam(name, value string) {
+	disposition, params, err := mime.ParseMediaType(c.Header.Get("Content-Disposition"))
+	if err != nil {
+		disposition, params = c.Disposition(), map[string]string{}
+	}
+	params[name] = value
+	c.SetHeaderField("Content-Disposition", mime.FormatMediaType(disposition, params))
+}
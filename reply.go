@@ -0,0 +1,178 @@
+package mailbuilder
+
+import (
+	"html"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// options of NewReply
+type ReplyOptions struct {
+	// the sender of the reply; removed from the recipients of a reply to all
+	From string
+
+	// reply to all: the other recipients of the original message are copied (Cc)
+	ReplyAll bool
+
+	// the reply text and html (optional) written above the quoted original
+	Text string
+	HTML string
+
+	// quote the original body below the reply
+	Quote bool
+}
+
+// a subject already marked as a reply: "Re:", "RE[2]:", "Aw:", "Sv:"
+var replySubjectRegexp = regexp.MustCompile(`(?i)^\s*(re|aw|sv|antw)\s*(\[\d+\])?\s*:`)
+
+/**
+ * create a reply to orig: it is sent to the Reply-To addresses (From if
+ * missing), to the other recipients too (Cc) with ReplyAll; the subject
+ * gets the "Re: " prefix if it has none, In-Reply-To and References
+ * link to orig and, with Quote, the original text is quoted ("> ") below
+ * the reply text and the original html in a blockquote below the reply
+ * html; the Date, Message-ID and MIME-Version are set
+ */
+func NewReply(orig *Message, opts ReplyOptions) *Message {
+	m := NewMessage()
+	m.SetDate(time.Now())
+
+	var from *mail.Address
+	if opts.From != "" {
+		if address, err := mail.ParseAddress(opts.From); err == nil {
+			from = address
+			m.SetHeaderField("From", from.String())
+		}
+	}
+
+	to := envelopeAddresses(orig.GetHeader("Reply-To"))
+	if len(to) == 0 {
+		to = envelopeAddresses(orig.GetHeader("From"))
+	}
+	var cc []*mail.Address
+	if opts.ReplyAll {
+		excluded := make(map[string]bool)
+		if from != nil {
+			excluded[strings.ToLower(from.Address)] = true
+		}
+		for _, address := range to {
+			excluded[strings.ToLower(address.Address)] = true
+		}
+		for _, field := range []string{"To", "Cc"} {
+			for _, address := range envelopeAddresses(orig.GetHeader(field)) {
+				if key := strings.ToLower(address.Address); !excluded[key] {
+					excluded[key] = true
+					cc = append(cc, address)
+				}
+			}
+		}
+	}
+	for _, field := range []struct {
+		name      string
+		addresses []*mail.Address
+	}{{"To", to}, {"Cc", cc}} {
+		if len(field.addresses) == 0 {
+			continue
+		}
+		formatted := make([]string, len(field.addresses))
+		for i, address := range field.addresses {
+			formatted[i] = address.String()
+		}
+		m.SetHeaderField(field.name, strings.Join(formatted, ", "))
+	}
+
+	subject := strings.TrimSpace(decodeHeaderWords(orig.GetHeader("Subject")))
+	if !replySubjectRegexp.MatchString(subject) {
+		subject = "Re: " + subject
+	}
+	m.SetHeaderField("Subject", encodeWords(subject))
+
+	domain := "localhost"
+	if from != nil {
+		domain = addressDomain(from.Address)
+	}
+	m.SetHeaderField("Message-ID", GenerateMessageID(domain))
+	if messageID := strings.TrimSpace(orig.GetHeader("Message-Id")); messageID != "" {
+		m.SetHeaderField("In-Reply-To", messageID)
+		references := strings.Join(strings.Fields(orig.GetHeader("References")), " ")
+		if references == "" {
+			references = strings.TrimSpace(orig.GetHeader("In-Reply-To"))
+		}
+		m.SetHeaderField("References", strings.TrimSpace(references+" "+messageID))
+	}
+	m.SetHeaderField("MIME-Version", "1.0")
+
+	spec := MessageSpec{Text: opts.Text, HTML: opts.HTML}
+	if opts.Quote {
+		spec.Text, spec.HTML = quoteOriginal(orig, opts.Text, opts.HTML)
+	}
+	content, _ := spec.content()
+	adoptContent(m, content)
+	return m
+}
+
+// the reply text and html followed by the quoted original; the html is quoted only with a reply html
+func quoteOriginal(orig *Message, text, htmlText string) (string, string) {
+	attribution := "wrote:"
+	if from := envelopeAddresses(orig.GetHeader("From")); len(from) > 0 {
+		attribution = from[0].String() + " wrote:"
+		if from[0].Name != "" {
+			attribution = from[0].Name + " <" + from[0].Address + "> wrote:"
+		}
+	}
+	if date, ok := orig.Date(); ok {
+		attribution = "On " + date.Format("Mon, 2 Jan 2006 at 15:04") + ", " + attribution
+	}
+
+	var originalText string
+	if p := orig.envelopeBody("text/plain"); p != nil {
+		originalText, _ = p.DecodedText()
+	} else if p := orig.envelopeBody("text/html"); p != nil {
+		originalText, _ = p.readableText()
+	}
+	originalText = strings.TrimRight(strings.ReplaceAll(originalText, "\r\n", "\n"), "\n")
+
+	quoted := make([]string, 0)
+	for _, line := range strings.Split(originalText, "\n") {
+		if strings.HasPrefix(line, ">") {
+			quoted = append(quoted, ">"+line)
+		} else {
+			quoted = append(quoted, "> "+line)
+		}
+	}
+	text = strings.TrimRight(text, "\r\n") + "\n\n" + attribution + "\n" + strings.Join(quoted, "\n")
+
+	if htmlText == "" {
+		return text, ""
+	}
+	var originalHTML string
+	if p := orig.envelopeBody("text/html"); p != nil {
+		document, _ := p.DecodedText()
+		originalHTML = htmlBodyContent(document)
+	} else {
+		originalHTML = "<pre>" + html.EscapeString(originalText) + "</pre>"
+	}
+	quote := "<div>" + html.EscapeString(attribution) + "</div>\n<blockquote type=\"cite\">" + originalHTML + "</blockquote>"
+
+	// inside the body element of the reply when there is one
+	if locs := htmlBodyCloseRegexp.FindAllStringIndex(htmlText, -1); locs != nil {
+		offset := locs[len(locs)-1][0]
+		return text, htmlText[:offset] + quote + "\n" + htmlText[offset:]
+	}
+	return text, htmlText + "\n" + quote
+}
+
+// the content of the body element of an html document, the document if it has none
+func htmlBodyContent(document string) string {
+	start := 0
+	if loc := htmlBodyOpenRegexp.FindStringIndex(document); loc != nil {
+		start = loc[1]
+	}
+	end := len(document)
+	if locs := htmlBodyCloseRegexp.FindAllStringIndex(document, -1); locs != nil && locs[len(locs)-1][0] >= start {
+		end = locs[len(locs)-1][0]
+	}
+	return document[start:end]
+}
@@ -0,0 +1,59 @@
+package mailbuilder
+
+import (
+	"mime"
+	"strings"
+)
+
+/**
+ * attach orig to container as a message/rfc822 part; orig is written as
+ * it is built (a decomposed message unchanged is byte-exact, so its
+ * signatures stay valid) and the part holds a copy, later changes of orig
+ * don't change it; the transfer encoding is 7bit, 8bit or binary (RFC 2046
+ * forbids the others) and container becomes multipart/mixed if it is not
+ * multipart; the part is returned
+ */
+func AttachAsRFC822(container, orig *Message) (*Message, error) {
+	b := MessageBuilder{}
+	raw := b.Build(orig)
+
+	encoding := "7bit"
+	if hasLongLines(string(raw), 998) {
+		encoding = "binary"
+	} else if has8Bit(raw) {
+		encoding = "8bit"
+	}
+
+	name := "message.eml"
+	if subject := strings.TrimSpace(decodeHeaderWords(orig.GetHeader("Subject"))); subject != "" {
+		name = strings.Map(func(r rune) rune {
+			if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+				return '_'
+			}
+			return r
+		}, subject) + ".eml"
+	}
+
+	p := NewMessage()
+	p.SetHeaderField("Content-Type", "message/rfc822")
+	p.SetHeaderField("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if encoding != "7bit" {
+		p.SetHeaderField("Content-Transfer-Encoding", encoding)
+	}
+
+	if !container.IsMultipart() {
+		container.ConvertToMultipart("mixed")
+	}
+	p.Idx = container.newPartIdx()
+
+	d := NewMessageDecomposer()
+	inner, err := d.Decompose(raw, p.Idx+"-0")
+	if err != nil {
+		return nil, err
+	}
+	inner.Parent = p
+	inner.rfc822Depth = p.rfc822Depth + 1
+	p.BodyMessage = inner
+	container.AddPart(p)
+	return p, nil
+}
@@ -0,0 +1,54 @@
+package mailbuilder
+
+import (
+	"fmt"
+)
+
+/**
+ * the round trip contract: any input which decomposes without error and is
+ * rebuilt without modifications (with a builder not normalizing the
+ * newlines) is byte-identical to the input; the decomposer
+ * keeps for this the raw headers with their line endings, the header
+ * terminators, the preambles, the boundary lines with their transport
+ * padding, the epilogues and the original encoding of the decoded
+ * message/rfc822 parts
+ */
+
+// returned by VerifyRoundTrip when the rebuilt message differs from the input
+type RoundTripError struct {
+	// offset of the first different byte
+	Offset int
+
+	// the lengths of the input and of the rebuilt message
+	InputLength  int
+	OutputLength int
+}
+
+func (e *RoundTripError) Error() string {
+	return fmt.Sprintf("mailbuilder: rebuilt message differs from the input at offset %d (input %d bytes, output %d bytes)", e.Offset, e.InputLength, e.OutputLength)
+}
+
+/**
+ * check the round trip contract for raw: decompose and rebuild it without
+ * modifications; returns the decomposing error, a *RoundTripError if the
+ * output differs or nil
+ */
+func VerifyRoundTrip(raw []byte) error {
+	d := NewMessageDecomposer()
+	m, err := d.Decompose(raw, "")
+	if err != nil {
+		return err
+	}
+
+	b := NewMessageBuilder()
+	out := b.Build(m)
+
+	offset := 0
+	for offset < len(raw) && offset < len(out) && raw[offset] == out[offset] {
+		offset++
+	}
+	if offset == len(raw) && offset == len(out) {
+		return nil
+	}
+	return &RoundTripError{Offset: offset, InputLength: len(raw), OutputLength: len(out)}
+}
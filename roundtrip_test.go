@@ -0,0 +1,52 @@
+package mailbuilder
+
+import (
+	"errors"
+	"testing"
+)
+
+// inputs exercising the layout kept by the decomposer
+var roundTripCorpus = []string{
+	"Subject: plain\r\n\r\nbody\r\n",
+	"Subject: bare newlines\n\nbody\nwith\nlines\n",
+	"Subject: mixed newlines\r\n\nbody\r\nline\n",
+	"Subject: no body\r\n\r\n",
+	"Subject: folded\r\n  header\r\nX-Empty:\r\n\r\nbody",
+	"Content-Type: multipart/mixed; boundary=b\r\n\r\npreamble\r\n--b\r\n\r\none\r\n--b  \r\nContent-Type: text/plain\r\n\r\ntwo\r\n--b--  \r\nepilogue\r\n",
+	"Content-Type: multipart/alternative; boundary=\"b\"\n\n--b\nContent-Type: multipart/related; boundary=c\n\n--c\n\nnested\n--c--\n--b--",
+	"Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\nContent-Type: message/rfc822\r\nContent-Transfer-Encoding: base64\r\n\r\nU3ViamVjdDogaW5uZXINCg0KYm9keQ0K\r\n--b--\r\n",
+	"Content-Type: message/rfc822\r\n\r\nSubject: inner\r\n\r\nbody\r\n",
+	"Content-Type: multipart/x-unknown; boundary=b\r\n\r\n--b\r\n\r\npart\r\n--b--\r\n",
+	"Content-Type: text/plain; boundary=b\r\n\r\n--b\r\n\r\nnot a part\r\n--b--\r\n",
+	"Content-Type: text/plain; charset=iso-8859-1\r\nContent-Transfer-Encoding: 8bit\r\n\r\ncaf\xe9\r\n",
+	"Content-Type: multipart/mixed; boundary=b\n\n--b\r \n--b\n\n--b--",
+}
+
+// inputs which must fail to decompose rather than rebuild differently
+var roundTripFailures = []string{
+	"Content-Type: multipart/mixed; boundary=b\n\n--b\n",
+}
+
+// check the round trip contract (see VerifyRoundTrip) for the corpus and the fuzzed inputs
+func FuzzVerifyRoundTrip(f *testing.F) {
+	for _, raw := range roundTripCorpus {
+		f.Add([]byte(raw))
+	}
+	for _, raw := range roundTripFailures {
+		f.Add([]byte(raw))
+	}
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		var rtErr *RoundTripError
+		if err := VerifyRoundTrip(raw); errors.As(err, &rtErr) {
+			t.Fatalf("%v for %q", err, raw)
+		}
+	})
+}
+
+func TestVerifyRoundTripCorpus(t *testing.T) {
+	for _, raw := range roundTripCorpus {
+		if err := VerifyRoundTrip([]byte(raw)); err != nil {
+			t.Errorf("%v for %q", err, raw)
+		}
+	}
+}
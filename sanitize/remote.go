@@ -0,0 +1,187 @@
+package sanitize
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/axigenmessaging/mailbuilder"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// a transparent 1x1 GIF, the default replacement of the remote images
+const transparentPixel = "data:image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7"
+
+// how the remote references are replaced
+type RemoteOptions struct {
+	/**
+	 * URL of a proxy fetching the remote content; "{url}" is replaced with
+	 * the escaped original URL (which is appended if there is no "{url}")
+	 */
+	ProxyURL string
+
+	// used when there is no proxy; a transparent pixel if empty
+	Placeholder string
+}
+
+// a remote reference replaced by BlockRemoteContent
+type BlockedURL struct {
+	// index of the HTML part
+	Idx string
+
+	// the original URL
+	URL string
+}
+
+// the CSS references: url(...) and @import "..."
+var cssURLRegexp = regexp.MustCompile(`(?i)(url\(\s*['"]?|@import\s+['"])((?:https?:)?//[^'"()\s]+)`)
+
+/**
+ * replace the remote images and styles (src, background, poster, the
+ * stylesheet links and the CSS url() and @import) of every text/html part
+ * with the proxy URL or the placeholder, to block the tracking pixels while
+ * keeping the layout; the links are not changed; returns the replaced URLs
+ * and the first error (the parts which can't be decoded are skipped)
+ */
+func BlockRemoteContent(m *mailbuilder.Message, opts RemoteOptions) ([]BlockedURL, error) {
+	blocked := make([]BlockedURL, 0)
+	var firstErr error
+	m.Walk(func(p *mailbuilder.Message) bool {
+		if p.IsMultipart() || p.IsRfc822() || p.MediaType() != "text/html" {
+			return true
+		}
+
+		document, err := p.DecodedText()
+		var rewritten string
+		var urls []string
+		if err == nil {
+			rewritten, urls, err = BlockRemoteHTML(document, opts)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return true
+		}
+		if len(urls) > 0 {
+			p.SetText(rewritten)
+			for _, u := range urls {
+				blocked = append(blocked, BlockedURL{Idx: p.Idx, URL: u})
+			}
+		}
+		return true
+	})
+	return blocked, firstErr
+}
+
+// replace the remote references of an HTML document; returns the document and the replaced URLs
+func BlockRemoteHTML(document string, opts RemoteOptions) (string, []string, error) {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", nil, err
+	}
+
+	b := remoteBlocker{opts: opts}
+	b.rewrite(root)
+	if len(b.urls) == 0 {
+		return document, nil, nil
+	}
+	rewritten, err := render(root, document)
+	if err != nil {
+		return "", nil, err
+	}
+	return rewritten, b.urls, nil
+}
+
+type remoteBlocker struct {
+	opts RemoteOptions
+	urls []string
+}
+
+func (b *remoteBlocker) rewrite(n *html.Node) {
+	if n.Type == html.ElementNode {
+		for i := range n.Attr {
+			attr := &n.Attr[i]
+			switch strings.ToLower(attr.Key) {
+			case "src", "background", "poster", "lowsrc", "dynsrc":
+				attr.Val = b.replaceURL(attr.Val)
+			case "srcset":
+				attr.Val = b.replaceSrcset(attr.Val)
+			case "href":
+				if n.DataAtom == atom.Link && isStylesheet(n) {
+					attr.Val = b.replaceURL(attr.Val)
+				}
+			case "style":
+				attr.Val = b.replaceCSS(attr.Val)
+			}
+		}
+	}
+	if n.Type == html.TextNode && n.Parent != nil && n.Parent.DataAtom == atom.Style {
+		n.Data = b.replaceCSS(n.Data)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.rewrite(child)
+	}
+}
+
+// replace value if it is a remote URL
+func (b *remoteBlocker) replaceURL(value string) string {
+	trimmed := strings.TrimSpace(value)
+	if !isRemoteURL(trimmed) {
+		return value
+	}
+	b.urls = append(b.urls, trimmed)
+	if b.opts.ProxyURL == "" {
+		if b.opts.Placeholder != "" {
+			return b.opts.Placeholder
+		}
+		return transparentPixel
+	}
+	if strings.Contains(b.opts.ProxyURL, "{url}") {
+		return strings.ReplaceAll(b.opts.ProxyURL, "{url}", url.QueryEscape(trimmed))
+	}
+	return b.opts.ProxyURL + url.QueryEscape(trimmed)
+}
+
+// replace the remote URLs of a srcset ("a.png 1x, b.png 2x")
+func (b *remoteBlocker) replaceSrcset(value string) string {
+	candidates := strings.Split(value, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = b.replaceURL(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// replace the remote URLs of a style sheet or style attribute
+func (b *remoteBlocker) replaceCSS(css string) string {
+	return cssURLRegexp.ReplaceAllStringFunc(css, func(match string) string {
+		loc := cssURLRegexp.FindStringSubmatchIndex(match)
+		return match[:loc[4]] + b.replaceURL(match[loc[4]:loc[5]])
+	})
+}
+
+// check if an URL is fetched from the network
+func isRemoteURL(value string) bool {
+	lower := strings.ToLower(value)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "//")
+}
+
+// check if a <link> loads a style sheet
+func isStylesheet(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, "rel") {
+			for _, rel := range strings.Fields(strings.ToLower(attr.Val)) {
+				if rel == "stylesheet" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
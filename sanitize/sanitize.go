@@ -0,0 +1,321 @@
+package sanitize
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/axigenmessaging/mailbuilder"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// what is changed in the HTML besides removing the active content
+type Options struct {
+	// make the links not clickable: http://, https:// and ftp:// become hxxp://, hxxps:// and fxp://
+	DefangLinks bool
+}
+
+// elements removed with their content
+var removedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Base:     true,
+}
+
+// attributes holding an URL
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"background": true,
+	"lowsrc":     true,
+	"dynsrc":     true,
+	"poster":     true,
+	"xlink:href": true,
+}
+
+// the URL schemes running code
+var activeSchemeRegexp = regexp.MustCompile(`^(javascript|vbscript|livescript|data\s*:\s*text/html)`)
+
+// the active CSS constructs
+var activeStyleRegexp = regexp.MustCompile(`(?i)expression\s*\(|javascript:|vbscript:|-moz-binding|behavior\s*:`)
+
+// the CSS comments and escapes, which can split or hide an active construct ("expr/**/ession(", "java\73 cript:")
+var cssCommentRegexp = regexp.MustCompile(`/\*[\s\S]*?(\*/|$)`)
+var cssEscapeRegexp = regexp.MustCompile(`\\([0-9a-fA-F]{1,6}\s?|[^\n0-9a-fA-F])`)
+
+// the SVG (SMIL) animation elements, which set an attribute of their parent to any value
+var animationElements = map[string]bool{
+	"animate":      true,
+	"set":          true,
+	"animatecolor": true,
+}
+
+var defangRegexp = regexp.MustCompile(`(?i)\b(http|https|ftp)(://)`)
+
+/**
+ * sanitize every text/html part of the message: the scripts, frames,
+ * objects, event handlers and SVG animations of links or handlers are
+ * removed and the javascript: URLs and the active CSS (style attributes and
+ * elements) neutralized; the changed parts are encoded again with their charset and
+ * transfer encoding; returns the number of changed parts and the first
+ * error (the parts which can't be decoded are skipped)
+ */
+func Clean(m *mailbuilder.Message, opts Options) (int, error) {
+	changed := 0
+	var firstErr error
+	m.Walk(func(p *mailbuilder.Message) bool {
+		if p.IsMultipart() || p.IsRfc822() || p.MediaType() != "text/html" {
+			return true
+		}
+
+		document, err := p.DecodedText()
+		if err == nil {
+			var cleaned string
+			var modified bool
+			cleaned, modified, err = cleanHTML(document, opts)
+			if err == nil && modified {
+				p.SetText(cleaned)
+				changed++
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return true
+	})
+	return changed, firstErr
+}
+
+// sanitize an HTML document (or fragment)
+func CleanHTML(document string, opts Options) (string, error) {
+	cleaned, _, err := cleanHTML(document, opts)
+	return cleaned, err
+}
+
+// returns the document unchanged and false if there was nothing to sanitize
+func cleanHTML(document string, opts Options) (string, bool, error) {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", false, err
+	}
+
+	s := sanitizer{opts: opts}
+	s.clean(root)
+	if !s.modified {
+		return document, false, nil
+	}
+
+	cleaned, err := render(root, document)
+	if err != nil {
+		return "", false, err
+	}
+	return cleaned, true, nil
+}
+
+// render a parsed document; a fragment is rendered without the elements added by the parser
+func render(root *html.Node, document string) (string, error) {
+	var b bytes.Buffer
+	if isFragment(document) {
+		// don't add the html, head and body elements the parser created
+		for _, n := range fragmentNodes(root) {
+			if err := html.Render(&b, n); err != nil {
+				return "", err
+			}
+		}
+	} else if err := html.Render(&b, root); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+type sanitizer struct {
+	opts     Options
+	modified bool
+}
+
+func (s *sanitizer) clean(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && (removedElements[child.DataAtom] || isMetaRefresh(child) || isActiveAnimation(child)) {
+			n.RemoveChild(child)
+			s.modified = true
+		} else {
+			if child.Type == html.ElementNode {
+				s.cleanAttributes(child)
+			} else if child.Type == html.TextNode && n.DataAtom == atom.Style {
+				s.cleanStyleText(child)
+			} else if child.Type == html.TextNode && s.opts.DefangLinks {
+				s.defangText(child)
+			}
+			s.clean(child)
+		}
+		child = next
+	}
+}
+
+// remove the event handlers and the active URLs and styles
+func (s *sanitizer) cleanAttributes(n *html.Node) {
+	attrs := n.Attr[:0]
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" {
+			key = strings.ToLower(attr.Namespace) + ":" + key
+		}
+		switch {
+		case strings.HasPrefix(key, "on"):
+			s.modified = true
+			continue
+		case key == "style" && isActiveStyle(attr.Val):
+			s.modified = true
+			continue
+		case urlAttributes[key] || urlAttributes[strings.ToLower(attr.Key)]:
+			if isActiveURL(attr.Val) {
+				attr.Val = "#"
+				s.modified = true
+			} else if s.opts.DefangLinks {
+				if defanged := defang(attr.Val); defanged != attr.Val {
+					attr.Val = defanged
+					s.modified = true
+				}
+			}
+		}
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+}
+
+// remove the active constructs of the CSS of a <style> element
+func (s *sanitizer) cleanStyleText(n *html.Node) {
+	if !isActiveStyle(n.Data) {
+		return
+	}
+	css := unescapeCSS(n.Data)
+	// a construct can be rebuilt by removing the one it surrounds
+	for activeStyleRegexp.MatchString(css) {
+		css = activeStyleRegexp.ReplaceAllString(css, "")
+	}
+	n.Data = css
+	s.modified = true
+}
+
+func (s *sanitizer) defangText(n *html.Node) {
+	if defanged := defang(n.Data); defanged != n.Data {
+		n.Data = defanged
+		s.modified = true
+	}
+}
+
+// check if an URL runs code; the browsers ignore the spaces and control characters in the scheme
+func isActiveURL(value string) bool {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	return activeSchemeRegexp.MatchString(strings.ToLower(value))
+}
+
+// check if a CSS text has an active construct, hidden by comments or escapes or not
+func isActiveStyle(css string) bool {
+	return activeStyleRegexp.MatchString(css) || activeStyleRegexp.MatchString(unescapeCSS(css))
+}
+
+// remove the comments and decode the escapes of a CSS text
+func unescapeCSS(css string) string {
+	css = cssCommentRegexp.ReplaceAllString(css, "")
+	return cssEscapeRegexp.ReplaceAllStringFunc(css, func(escape string) string {
+		code := strings.TrimSpace(escape[1:])
+		if len(escape) == 2 && !isHexDigit(escape[1]) {
+			return escape[1:]
+		}
+		r, err := strconv.ParseUint(code, 16, 32)
+		if err != nil || r == 0 || r > unicode.MaxRune {
+			return "\uFFFD"
+		}
+		return string(rune(r))
+	})
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+/**
+ * check if the element is an SVG animation setting an URL attribute (an
+ * <a> href to javascript:...) or an event handler of its parent
+ */
+func isActiveAnimation(n *html.Node) bool {
+	if !animationElements[strings.ToLower(n.Data)] {
+		return false
+	}
+	for _, attr := range n.Attr {
+		if !strings.EqualFold(attr.Key, "attributename") {
+			continue
+		}
+		target := strings.ToLower(strings.TrimSpace(attr.Val))
+		if urlAttributes[target] || urlAttributes[strings.TrimPrefix(target, "xlink:")] || strings.HasPrefix(target, "on") {
+			return true
+		}
+	}
+	return false
+}
+
+// make the URLs of a text not clickable
+func defang(value string) string {
+	return defangRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		scheme := match[:len(match)-3]
+		switch strings.ToLower(scheme) {
+		case "http", "https":
+			scheme = scheme[:1] + "xx" + scheme[3:]
+		case "ftp":
+			scheme = scheme[:1] + "x" + scheme[2:]
+		}
+		return scheme + "://"
+	})
+}
+
+// check if the element is <meta http-equiv="refresh">
+func isMetaRefresh(n *html.Node) bool {
+	if n.DataAtom != atom.Meta {
+		return false
+	}
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, "http-equiv") && strings.EqualFold(strings.TrimSpace(attr.Val), "refresh") {
+			return true
+		}
+	}
+	return false
+}
+
+// check if the document has no html element of its own
+func isFragment(document string) bool {
+	lower := strings.ToLower(document)
+	return !strings.Contains(lower, "<html") && !strings.Contains(lower, "<body")
+}
+
+// return the nodes of a parsed fragment: the children of the head and body
+func fragmentNodes(root *html.Node) []*html.Node {
+	var nodes []*html.Node
+	for n := root.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type != html.ElementNode || n.DataAtom != atom.Html {
+			continue
+		}
+		for section := n.FirstChild; section != nil; section = section.NextSibling {
+			for child := section.FirstChild; child != nil; child = child.NextSibling {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	return nodes
+}
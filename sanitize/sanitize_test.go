@@ -0,0 +1,40 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanHTML(t *testing.T) {
+	tests := []struct {
+		document string
+		removed  []string
+		kept     []string
+	}{
+		{`<p onclick="alert(1)">text</p><script>alert(2)</script>`, []string{"onclick", "script"}, []string{"<p>text</p>"}},
+		{`<a href=" java&#09;script:alert(1)">link</a>`, []string{"script:"}, []string{`href="#"`}},
+		{`<style>body{background:url(javascript:alert(1));width:expression(alert(2))}</style><p>text</p>`,
+			[]string{"javascript:", "expression("}, []string{"<style>body{background:url(", "<p>text</p>"}},
+		{`<style>p{width:expr/**/ession(alert(1));background:url(java\73 cript:alert(2))}</style>`, []string{"ession(", "cript:"}, []string{"<style>p{width:"}},
+		{`<div style="width:expr/**/ession(alert(1))">text</div>`, []string{"style="}, []string{"<div>text</div>"}},
+		{`<svg><a><animate attributeName="href" to="javascript:alert(1)"/><text>x</text></a></svg>`, []string{"animate", "javascript:"}, []string{"<text>x</text>"}},
+		{`<svg><a><set attributeName="xlink:href" values="javascript:alert(1)"></set></a></svg>`, []string{"<set", "javascript:"}, nil},
+		{`<svg><rect><animate attributeName="width" from="0" to="10"/></rect></svg>`, nil, []string{`<animate attributeName="width" from="0" to="10"`}},
+	}
+	for _, test := range tests {
+		cleaned, err := CleanHTML(test.document, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, removed := range test.removed {
+			if strings.Contains(cleaned, removed) {
+				t.Errorf("%s: %q kept in %s", test.document, removed, cleaned)
+			}
+		}
+		for _, kept := range test.kept {
+			if !strings.Contains(cleaned, kept) {
+				t.Errorf("%s: %q missing from %s", test.document, kept, cleaned)
+			}
+		}
+	}
+}
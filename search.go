@@ -0,0 +1,195 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// find the matches in a decoded text; each match is a [start, end) pair of byte offsets
+type Matcher interface {
+	FindAll(text []byte) [][]int
+}
+
+// a match found by Search
+type SearchMatch struct {
+	// index of the part holding the match
+	Idx string
+
+	// byte offsets of the match in the decoded content of the part
+	Start int
+	End   int
+
+	// the matched text
+	Text string
+}
+
+// options of SearchWithOptions
+type SearchOptions struct {
+	/**
+	 * media types of the attachments to search ("application/pdf", "text/*",
+	 * ...); the attachments are skipped by default, the text bodies are always
+	 * searched
+	 */
+	AttachmentTypes []string
+}
+
+// match a literal string
+type literalMatcher struct {
+	literal []byte
+}
+
+// match a regular expression
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+// match a string ignoring the case (Unicode simple case folding)
+type foldMatcher struct {
+	runes []rune
+}
+
+func NewLiteralMatcher(literal string) Matcher {
+	return &literalMatcher{literal: []byte(literal)}
+}
+
+func NewRegexpMatcher(re *regexp.Regexp) Matcher {
+	return &regexpMatcher{re: re}
+}
+
+func NewFoldMatcher(s string) Matcher {
+	return &foldMatcher{runes: []rune(s)}
+}
+
+func (m *literalMatcher) FindAll(text []byte) [][]int {
+	var result [][]int
+	if len(m.literal) == 0 {
+		return result
+	}
+	for pos := 0; pos < len(text); {
+		i := bytes.Index(text[pos:], m.literal)
+		if i == -1 {
+			break
+		}
+		start := pos + i
+		result = append(result, []int{start, start + len(m.literal)})
+		pos = start + len(m.literal)
+	}
+	return result
+}
+
+func (m *regexpMatcher) FindAll(text []byte) [][]int {
+	return m.re.FindAllIndex(text, -1)
+}
+
+func (m *foldMatcher) FindAll(text []byte) [][]int {
+	var result [][]int
+	if len(m.runes) == 0 {
+		return result
+	}
+	for pos := 0; pos < len(text); {
+		if end := m.matchAt(text, pos); end != -1 {
+			result = append(result, []int{pos, end})
+			pos = end
+			continue
+		}
+		_, size := utf8.DecodeRune(text[pos:])
+		pos += size
+	}
+	return result
+}
+
+// return the end of the match starting at pos or -1
+func (m *foldMatcher) matchAt(text []byte, pos int) int {
+	for _, want := range m.runes {
+		if pos >= len(text) {
+			return -1
+		}
+		r, size := utf8.DecodeRune(text[pos:])
+		if !foldEqual(r, want) {
+			return -1
+		}
+		pos += size
+	}
+	return pos
+}
+
+// check if two runes are equal under simple case folding
+func foldEqual(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// search the decoded text bodies of the message (nested messages included)
+func Search(m *Message, matcher Matcher) []SearchMatch {
+	return SearchWithOptions(m, matcher, SearchOptions{})
+}
+
+/**
+ * search the decoded content of the parts: the text parts are decoded
+ * (transfer encoding and charset, the offsets are in the UTF-8 text), the
+ * attachments of the types given by the options are decoded from their
+ * transfer encoding; the parts which can't be decoded are skipped
+ */
+func SearchWithOptions(m *Message, matcher Matcher, opts SearchOptions) []SearchMatch {
+	result := make([]SearchMatch, 0)
+	m.Walk(func(p *Message) bool {
+		if p.IsMultipart() || p.IsRfc822() {
+			return true
+		}
+		if p.IsAttachment() && !opts.searchesAttachment(p.MediaType()) {
+			return true
+		}
+
+		var content []byte
+		if p.isTextLeaf() {
+			text, err := p.DecodedText()
+			if err != nil {
+				return true
+			}
+			content = []byte(text)
+		} else if p.IsAttachment() {
+			data, err := p.DecodedBody()
+			if err != nil {
+				return true
+			}
+			content = data
+		} else {
+			return true
+		}
+
+		for _, loc := range matcher.FindAll(content) {
+			result = append(result, SearchMatch{
+				Idx:   p.Idx,
+				Start: loc[0],
+				End:   loc[1],
+				Text:  string(content[loc[0]:loc[1]]),
+			})
+		}
+		return true
+	})
+	return result
+}
+
+// check if the attachments of the media type are searched
+func (o SearchOptions) searchesAttachment(mediaType string) bool {
+	for _, pattern := range o.AttachmentTypes {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mediaType || pattern == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package mailbuilder
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain; charset=iso-8859-1\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nCaf=E9 at 10, caf=E9 at 12\r\n" +
+		"--b\r\nContent-Type: text/plain; name=notes.txt\r\nContent-Transfer-Encoding: base64\r\n\r\nY2Fmw6kgbm90ZXM=\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=data.bin\r\n\r\ncaf\xc3\xa9 data\r\n" +
+		"--b--\r\n"
+
+	tests := []struct {
+		name    string
+		matcher Matcher
+		opts    SearchOptions
+		want    []SearchMatch
+	}{
+		{"literal", NewLiteralMatcher("café"), SearchOptions{},
+			[]SearchMatch{{"1", 13, 18, "café"}}},
+		{"fold", NewFoldMatcher("CAFÉ"), SearchOptions{},
+			[]SearchMatch{{"1", 0, 5, "Café"}, {"1", 13, 18, "café"}}},
+		{"regexp", NewRegexpMatcher(regexp.MustCompile(`\d+`)), SearchOptions{},
+			[]SearchMatch{{"1", 9, 11, "10"}, {"1", 22, 24, "12"}}},
+		{"text attachments", NewLiteralMatcher("café"), SearchOptions{AttachmentTypes: []string{"text/*"}},
+			[]SearchMatch{{"1", 13, 18, "café"}, {"2", 0, 5, "café"}}},
+		{"all attachments", NewLiteralMatcher("café"), SearchOptions{AttachmentTypes: []string{"*/*"}},
+			[]SearchMatch{{"1", 13, 18, "café"}, {"2", 0, 5, "café"}, {"3", 0, 5, "café"}}},
+		{"no match", NewLiteralMatcher("tea"), SearchOptions{}, []SearchMatch{}},
+	}
+
+	d := NewMessageDecomposer()
+	m, err := d.Decompose([]byte(raw), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SearchWithOptions(m, tt.matcher, tt.opts)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d matches, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("match %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// returned by DeliverViaSendmail when the sendmail program fails
+type SendmailError struct {
+	Path string
+
+	// exit status of the program (-1 if it was killed by a signal)
+	ExitCode int
+
+	// what the program wrote to its standard error
+	Stderr string
+}
+
+func (e *SendmailError) Error() string {
+	msg := "mailbuilder: " + e.Path + " exited with status " + strconv.Itoa(e.ExitCode)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// check if the sendmail exit status is temporary (EX_TEMPFAIL, sysexits.h)
+func (e *SendmailError) Temporary() bool {
+	return e.ExitCode == 75
+}
+
+/**
+ * deliver the message with a local sendmail compatible program (sendmail,
+ * exim, postfix sendmail, ...): the message is built with LF line endings
+ * and written to the standard input of path run with args (for example
+ * "-i", "-f", sender, "--", recipient); a non zero exit status is returned
+ * as a *SendmailError, a program which can't be started as the exec error
+ */
+func DeliverViaSendmail(m *Message, path string, args ...string) error {
+	b := NewMessageBuilder()
+	b.SetNewline("\n")
+	b.SetNormalizeNewlines(true)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(b.Build(m))
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &SendmailError{Path: path, ExitCode: exitErr.ExitCode(), Stderr: stderr.String()}
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package mailbuilder
+
+import (
+	"net/mail"
+	"strings"
+)
+
+/**
+ * the SMTP envelope of a message: the reverse path (MAIL FROM), the
+ * recipients (RCPT TO) and the MAIL FROM parameters; it is carried with
+ * the message instead of being kept in header fields which would be sent
+ */
+type SMTPEnvelope struct {
+	// the reverse path without the angle brackets, "" for the null sender (bounces)
+	MailFrom string
+
+	RcptTo []string
+
+	// the MAIL FROM parameters by upper case name (SIZE, BODY, SMTPUTF8, RET, ENVID, ...)
+	Params map[string]string
+}
+
+/**
+ * return an SMTP envelope built from the header: the reverse path from
+ * Return-Path (the Sender or the first From address if missing) and the
+ * recipients from To, Cc and Bcc without duplicates
+ */
+func NewSMTPEnvelopeFromHeader(m *Message) *SMTPEnvelope {
+	e := &SMTPEnvelope{Params: make(map[string]string)}
+	if returnPath := strings.TrimSpace(m.GetHeader("Return-Path")); returnPath != "" {
+		e.MailFrom = strings.Trim(returnPath, "<>")
+	} else {
+		for _, field := range []string{"Sender", "From"} {
+			if list := envelopeAddresses(m.GetHeader(field)); len(list) > 0 {
+				e.MailFrom = list[0].Address
+				break
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range []string{"To", "Cc", "Bcc"} {
+		for _, value := range m.GetHeaderValues(field) {
+			list, err := mail.ParseAddressList(value)
+			if err != nil {
+				continue
+			}
+			for _, address := range list {
+				if key := strings.ToLower(address.Address); !seen[key] {
+					seen[key] = true
+					e.RcptTo = append(e.RcptTo, address.Address)
+				}
+			}
+		}
+	}
+	return e
+}
+
+/**
+ * set the Return-Path field from the reverse path of the SMTP envelope; a
+ * missing field is added at the top of the header (trace field); no change
+ * without envelope
+ */
+func (c *Message) SyncReturnPath() {
+	if c.SMTPEnvelope == nil {
+		return
+	}
+	returnPath := "<" + c.SMTPEnvelope.MailFrom + ">"
+	if len(c.GetHeaderValues("Return-Path")) == 0 {
+		c.PrependHeaderField("Return-Path", returnPath)
+		return
+	}
+	c.SetHeaderField("Return-Path", returnPath)
+}
+
+// return m with the builder envelope options applied; m itself is not modified
+func (c *MessageBuilder) withSMTPEnvelope(m *Message) *Message {
+	syncReturnPath := c.syncReturnPath && m.SMTPEnvelope != nil &&
+		strings.TrimSpace(m.GetHeader("Return-Path")) != "<"+m.SMTPEnvelope.MailFrom+">"
+	stripBcc := c.stripBcc && len(m.GetHeaderValues("Bcc")) > 0
+	if !syncReturnPath && !stripBcc {
+		return m
+	}
+
+	root := copyRootHeader(m)
+	if syncReturnPath {
+		root.SyncReturnPath()
+	}
+	if stripBcc {
+		root.DelHeaderField("Bcc")
+	}
+	return root
+}
@@ -0,0 +1,261 @@
+package mailbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/mail"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * declarative description of a message for BuildFromSpec:
+ *
+ *   {
+ *     "from": "Ann <ann@example.com>", "to": ["bob@example.com"], "cc": [...],
+ *     "replyTo": "...", "subject": "Hello", "date": "2024-05-01T10:00:00+02:00",
+ *     "messageId": "<id@example.com>", "headers": [{"name": "X-Tag", "value": "1"}],
+ *     "text": "plain body", "html": "<p>html body</p>",
+ *     "attachments": [{"filename": "a.pdf", "contentType": "application/pdf",
+ *                      "content": "<base64>", "contentId": "logo", "inline": true}]
+ *   }
+ */
+type MessageSpec struct {
+	From        string           `json:"from"`
+	To          []string         `json:"to,omitempty"`
+	Cc          []string         `json:"cc,omitempty"`
+	ReplyTo     string           `json:"replyTo,omitempty"`
+	Subject     string           `json:"subject,omitempty"`
+	Date        *time.Time       `json:"date,omitempty"`
+	MessageID   string           `json:"messageId,omitempty"`
+	Headers     []jsonHeader     `json:"headers,omitempty"`
+	Text        string           `json:"text,omitempty"`
+	HTML        string           `json:"html,omitempty"`
+	Attachments []AttachmentSpec `json:"attachments,omitempty"`
+}
+
+// an attachment of a MessageSpec; an inline one with a contentId is referenced by the HTML (cid:)
+type AttachmentSpec struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType,omitempty"`
+	Content     []byte `json:"content"`
+	ContentID   string `json:"contentId,omitempty"`
+	Inline      bool   `json:"inline,omitempty"`
+}
+
+// returned by BuildFromSpec for an invalid description
+type SpecError struct {
+	Field  string
+	Reason string
+}
+
+func (e *SpecError) Error() string {
+	return fmt.Sprintf("mailbuilder: invalid message spec field %q: %s", e.Field, e.Reason)
+}
+
+// build a message from its JSON description (see MessageSpec)
+func BuildFromSpec(spec []byte) (*Message, error) {
+	var s MessageSpec
+	if err := json.Unmarshal(spec, &s); err != nil {
+		return nil, err
+	}
+	return s.Message()
+}
+
+/**
+ * build the message: the text and html bodies form a multipart/alternative,
+ * the inline attachments with a Content-ID a multipart/related with the
+ * html and the other attachments a multipart/mixed; the Date (now by
+ * default), Message-ID (generated by default) and MIME-Version are set
+ */
+func (s *MessageSpec) Message() (*Message, error) {
+	m := NewMessage()
+
+	date := time.Now()
+	if s.Date != nil {
+		date = *s.Date
+	}
+	m.SetDate(date)
+
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return nil, &SpecError{Field: "from", Reason: err.Error()}
+	}
+	m.SetHeaderField("From", from.String())
+
+	for _, field := range []struct {
+		name      string
+		header    string
+		addresses []string
+	}{{"to", "To", s.To}, {"cc", "Cc", s.Cc}} {
+		if len(field.addresses) == 0 {
+			continue
+		}
+		list, err := mail.ParseAddressList(strings.Join(field.addresses, ", "))
+		if err != nil {
+			return nil, &SpecError{Field: field.name, Reason: err.Error()}
+		}
+		formatted := make([]string, len(list))
+		for i, address := range list {
+			formatted[i] = address.String()
+		}
+		m.SetHeaderField(field.header, strings.Join(formatted, ", "))
+	}
+	if s.ReplyTo != "" {
+		replyTo, err := mail.ParseAddress(s.ReplyTo)
+		if err != nil {
+			return nil, &SpecError{Field: "replyTo", Reason: err.Error()}
+		}
+		m.SetHeaderField("Reply-To", replyTo.String())
+	}
+	if s.Subject != "" {
+		if err := checkSpecLine("subject", s.Subject); err != nil {
+			return nil, err
+		}
+		m.SetHeaderField("Subject", encodeWords(s.Subject))
+	}
+
+	messageID := s.MessageID
+	if err := checkSpecLine("messageId", messageID); err != nil {
+		return nil, err
+	}
+	if messageID == "" {
+		messageID = GenerateMessageID(addressDomain(from.Address))
+	}
+	m.SetHeaderField("Message-ID", messageID)
+
+	for _, h := range s.Headers {
+		if h.Name == "" || strings.ContainsAny(h.Name, ": \t\r\n") {
+			return nil, &SpecError{Field: "headers", Reason: "invalid field name " + strconv.Quote(h.Name)}
+		}
+		if err := checkSpecLine("headers", h.Value); err != nil {
+			return nil, err
+		}
+		m.SetHeaderField(h.Name, encodeWords(h.Value))
+	}
+	m.SetHeaderField("MIME-Version", "1.0")
+
+	content, err := s.content()
+	if err != nil {
+		return nil, err
+	}
+	adoptContent(m, content)
+	return m, nil
+}
+
+// a header value of the spec can't hold line breaks: they would add fields
+func checkSpecLine(field, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return &SpecError{Field: field, Reason: "line break in the value"}
+	}
+	return nil
+}
+
+// build the content tree of the message
+func (s *MessageSpec) content() (*Message, error) {
+	var text, html *Message
+	if s.Text != "" || s.HTML == "" {
+		text = NewTextPart(string(ConvertNewlines([]byte(s.Text), "\r\n")))
+	}
+	if s.HTML != "" {
+		html = NewPart("text/html; charset=utf-8", nil, "7bit")
+		html.SetText(string(ConvertNewlines([]byte(s.HTML), "\r\n")))
+	}
+
+	var related, attachments []*Message
+	for i, a := range s.Attachments {
+		p, err := a.part()
+		if err != nil {
+			return nil, &SpecError{Field: fmt.Sprintf("attachments[%d]", i), Reason: err.Error()}
+		}
+		if a.Inline && a.ContentID != "" && html != nil {
+			related = append(related, p)
+		} else {
+			attachments = append(attachments, p)
+		}
+	}
+
+	if len(related) > 0 {
+		node := NewMultipart("related", nil)
+		node.AddPart(html)
+		for _, p := range related {
+			node.AddPart(p)
+		}
+		html = node
+	}
+
+	body := text
+	if html != nil {
+		body = html
+		if text != nil {
+			body = NewMultipart("alternative", nil)
+			body.AddPart(text)
+			body.AddPart(html)
+		}
+	}
+
+	if len(attachments) == 0 {
+		return body, nil
+	}
+	mixed := NewMultipart("mixed", nil)
+	mixed.AddPart(body)
+	for _, p := range attachments {
+		mixed.AddPart(p)
+	}
+	return mixed, nil
+}
+
+// build the part of an attachment
+func (a AttachmentSpec) part() (*Message, error) {
+	name := path.Base(strings.ReplaceAll(a.Filename, "\\", "/"))
+	if a.Filename == "" || name == "." || name == "/" {
+		return nil, fmt.Errorf("missing filename")
+	}
+
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", map[string]string{}
+	}
+	params["name"] = name
+
+	p := NewPart(mime.FormatMediaType(mediaType, params), a.Content, "base64")
+	disposition := "attachment"
+	if a.Inline {
+		disposition = "inline"
+	}
+	p.SetHeaderField("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	if a.ContentID != "" {
+		p.SetHeaderField("Content-ID", "<"+strings.Trim(a.ContentID, "<>")+">")
+	}
+	return p, nil
+}
+
+// move the content headers, body and parts of content into m
+func adoptContent(m, content *Message) {
+	for _, key := range content.headerOrder() {
+		m.SetHeaderField(key, content.Header.Get(key))
+	}
+	m.Body = content.Body
+	m.Boundary = content.Boundary
+	m.MultipartSubtype = content.MultipartSubtype
+	m.Parts = content.Parts
+	for _, p := range m.Parts {
+		p.Parent = m
+	}
+	m.lastPartIdx = content.lastPartIdx
+}
+
+// the domain of an address, "localhost" if it has none
+func addressDomain(address string) string {
+	if i := strings.LastIndex(address, "@"); i != -1 && i+1 < len(address) {
+		return address[i+1:]
+	}
+	return "localhost"
+}
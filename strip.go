@@ -0,0 +1,78 @@
+package mailbuilder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+/**
+ * remove the attachments matching policy and replace each with a small
+ * text/plain part naming the removed file ("attachment removed: invoice.zip,
+ * 1.2 MB, sha256=...") keeping its Content-* headers describing the part
+ * (see CopyContentHeaders) but the disposition; only the parts of a
+ * multipart are replaced, so the structure stays valid, and the signed or
+ * encrypted subtrees are left untouched; returns the number of removed
+ * attachments
+ */
+func StripAttachments(m *Message, policy func(part *Message) bool) int {
+	removed := 0
+	m.Walk(func(p *Message) bool {
+		if isSignedOrEncrypted(p) {
+			return false
+		}
+		if p.Parent == nil || !p.IsAttachment() || !policy(p) {
+			return true
+		}
+
+		b := MessageBuilder{}
+		placeholder := NewTextPart(attachmentPlaceholder(p) + b.newlineFor(p.Parent))
+		placeholder.Newline = p.Newline
+		// the description, duration... of the removed attachment stay; the
+		// placeholder is an inline text without the file name so it isn't
+		// taken for the attachment again
+		placeholder.SetHeaderField("Content-Disposition", "inline")
+		CopyContentHeaders(placeholder, p)
+		if p.Parent.ReplacePart(p, placeholder) == nil {
+			removed++
+		}
+		// the children of the removed part are gone too
+		return false
+	})
+	return removed
+}
+
+// the text of the part replacing a removed attachment
+func attachmentPlaceholder(p *Message) string {
+	var data []byte
+	if p.BodyMessage != nil {
+		b := MessageBuilder{}
+		data = b.Build(p.BodyMessage)
+	} else if decoded, err := p.DecodedBody(); err == nil {
+		data = decoded
+	} else {
+		data, _ = p.rawBody()
+	}
+
+	name := p.Filename()
+	if name == "" {
+		name = "unnamed " + p.MediaType()
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("attachment removed: %s, %s, sha256=%s", name, formatSize(len(data)), hex.EncodeToString(sum[:]))
+}
+
+// human readable size: 512 B, 1.2 KB, 3.4 MB
+func formatSize(size int) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / 1024
+	for _, unit := range []string{"KB", "MB", "GB"} {
+		if value < 1024 || unit == "GB" {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+		value /= 1024
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package mailbuilder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripAttachments(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nsee the attachment\r\n" +
+		"--b\r\nContent-Type: application/zip\r\nContent-Disposition: attachment; filename=invoice.zip\r\n" +
+		"Content-Description: the invoice\r\nContent-Transfer-Encoding: base64\r\n\r\nUEsDBA==\r\n--b--\r\n"
+	d := NewMessageDecomposer()
+	m, err := d.Decompose([]byte(raw), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := StripAttachments(m, func(p *Message) bool { return true }); n != 1 {
+		t.Fatalf("removed %d attachments, want 1", n)
+	}
+	placeholder := m.Parts[1]
+	text, _ := placeholder.DecodedText()
+	if placeholder.MediaType() != "text/plain" || !strings.HasPrefix(text, "attachment removed: invoice.zip, 4 B, sha256=") {
+		t.Errorf("got %s placeholder %q", placeholder.MediaType(), text)
+	}
+	if placeholder.Header.Get("Content-Description") != "the invoice" {
+		t.Errorf("the Content-* headers are lost: %v", placeholder.Header)
+	}
+	if placeholder.IsAttachment() || StripAttachments(m, func(p *Message) bool { return true }) != 0 {
+		t.Error("the placeholder is taken for an attachment")
+	}
+}
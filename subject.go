@@ -0,0 +1,30 @@
+package mailbuilder
+
+import (
+	"strings"
+)
+
+/**
+ * prepend tag (for example "[SPAM]") to the Subject; the RFC 2047 words are
+ * decoded and the non-ascii words encoded again as UTF-8; a Subject already
+ * containing the tag is not changed; returns true if the Subject was tagged
+ */
+func TagSubject(m *Message, tag string) bool {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return false
+	}
+
+	subject := strings.TrimSpace(decodeHeaderWords(m.GetHeader("Subject")))
+	if strings.Contains(strings.ToLower(subject), strings.ToLower(tag)) {
+		// already tagged
+		return false
+	}
+
+	tagged := tag
+	if subject != "" {
+		tagged += " " + subject
+	}
+	m.SetHeaderField("Subject", encodeWords(tagged))
+	return true
+}
@@ -0,0 +1,43 @@
+package mailbuilder
+
+import (
+	"testing"
+)
+
+func TestTagSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		tag     string
+		tagged  bool
+		want    string
+	}{
+		{"ascii", "Hello", "[SPAM]", true, "[SPAM] Hello"},
+		{"empty subject", "", "[SPAM]", true, "[SPAM]"},
+		{"already tagged", "[spam] Hello", "[SPAM]", false, "[spam] Hello"},
+		{"empty tag", "Hello", "  ", false, "Hello"},
+		{"encoded subject", "=?iso-8859-1?q?caf=E9?= time", "[SPAM]", true, "[SPAM] =?utf-8?q?caf=C3=A9?= time"},
+		{"encoded tag", "Hello", "[ÉXTERNE]", true, "=?utf-8?q?[=C3=89XTERNE]?= Hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := "Content-Type: text/plain\r\n\r\nbody\r\n"
+			if tt.subject != "" {
+				raw = "Subject: " + tt.subject + "\r\n" + raw
+			}
+			d := NewMessageDecomposer()
+			m, err := d.Decompose([]byte(raw), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := TagSubject(m, tt.tag); got != tt.tagged {
+				t.Errorf("got tagged %v, want %v", got, tt.tagged)
+			}
+			if got := m.Header.Get("Subject"); got != tt.want {
+				t.Errorf("got Subject %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
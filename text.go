@@ -0,0 +1,119 @@
+package mailbuilder
+
+import (
+	"strings"
+)
+
+/**
+ * return the readable text of the message: the text parts (nested
+ * message/rfc822 included) are decoded (transfer encoding and charset), the
+ * HTML is rendered as text and the attachments are skipped; only one part of
+ * a multipart/alternative is used, text/plain preferred, and only the last
+ * part of a multipart/x-mixed-replace; the other multiparts (parallel and
+ * unknown subtypes too) are read as multipart/mixed; the parts which
+ * can't be decoded are skipped and the first error is returned with the text
+ */
+func ExtractText(m *Message) (string, error) {
+	var texts []string
+	var firstErr error
+	m.collectText(&texts, &firstErr)
+	return strings.Join(texts, "\n\n"), firstErr
+}
+
+// append the readable text of the message or part to texts
+func (c *Message) collectText(texts *[]string, firstErr *error) {
+	switch {
+	case c.IsRfc822():
+		c.BodyMessage.collectText(texts, firstErr)
+
+	case c.IsMultipart():
+		if c.MediaType() == "multipart/alternative" {
+			if p := c.preferredAlternative(); p != nil {
+				p.collectText(texts, firstErr)
+			}
+			return
+		}
+		if c.MediaType() == "multipart/x-mixed-replace" {
+			// each part replaces the previous one
+			c.Parts[len(c.Parts)-1].collectText(texts, firstErr)
+			return
+		}
+		for _, p := range c.Parts {
+			p.collectText(texts, firstErr)
+		}
+
+	case c.isTextLeaf() && !c.IsAttachment():
+		text, err := c.readableText()
+		if err != nil {
+			if *firstErr == nil {
+				*firstErr = err
+			}
+			return
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			*texts = append(*texts, text)
+		}
+	}
+}
+
+// return the text of a text leaf part; HTML is rendered as plain text
+func (c *Message) readableText() (string, error) {
+	text, err := c.DecodedText()
+	if err != nil {
+		return "", err
+	}
+	if c.MediaType() == "text/html" {
+		return HTMLToText(text)
+	}
+	return text, nil
+}
+
+// return the text/plain part of a multipart/alternative, the last (richest) part otherwise
+func (c *Message) preferredAlternative() *Message {
+	for _, p := range c.Parts {
+		if p.MediaType() == "text/plain" {
+			return p
+		}
+	}
+	if len(c.Parts) == 0 {
+		return nil
+	}
+	return c.Parts[len(c.Parts)-1]
+}
+
+/**
+ * return a preview of the body like the webmail lists show: the text/plain
+ * body (the HTML one rendered as text if missing) decoded, with the white
+ * space collapsed and cut to maxLen characters at a word boundary when
+ * possible; maxLen <= 0 means no limit
+ */
+func (c *Message) Snippet(maxLen int) string {
+	p := c.findTextBody("text/plain")
+	if p == nil {
+		p = c.findTextBody("text/html")
+	}
+	if p == nil {
+		return ""
+	}
+	text, err := p.readableText()
+	if err != nil {
+		return ""
+	}
+
+	snippet := []rune(strings.Join(strings.Fields(text), " "))
+	if maxLen <= 0 || len(snippet) <= maxLen {
+		return string(snippet)
+	}
+
+	cut := maxLen
+	if snippet[cut] != ' ' {
+		// keep whole words unless the last one takes most of the snippet
+		for i := cut - 1; i > maxLen/2; i-- {
+			if snippet[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+	}
+	return strings.TrimRight(string(snippet[:cut]), " ")
+}
@@ -0,0 +1,74 @@
+package mailbuilder
+
+import (
+	"testing"
+)
+
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			"plain",
+			"Content-Type: text/plain\r\n\r\nHello world\r\n",
+			"Hello world",
+		},
+		{
+			"encoded latin-1",
+			"Content-Type: text/plain; charset=iso-8859-1\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\ncaf=E9\r\n",
+			"café",
+		},
+		{
+			"alternative prefers plain",
+			"Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nplain version\r\n" +
+				"--b\r\nContent-Type: text/html\r\n\r\n<p>html version</p>\r\n--b--\r\n",
+			"plain version",
+		},
+		{
+			"html only",
+			"Content-Type: text/html\r\n\r\n<html><body><p>Hello <b>world</b></p></body></html>\r\n",
+			"Hello world",
+		},
+		{
+			"attachment skipped",
+			"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nthe body\r\n" +
+				"--b\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=notes.txt\r\n\r\nthe notes\r\n--b--\r\n",
+			"the body",
+		},
+		{
+			"named attachment skipped",
+			"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nthe body\r\n" +
+				"--b\r\nContent-Type: text/plain; name=\"notes.txt\"\r\n\r\nthe notes\r\n--b--\r\n",
+			"the body",
+		},
+		{
+			"nested message",
+			"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nsee below\r\n" +
+				"--b\r\nContent-Type: message/rfc822\r\n\r\nSubject: inner\r\nContent-Type: text/plain\r\n\r\nforwarded text\r\n--b--\r\n",
+			"see below\n\nforwarded text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewMessageDecomposer()
+			m, err := d.Decompose([]byte(tt.raw), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ExtractText(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package tnef
+
+import (
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/axigenmessaging/mailbuilder"
+)
+
+// what is extracted when a TNEF part is replaced by MIME attachments
+type Options struct {
+	// add the RTF body as a body.rtf attachment
+	IncludeRTF bool
+
+	// add the HTML body as a body.html attachment
+	IncludeHTML bool
+}
+
+// check if a part is a TNEF attachment (application/ms-tnef or winmail.dat)
+func IsTNEF(p *mailbuilder.Message) bool {
+	if p.IsMultipart() || p.IsRfc822() {
+		return false
+	}
+	switch p.MediaType() {
+	case "application/ms-tnef", "application/vnd.ms-tnef":
+		return true
+	}
+	for _, field := range []string{"Content-Disposition", "Content-Type"} {
+		_, params, err := mime.ParseMediaType(p.Header.Get(field))
+		if err != nil {
+			continue
+		}
+		for _, key := range []string{"filename", "name"} {
+			if strings.EqualFold(params[key], "winmail.dat") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decode the TNEF parts of a message; the result is indexed by part Idx
+func Extract(m *mailbuilder.Message) (map[string]*Data, error) {
+	result := make(map[string]*Data)
+	var err error
+	m.Walk(func(p *mailbuilder.Message) bool {
+		if err != nil || !IsTNEF(p) {
+			return err == nil
+		}
+		var body []byte
+		body, err = p.DecodedBody()
+		if err != nil {
+			return false
+		}
+		var data *Data
+		data, err = Decode(body)
+		if err == nil {
+			result[p.Idx] = data
+		}
+		return err == nil
+	})
+	return result, err
+}
+
+/**
+ * rewrite the message replacing each TNEF part with normal MIME attachments;
+ * a TNEF part without content to extract is kept; returns the number of
+ * replaced TNEF parts
+ */
+func Expand(m *mailbuilder.Message, opts Options) (int, error) {
+	var tnefParts []*mailbuilder.Message
+	m.Walk(func(p *mailbuilder.Message) bool {
+		if IsTNEF(p) {
+			tnefParts = append(tnefParts, p)
+		}
+		return true
+	})
+
+	replaced := 0
+	for _, p := range tnefParts {
+		body, err := p.DecodedBody()
+		if err != nil {
+			return 0, err
+		}
+		data, err := Decode(body)
+		if err != nil {
+			return 0, err
+		}
+
+		parts := attachmentParts(data, opts)
+		if len(parts) == 0 {
+			// removing it would leave a multipart without parts
+			continue
+		}
+		replaced++
+
+		container := p.Parent
+		if container == nil || container.BodyMessage == p {
+			// the whole message is the TNEF attachment
+			p.ConvertToMultipart("mixed")
+			container, p = p, p.Parts[0]
+		}
+
+		position := 0
+		for i, sibling := range container.Parts {
+			if sibling == p {
+				position = i
+			}
+		}
+		if err := container.RemovePart(p); err != nil {
+			return 0, err
+		}
+		for i, part := range parts {
+			if err := container.InsertPart(position+i, part); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return replaced, nil
+}
+
+// create the MIME attachments for the TNEF content
+func attachmentParts(data *Data, opts Options) []*mailbuilder.Message {
+	var parts []*mailbuilder.Message
+
+	if opts.IncludeRTF && len(data.BodyRTF) > 0 {
+		parts = append(parts, attachmentPart("body.rtf", "application/rtf", "", data.BodyRTF))
+	}
+	if opts.IncludeHTML && len(data.BodyHTML) > 0 {
+		parts = append(parts, attachmentPart("body.html", "text/html", "", data.BodyHTML))
+	}
+
+	for _, attachment := range data.Attachments {
+		if attachment.Data == nil {
+			continue
+		}
+		parts = append(parts, attachmentPart(attachment.Filename(), attachment.MimeType, attachment.ContentID, attachment.Data))
+	}
+	return parts
+}
+
+// create an attachment part
+func attachmentPart(filename, contentType, contentID string, data []byte) *mailbuilder.Message {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if filename == "" {
+		filename = "attachment"
+	}
+
+	// the type from the extension may have parameters (charset)
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", map[string]string{}
+	}
+	params["name"] = filename
+
+	p := mailbuilder.NewPart(mime.FormatMediaType(mediaType, params), data, "base64")
+	p.SetHeaderField("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if contentID != "" {
+		p.SetHeaderField("Content-ID", "<"+strings.Trim(contentID, "<>")+">")
+	}
+	return p
+}
@@ -0,0 +1,89 @@
+package tnef
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+
+	"github.com/axigenmessaging/mailbuilder"
+)
+
+// a TNEF stream with the given attributes (level, id, value)
+func tnefStream(attributes ...interface{}) []byte {
+	data := make([]byte, 6)
+	binary.LittleEndian.PutUint32(data, tnefSignature)
+	for i := 0; i+2 < len(attributes); i += 3 {
+		value := []byte(attributes[i+2].(string))
+		header := make([]byte, 9)
+		header[0] = byte(attributes[i].(int))
+		binary.LittleEndian.PutUint32(header[1:], uint32(attributes[i+1].(int)))
+		binary.LittleEndian.PutUint32(header[5:], uint32(len(value)))
+		data = append(append(append(data, header...), value...), 0, 0)
+	}
+	return data
+}
+
+func TestExpand(t *testing.T) {
+	withAttachment := tnefStream(
+		levelAttachment, attAttachRendData, "",
+		levelAttachment, attAttachTitle, "notes.txt\x00",
+		levelAttachment, attAttachData, "the notes",
+	)
+	tests := []struct {
+		name     string
+		root     bool
+		tnef     []byte
+		replaced int
+		want     []string // the media types of the leaf parts
+	}{
+		{"attachment", false, withAttachment, 1, []string{"text/plain", "text/plain"}},
+		{"nothing to extract", false, tnefStream(), 0, []string{"text/plain", "application/ms-tnef"}},
+		{"root attachment", true, withAttachment, 1, []string{"text/plain"}},
+		{"root with nothing to extract", true, tnefStream(), 0, []string{"application/ms-tnef"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winmail := "Content-Type: application/ms-tnef; name=\"winmail.dat\"\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+				base64.StdEncoding.EncodeToString(tt.tnef) + "\r\n"
+			raw := "Subject: tnef\r\n" + winmail
+			if !tt.root {
+				raw = "Subject: tnef\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+					"--b\r\nContent-Type: text/plain\r\n\r\nthe body\r\n--b\r\n" + winmail + "--b--\r\n"
+			}
+			d := mailbuilder.NewMessageDecomposer()
+			m, err := d.Decompose([]byte(raw), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			replaced, err := Expand(m, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replaced != tt.replaced {
+				t.Errorf("replaced %d parts, want %d", replaced, tt.replaced)
+			}
+
+			b := mailbuilder.NewMessageBuilder()
+			rebuilt, err := d.Decompose(b.Build(m), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			rebuilt.Walk(func(p *mailbuilder.Message) bool {
+				if !p.IsMultipart() {
+					got = append(got, p.MediaType())
+				}
+				return true
+			})
+			if len(got) != len(tt.want) {
+				t.Fatalf("got leaf parts %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("part %d: got %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package tnef
+
+import (
+	"encoding/binary"
+)
+
+// MAPI property types
+const (
+	ptUnspecified = 0x0000
+	ptNull        = 0x0001
+	ptShort       = 0x0002
+	ptLong        = 0x0003
+	ptFloat       = 0x0004
+	ptDouble      = 0x0005
+	ptCurrency    = 0x0006
+	ptAppTime     = 0x0007
+	ptError       = 0x000a
+	ptBoolean     = 0x000b
+	ptObject      = 0x000d
+	ptI8          = 0x0014
+	ptString8     = 0x001e
+	ptUnicode     = 0x001f
+	ptSysTime     = 0x0040
+	ptCLSID       = 0x0048
+	ptBinary      = 0x0102
+
+	mvFlag = 0x1000
+)
+
+// a MAPI property; the values are kept raw (fixed size values without padding)
+type Property struct {
+	Type uint16
+	ID   uint16
+
+	// named properties are identified by a GUID and a numeric id or a name
+	Named bool
+	GUID  [16]byte
+	Name  string
+
+	Values [][]byte
+}
+
+// return the first value as a string (8 bit or unicode)
+func (p Property) String() string {
+	if len(p.Values) == 0 {
+		return ""
+	}
+	if p.Type&^mvFlag == ptUnicode {
+		return unicodeString(p.Values[0])
+	}
+	return cString(p.Values[0])
+}
+
+// size of the fixed size property types
+func fixedSize(t uint16) (int, bool) {
+	switch t {
+	case ptUnspecified, ptNull, ptShort, ptLong, ptFloat, ptError, ptBoolean:
+		return 4, true
+	case ptDouble, ptCurrency, ptAppTime, ptI8, ptSysTime:
+		return 8, true
+	case ptCLSID:
+		return 16, true
+	}
+	return 0, false
+}
+
+// a little endian reader over the property stream
+type propReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *propReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data)-r.pos < n {
+		r.err = ErrTruncated
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *propReader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (r *propReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+// skip the padding up to a multiple of 4 bytes
+func (r *propReader) align(n int) {
+	if pad := (4 - n%4) % 4; pad > 0 {
+		r.next(pad)
+	}
+}
+
+// decode an attMAPIProps/attAttachment property list
+func decodeProperties(data []byte) ([]Property, error) {
+	r := &propReader{data: data}
+	count := r.uint32()
+
+	var props []Property
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		prop := Property{
+			Type: r.uint16(),
+			ID:   r.uint16(),
+		}
+
+		if prop.ID >= 0x8000 {
+			prop.Named = true
+			copy(prop.GUID[:], r.next(16))
+			if r.uint32() == 0 {
+				prop.ID = uint16(r.uint32())
+			} else {
+				length := int(r.uint32())
+				prop.Name = unicodeString(r.next(length))
+				r.align(length)
+			}
+		}
+
+		baseType := prop.Type &^ mvFlag
+		valueCount := 1
+		if prop.Type&mvFlag != 0 || baseType == ptString8 || baseType == ptUnicode || baseType == ptBinary || baseType == ptObject {
+			valueCount = int(r.uint32())
+		}
+		if valueCount < 0 || valueCount > len(data) {
+			return nil, ErrTruncated
+		}
+
+		for j := 0; j < valueCount && r.err == nil; j++ {
+			switch baseType {
+			case ptString8, ptUnicode, ptBinary, ptObject:
+				length := int(r.uint32())
+				prop.Values = append(prop.Values, r.next(length))
+				r.align(length)
+			default:
+				size, ok := fixedSize(baseType)
+				if !ok {
+					return nil, &PropertyTypeError{Type: prop.Type}
+				}
+				value := r.next(size)
+				if len(value) < size {
+					return nil, ErrTruncated
+				}
+				if baseType == ptShort || baseType == ptBoolean {
+					value = value[:2]
+				}
+				prop.Values = append(prop.Values, value)
+			}
+		}
+		props = append(props, prop)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return props, nil
+}
@@ -0,0 +1,93 @@
+package tnef
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	rtfCompressed   = 0x75465a4c // "LZFu"
+	rtfUncompressed = 0x414c454d // "MELA"
+)
+
+// initial dictionary of the compressed RTF format ([MS-OXRTFCP])
+const rtfPrebuf = "{\\rtf1\\ansi\\mac\\deff0\\deftab720{\\fonttbl;}" +
+	"{\\f0\\fnil \\froman \\fswiss \\fmodern \\fscript \\fdecor MS Sans SerifSymbolArialTimes New RomanCourier" +
+	"{\\colortbl\\red0\\green0\\blue0\r\n\\par \\pard\\plain\\f0\\fs20\\b\\i\\u\\tab\\tx"
+
+var ErrInvalidRTF = errors.New("tnef: invalid compressed RTF")
+
+// decompress a PR_RTF_COMPRESSED value
+func DecompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, ErrInvalidRTF
+	}
+	compressedSize := int(binary.LittleEndian.Uint32(data))
+	rawSize := int(binary.LittleEndian.Uint32(data[4:]))
+	compression := binary.LittleEndian.Uint32(data[8:])
+
+	// the compressed size doesn't count its own field
+	end := compressedSize + 4
+	if end > len(data) || end < 16 {
+		end = len(data)
+	}
+
+	switch compression {
+	case rtfUncompressed:
+		if 16+rawSize > len(data) {
+			return nil, ErrInvalidRTF
+		}
+		return data[16 : 16+rawSize], nil
+	case rtfCompressed:
+	default:
+		return nil, ErrInvalidRTF
+	}
+
+	var dictionary [4096]byte
+	copy(dictionary[:], rtfPrebuf)
+	writePos := len(rtfPrebuf)
+
+	in := data[16:end]
+	// the raw size comes from the data: trust it only as far as the
+	// compressed bytes can expand, append grows the rest
+	capacity := rawSize
+	if limit := 4 * len(in); capacity > limit {
+		capacity = limit
+	}
+	out := make([]byte, 0, capacity)
+
+	for pos := 0; pos < len(in); {
+		control := in[pos]
+		pos++
+		for bit := 0; bit < 8 && pos < len(in); bit++ {
+			if control&(1<<uint(bit)) == 0 {
+				// literal
+				out = append(out, in[pos])
+				dictionary[writePos] = in[pos]
+				writePos = (writePos + 1) % len(dictionary)
+				pos++
+				continue
+			}
+
+			// dictionary reference: 12 bits offset, 4 bits length
+			if pos+1 >= len(in) {
+				return nil, ErrInvalidRTF
+			}
+			reference := int(in[pos])<<8 | int(in[pos+1])
+			pos += 2
+			offset := reference >> 4
+			length := reference&0xf + 2
+			if offset == writePos {
+				// end of stream
+				return out, nil
+			}
+			for i := 0; i < length; i++ {
+				c := dictionary[(offset+i)%len(dictionary)]
+				out = append(out, c)
+				dictionary[writePos] = c
+				writePos = (writePos + 1) % len(dictionary)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,256 @@
+/*
+Package tnef decodes the Transport Neutral Encapsulation Format used by
+Outlook/Exchange (application/ms-tnef parts, usually named winmail.dat):
+the embedded attachments and the RTF body are extracted and the message
+can be rewritten replacing winmail.dat with normal MIME attachments.
+*/
+package tnef
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+const tnefSignature = 0x223e9f78
+
+// attribute levels
+const (
+	levelMessage    = 0x01
+	levelAttachment = 0x02
+)
+
+// TNEF attributes (type in the high word)
+const (
+	attSubject        = 0x00018004
+	attMessageClass   = 0x00078008
+	attBody           = 0x0002800c
+	attAttachData     = 0x0006800f
+	attAttachTitle    = 0x00018010
+	attAttachRendData = 0x00069002
+	attMAPIProps      = 0x00069003
+	attAttachment     = 0x00069005
+)
+
+// MAPI property ids
+const (
+	prBody               = 0x1000
+	prRTFCompressed      = 0x1009
+	prBodyHTML           = 0x1013
+	prAttachDataBin      = 0x3701
+	prAttachFilename     = 0x3704
+	prAttachLongFilename = 0x3707
+	prAttachMimeTag      = 0x370e
+	prAttachContentID    = 0x3712
+)
+
+var (
+	ErrNotTNEF   = errors.New("tnef: invalid signature")
+	ErrTruncated = errors.New("tnef: truncated data")
+)
+
+// an attachment embedded in the TNEF stream
+type Attachment struct {
+	// short (8.3) file name
+	Title string
+
+	// long file name, if present
+	LongFilename string
+
+	// MIME content type, if present
+	MimeType string
+
+	// Content-ID, if present (inline images referenced by the RTF/HTML body)
+	ContentID string
+
+	Data []byte
+
+	// the MAPI properties of the attachment
+	Properties []Property
+}
+
+// return the best file name of the attachment
+func (a *Attachment) Filename() string {
+	if a.LongFilename != "" {
+		return a.LongFilename
+	}
+	return a.Title
+}
+
+// the content of a TNEF stream
+type Data struct {
+	Subject      string
+	MessageClass string
+
+	// plain text body (attBody or PR_BODY)
+	Body []byte
+
+	// HTML body (PR_BODY_HTML), if present
+	BodyHTML []byte
+
+	// decompressed RTF body (PR_RTF_COMPRESSED), if present
+	BodyRTF []byte
+
+	Attachments []*Attachment
+
+	// the MAPI properties of the message
+	Properties []Property
+}
+
+// decode a TNEF stream
+func Decode(data []byte) (*Data, error) {
+	if len(data) < 6 {
+		return nil, ErrTruncated
+	}
+	if binary.LittleEndian.Uint32(data) != tnefSignature {
+		return nil, ErrNotTNEF
+	}
+
+	result := &Data{}
+	var attachment *Attachment
+
+	for pos := 6; pos < len(data); {
+		if len(data)-pos < 9 {
+			return nil, ErrTruncated
+		}
+		level := data[pos]
+		id := binary.LittleEndian.Uint32(data[pos+1:])
+		length := int(binary.LittleEndian.Uint32(data[pos+5:]))
+		pos += 9
+		if length < 0 || len(data)-pos < length+2 {
+			return nil, ErrTruncated
+		}
+		value := data[pos : pos+length]
+		// skip the value and its checksum
+		pos += length + 2
+
+		if level == levelAttachment {
+			switch id {
+			case attAttachRendData:
+				attachment = &Attachment{}
+				result.Attachments = append(result.Attachments, attachment)
+			case attAttachTitle:
+				if attachment != nil {
+					attachment.Title = cString(value)
+				}
+			case attAttachData:
+				if attachment != nil {
+					attachment.Data = value
+				}
+			case attAttachment:
+				if attachment == nil {
+					continue
+				}
+				props, err := decodeProperties(value)
+				if err != nil {
+					return nil, err
+				}
+				attachment.Properties = props
+				attachment.applyProperties(props)
+			}
+			continue
+		}
+
+		switch id {
+		case attSubject:
+			result.Subject = cString(value)
+		case attMessageClass:
+			result.MessageClass = cString(value)
+		case attBody:
+			result.Body = value
+		case attMAPIProps:
+			props, err := decodeProperties(value)
+			if err != nil {
+				return nil, err
+			}
+			result.Properties = props
+			if err := result.applyProperties(props); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// fill the message fields from its MAPI properties
+func (d *Data) applyProperties(props []Property) error {
+	for _, prop := range props {
+		if prop.Named || len(prop.Values) == 0 {
+			continue
+		}
+		switch prop.ID {
+		case prBody:
+			if d.Body == nil {
+				d.Body = []byte(prop.String())
+			}
+		case prBodyHTML:
+			d.BodyHTML = []byte(prop.String())
+		case prRTFCompressed:
+			rtf, err := DecompressRTF(prop.Values[0])
+			if err != nil {
+				return err
+			}
+			d.BodyRTF = rtf
+		}
+	}
+	return nil
+}
+
+// fill the attachment fields from its MAPI properties
+func (a *Attachment) applyProperties(props []Property) {
+	for _, prop := range props {
+		if prop.Named || len(prop.Values) == 0 {
+			continue
+		}
+		switch prop.ID {
+		case prAttachLongFilename:
+			a.LongFilename = prop.String()
+		case prAttachFilename:
+			if a.Title == "" {
+				a.Title = prop.String()
+			}
+		case prAttachMimeTag:
+			a.MimeType = prop.String()
+		case prAttachContentID:
+			a.ContentID = prop.String()
+		case prAttachDataBin:
+			if a.Data == nil {
+				a.Data = prop.Values[0]
+			}
+		}
+	}
+}
+
+// return a null terminated 8 bit string
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// return a null terminated UTF-16LE string
+func unicodeString(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
+
+// error for an unknown MAPI property type
+type PropertyTypeError struct {
+	Type uint16
+}
+
+func (e *PropertyTypeError) Error() string {
+	return fmt.Sprintf("tnef: unsupported MAPI property type 0x%04x", e.Type)
+}
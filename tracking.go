@@ -0,0 +1,138 @@
+package mailbuilder
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// a Feedback-ID needs a SenderId and at most 3 other identifiers, without white space
+	ErrInvalidFeedbackID = errors.New("mailbuilder: invalid Feedback-ID")
+
+	ErrInvalidTrackingHeader = errors.New("mailbuilder: invalid tracking header field")
+)
+
+// the Feedback-ID of the feedback loops ("CampaignId:CustomerId:MailTypeId:SenderId")
+type FeedbackID struct {
+	// the optional identifiers
+	Campaign string
+	Customer string
+	MailType string
+
+	// the identifier of the sender, required
+	SenderID string
+}
+
+/**
+ * parse a Feedback-ID: the last identifier is the SenderId, the ones before
+ * it are the campaign, customer and mail type identifiers in this order
+ */
+func ParseFeedbackID(value string) (FeedbackID, error) {
+	identifiers := strings.Split(strings.TrimSpace(value), ":")
+	if len(identifiers) > 4 {
+		return FeedbackID{}, ErrInvalidFeedbackID
+	}
+	for _, identifier := range identifiers {
+		if !isFeedbackIdentifier(identifier) {
+			return FeedbackID{}, ErrInvalidFeedbackID
+		}
+	}
+
+	f := FeedbackID{SenderID: identifiers[len(identifiers)-1]}
+	fields := []*string{&f.Campaign, &f.Customer, &f.MailType}
+	for i, identifier := range identifiers[:len(identifiers)-1] {
+		*fields[i] = identifier
+	}
+	return f, nil
+}
+
+// return the field value; the empty identifiers are omitted, so the next ones move forward when parsed back
+func (f FeedbackID) Format() string {
+	var identifiers []string
+	for _, identifier := range []string{f.Campaign, f.Customer, f.MailType, f.SenderID} {
+		if identifier != "" {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+	return strings.Join(identifiers, ":")
+}
+
+// check the SenderId is set and the identifiers are valid
+func (f FeedbackID) Validate() error {
+	if f.SenderID == "" {
+		return ErrInvalidFeedbackID
+	}
+	for _, identifier := range []string{f.Campaign, f.Customer, f.MailType, f.SenderID} {
+		if identifier != "" && !isFeedbackIdentifier(identifier) {
+			return ErrInvalidFeedbackID
+		}
+	}
+	return nil
+}
+
+// return the Feedback-ID of the message; ok is false when it is missing or invalid
+func (c *Message) FeedbackID() (FeedbackID, bool) {
+	f, err := ParseFeedbackID(c.GetHeader("Feedback-ID"))
+	return f, err == nil
+}
+
+// the tracking fields stamped on a batch of messages by StampTracking
+type TrackingHeaders struct {
+	// the Feedback-ID (not written if its SenderId is empty)
+	FeedbackID FeedbackID
+
+	// the X-Campaign field ("" to omit)
+	Campaign string
+
+	// other fields (X-Mailer-Campaign-Id, X-Job, ...), in order
+	Fields []TrackingField
+}
+
+type TrackingField struct {
+	Name  string
+	Value string
+}
+
+/**
+ * set the tracking fields on every message (replacing the existing
+ * occurrences); the fields are validated first and nothing is changed if
+ * one is invalid
+ */
+func StampTracking(messages []*Message, t TrackingHeaders) error {
+	fields := make([]TrackingField, 0, len(t.Fields)+2)
+	if t.FeedbackID != (FeedbackID{}) {
+		if err := t.FeedbackID.Validate(); err != nil {
+			return err
+		}
+		fields = append(fields, TrackingField{Name: "Feedback-ID", Value: t.FeedbackID.Format()})
+	}
+	if t.Campaign != "" {
+		fields = append(fields, TrackingField{Name: "X-Campaign", Value: t.Campaign})
+	}
+	for _, field := range t.Fields {
+		if field.Name == "" || strings.ContainsAny(field.Name, ": \t\r\n") || strings.ContainsAny(field.Value, "\r\n") {
+			return ErrInvalidTrackingHeader
+		}
+		fields = append(fields, field)
+	}
+
+	for _, m := range messages {
+		for _, field := range fields {
+			m.SetHeaderField(field.Name, encodeWords(field.Value))
+		}
+	}
+	return nil
+}
+
+// an identifier of a Feedback-ID: printable ascii without white space or colon
+func isFeedbackIdentifier(identifier string) bool {
+	if identifier == "" {
+		return false
+	}
+	for i := 0; i < len(identifier); i++ {
+		if identifier[i] <= ' ' || identifier[i] >= 0x7f || identifier[i] == ':' {
+			return false
+		}
+	}
+	return true
+}
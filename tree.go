@@ -0,0 +1,62 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strconv"
+)
+
+// version of the EncodeTree format, incremented on incompatible changes
+const treeFormatVersion = 1
+
+// prefix of the EncodeTree data
+var treeMagic = []byte("MBT")
+
+var ErrInvalidTree = errors.New("mailbuilder: not an encoded message tree")
+
+// returned by DecodeTree for data written by an incompatible version
+type TreeVersionError struct {
+	Version int
+}
+
+func (e *TreeVersionError) Error() string {
+	return "mailbuilder: unsupported message tree format version " + strconv.Itoa(e.Version)
+}
+
+/**
+ * encode a decomposed message in a compact binary form (gob of the tree with
+ * the layout captured by the decomposer) to cache it between pipeline stages
+ * without parsing the raw message again; the data starts with a format version
+ */
+func EncodeTree(m *Message) ([]byte, error) {
+	j, err := m.toJSON(false)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.Write(treeMagic)
+	b.WriteByte(treeFormatVersion)
+	if err := gob.NewEncoder(&b).Encode(j); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// decode a message tree written by EncodeTree
+func DecodeTree(data []byte) (*Message, error) {
+	if len(data) < len(treeMagic)+1 || !bytes.HasPrefix(data, treeMagic) {
+		return nil, ErrInvalidTree
+	}
+	if version := int(data[len(treeMagic)]); version != treeFormatVersion {
+		return nil, &TreeVersionError{Version: version}
+	}
+
+	var j jsonMessage
+	if err := gob.NewDecoder(bytes.NewReader(data[len(treeMagic)+1:])).Decode(&j); err != nil {
+		return nil, err
+	}
+	m := &Message{}
+	m.fromJSON(&j, nil, 0)
+	return m, nil
+}
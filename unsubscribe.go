@@ -0,0 +1,85 @@
+package mailbuilder
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// the List-Unsubscribe-Post value of a one-click unsubscription (RFC 8058)
+const oneClickUnsubscribe = "List-Unsubscribe=One-Click"
+
+var (
+	// a one-click unsubscription needs an https URL, a mailto alone is not enough
+	ErrNoHTTPSUnsubscribe = errors.New("mailbuilder: one-click unsubscribe requires an https List-Unsubscribe URL")
+
+	ErrNoOneClickUnsubscribe = errors.New("mailbuilder: missing List-Unsubscribe-Post: " + oneClickUnsubscribe)
+
+	// the DKIM-Signature must cover List-Unsubscribe and List-Unsubscribe-Post
+	ErrUnsubscribeNotSigned = errors.New("mailbuilder: no DKIM-Signature covers List-Unsubscribe and List-Unsubscribe-Post")
+)
+
+/**
+ * set a one-click unsubscription (RFC 8058): List-Unsubscribe with the https
+ * URL (first) and the optional mailto URLs, and List-Unsubscribe-Post; the
+ * fields must then be covered by the DKIM signature of the message (see
+ * CheckOneClickUnsubscribe)
+ */
+func (c *Message) SetOneClickUnsubscribe(httpsURL string, mailto ...string) error {
+	u, err := url.Parse(strings.Trim(strings.TrimSpace(httpsURL), "<>"))
+	if err != nil || !strings.EqualFold(u.Scheme, "https") || u.Host == "" {
+		return ErrNoHTTPSUnsubscribe
+	}
+	for _, raw := range mailto {
+		if m, err := url.Parse(strings.Trim(strings.TrimSpace(raw), "<>")); err != nil || !strings.EqualFold(m.Scheme, "mailto") {
+			return ErrInvalidListURL
+		}
+	}
+	if err := c.SetListUnsubscribe(append([]string{u.String()}, mailto...)...); err != nil {
+		return err
+	}
+	c.SetHeaderField("List-Unsubscribe-Post", oneClickUnsubscribe)
+	return nil
+}
+
+/**
+ * check the one-click unsubscription of a message ready to be sent: an
+ * https List-Unsubscribe URL, the List-Unsubscribe-Post field and a
+ * DKIM-Signature whose signed fields (h=) include both
+ */
+func CheckOneClickUnsubscribe(m *Message) error {
+	hasHTTPS := false
+	for _, u := range m.ListUnsubscribe() {
+		if strings.EqualFold(u.Scheme, "https") && u.Host != "" {
+			hasHTTPS = true
+		}
+	}
+	if !hasHTTPS {
+		return ErrNoHTTPSUnsubscribe
+	}
+	if strings.TrimSpace(m.GetHeader("List-Unsubscribe-Post")) != oneClickUnsubscribe {
+		return ErrNoOneClickUnsubscribe
+	}
+	for _, signature := range m.GetHeaderValues("DKIM-Signature") {
+		signed := dkimSignedFields(signature)
+		if signed["list-unsubscribe"] && signed["list-unsubscribe-post"] {
+			return nil
+		}
+	}
+	return ErrUnsubscribeNotSigned
+}
+
+// the lower case names of the h= tag of a DKIM-Signature
+func dkimSignedFields(signature string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, tag := range strings.Split(signature, ";") {
+		name, value, found := strings.Cut(tag, "=")
+		if !found || strings.TrimSpace(name) != "h" {
+			continue
+		}
+		for _, field := range strings.Split(value, ":") {
+			fields[strings.ToLower(strings.Join(strings.Fields(field), ""))] = true
+		}
+	}
+	return fields
+}
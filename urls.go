@@ -0,0 +1,150 @@
+package mailbuilder
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// an URL found in a message
+type FoundURL struct {
+	// the URL as written (entities decoded for HTML)
+	URL string
+
+	// index of the part holding the URL (the message Idx for the headers)
+	Idx string
+
+	// where the URL was found: "text", "html:href", "html:src", ... or "header:<field>"
+	Source string
+
+	// the text around the URL, the link text for an HTML link
+	Context string
+}
+
+// the URLs written in plain text
+var textURLRegexp = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp)://|www\.)[^\s<>"'()\[\]{}]+`)
+
+// the HTML attributes holding an URL
+var htmlURLAttributes = []string{"href", "src", "action", "background", "cite", "poster"}
+
+// characters around an URL kept as context
+const urlContextLength = 40
+
+/**
+ * return the URLs of the message: the ones written in the text parts, the
+ * HTML links and resources (href, src, ...) and the ones of the header
+ * fields (List-Unsubscribe, ...); the parts are decoded (transfer encoding
+ * and charset) and nested messages are searched too; the parts which can't
+ * be decoded are skipped
+ */
+func ExtractURLs(m *Message) []FoundURL {
+	result := make([]FoundURL, 0)
+	m.Walk(func(p *Message) bool {
+		if p.Parent == nil || p.Parent.BodyMessage == p {
+			result = append(result, headerURLs(p)...)
+		}
+		if !p.isTextLeaf() {
+			return true
+		}
+		text, err := p.DecodedText()
+		if err != nil {
+			return true
+		}
+		if p.MediaType() == "text/html" {
+			result = append(result, htmlURLs(p.Idx, text)...)
+		} else {
+			result = append(result, textURLs(p.Idx, "text", text)...)
+		}
+		return true
+	})
+	return result
+}
+
+// the URLs of the header fields of a message
+func headerURLs(m *Message) []FoundURL {
+	header := m.LoadHeader()
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]FoundURL, 0)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			result = append(result, textURLs(m.Idx, "header:"+key, decodeHeaderWords(value))...)
+		}
+	}
+	return result
+}
+
+// the URLs written in a text with the text around them
+func textURLs(idx, source, text string) []FoundURL {
+	result := make([]FoundURL, 0)
+	for _, loc := range textURLRegexp.FindAllStringIndex(text, -1) {
+		url := strings.TrimRight(text[loc[0]:loc[1]], ".,;:!?")
+		result = append(result, FoundURL{
+			URL:     url,
+			Idx:     idx,
+			Source:  source,
+			Context: urlContext(text, loc[0], loc[0]+len(url)),
+		})
+	}
+	return result
+}
+
+// the text around text[start:end] on the same line, cut at urlContextLength bytes each side
+func urlContext(text string, start, end int) string {
+	from := start - urlContextLength
+	if from < 0 {
+		from = 0
+	}
+	if i := strings.LastIndexByte(text[from:start], '\n'); i != -1 {
+		from += i + 1
+	}
+	to := end + urlContextLength
+	if to > len(text) {
+		to = len(text)
+	}
+	if i := strings.IndexByte(text[end:to], '\n'); i != -1 {
+		to = end + i
+	}
+	return strings.TrimSpace(strings.ToValidUTF8(text[from:to], ""))
+}
+
+// the URLs of the HTML attributes and text
+func htmlURLs(idx, document string) []FoundURL {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return textURLs(idx, "text", document)
+	}
+
+	result := make([]FoundURL, 0)
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			for _, name := range htmlURLAttributes {
+				value := strings.TrimSpace(htmlAttr(n, name))
+				if value == "" || strings.HasPrefix(value, "#") {
+					continue
+				}
+				result = append(result, FoundURL{
+					URL:     value,
+					Idx:     idx,
+					Source:  "html:" + name,
+					Context: strings.Join(strings.Fields(htmlText(n)), " "),
+				})
+			}
+		case html.TextNode:
+			result = append(result, textURLs(idx, "html:text", n.Data)...)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(root)
+	return result
+}
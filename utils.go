@@ -9,13 +9,14 @@ import (
 	"io/ioutil"
 	"crypto/rand"
 	"fmt"
+	"regexp"
 )
 
 /**
  * Try to encode bytes using mime encoding
  */
 func EncodeByContentEncoding(body []byte, encoding string) []byte {
-	switch encoding {
+	switch normalizeEncoding(encoding) {
 	case "base64":
 		b := make([]byte, base64.StdEncoding.EncodedLen(len(body)))
 		base64.StdEncoding.Encode(b, body)
@@ -27,35 +28,106 @@ func EncodeByContentEncoding(body []byte, encoding string) []byte {
 		qpWriter.Write(body)
 		qpWriter.Close()
 		return b.Bytes()
+	case "x-uuencode", "uuencode", "x-uue", "uue":
+		return UUEncode(body, "message", 0644)
+	case "binary", "8bit", "7bit":
+		// identity encodings: no line breaking, the length is preserved
+		return body
 	default:
 		return body
 	}
 }
 
+// encode text as quoted-printable keeping the line breaks as soft text line breaks
+func EncodeQuotedPrintableText(body []byte) []byte {
+	b := bytes.NewBuffer([]byte{})
+	qpWriter := quotedprintable.NewWriter(b)
+	qpWriter.Write(body)
+	qpWriter.Close()
+	return b.Bytes()
+}
+
 
 /**
  * Try to decode mime encoded bytes
  */
 func DecodeByContentEncoding(body []byte, encoding string) ([]byte, bool, error) {
-	switch encoding {
+	data, isDecoded, _, err := DecodeByContentEncodingWithWarnings(body, encoding)
+	return data, isDecoded, err
+}
+
+/**
+ * Try to decode mime encoded bytes; broken encodings which could still be
+ * decoded (base64 with the URL-safe alphabet, ...) are reported as warnings
+ */
+func DecodeByContentEncodingWithWarnings(body []byte, encoding string) ([]byte, bool, []string, error) {
+	switch normalizeEncoding(encoding) {
 	case "base64":
 		//fmt.Println("-----------", string(body), "\r\n-------------")
 		data, err := base64.StdEncoding.DecodeString(strings.Trim(string(body), "\r\n\t"))
 		if err != nil {
-			return nil, false, err
+			data, warning, fallbackErr := decodeBase64Tolerant(body)
+			if fallbackErr != nil {
+				return nil, false, nil, err
+			}
+			return data, true, []string{warning}, nil
 		}
-		return data, true, nil
+		return data, true, nil, nil
 	case "quoted-printable":
 		data, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(string(body))))
 		if err != nil {
-			return nil, false, err
+			return nil, false, nil, err
 		}
-		return data, true, nil
+		return data, true, nil, nil
+	case "x-uuencode", "uuencode", "x-uue", "uue":
+		file, err := UUDecode(body)
+		if err != nil {
+			return nil, false, nil, err
+		}
+		return file.Data, true, nil, nil
+	case "binary", "8bit", "7bit":
+		return body, false, nil, nil
 	default:
-		return body, false, nil
+		return body, false, nil, nil
 	}
 }
 
+/**
+ * decode base64 produced by broken senders: URL-safe alphabet ('-' and '_'),
+ * whitespace inside the lines and missing padding
+ */
+func decodeBase64Tolerant(body []byte) ([]byte, string, error) {
+	urlSafe := false
+	cleaned := make([]byte, 0, len(body))
+	for _, c := range body {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '-':
+			urlSafe = true
+			c = '+'
+		case '_':
+			urlSafe = true
+			c = '/'
+		}
+		cleaned = append(cleaned, c)
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(string(cleaned), "="))
+	if err != nil {
+		return nil, "", err
+	}
+	if urlSafe {
+		return data, "base64 body decoded with the URL-safe alphabet", nil
+	}
+	return data, "malformed base64 body (whitespace or padding) decoded", nil
+}
+
+// normalize a Content-Transfer-Encoding value
+func normalizeEncoding(encoding string) string {
+	return strings.ToLower(strings.TrimSpace(encoding))
+}
+
 /**
  * generate a random boundary
  */
@@ -114,26 +186,108 @@ func StringBreakLines(data string, charsNo int, lineSeparator string) string {
  * for debugging purposes, return the message structure decoded
  */
 func DebugMessageStructure(m *Message, prefix string) string {
-	result := ""
-	result += fmt.Sprintf(prefix+"IDX: %s\r\n", m.Idx)
-	result += fmt.Sprintf(prefix+"Content-Type: %s\r\n", m.Header.Get("Content-Type"))
-	result += fmt.Sprintf(prefix+"Is Multipart: %t\r\n", m.IsMultipart())
-	result += fmt.Sprintf(prefix+"Is RFC822: %t\r\n", m.IsRfc822())
+	return DebugMessageStructureWithOptions(m, prefix, DebugOptions{})
+}
+
+// options making the debug output safe to put into logs
+type DebugOptions struct {
+	// header fields printed for each node (From, To, Subject, ...)
+	Headers []string
+
+	// replace the addresses found in the printed values with j***@example.com
+	MaskAddresses bool
+
+	// truncate the Subject to this number of characters (0 means no limit)
+	MaxSubjectLength int
+
+	// print only the media type, without parameters (names, boundaries)
+	HideParameters bool
+
+	// cap the output size in bytes (0 means no limit)
+	MaxBytes int
+
+	// maximum depth printed (0 means no limit)
+	MaxDepth int
+}
+
+var debugAddressRegexp = regexp.MustCompile(`([^\s<>"'(),;:@]+)@([^\s<>"'(),;:]+)`)
+
+/**
+ * return the message structure decoded; header values are redacted and the
+ * output is capped as specified by the options
+ */
+func DebugMessageStructureWithOptions(m *Message, prefix string, opts DebugOptions) string {
+	var b strings.Builder
+	debugMessageStructure(&b, m, prefix, 0, opts)
+
+	if opts.MaxBytes > 0 && b.Len() > opts.MaxBytes {
+		result := b.String()[:opts.MaxBytes]
+		// don't cut the last line in the middle
+		if i := strings.LastIndex(result, "\r\n"); i != -1 {
+			result = result[:i+2]
+		}
+		return result + prefix + "... output truncated\r\n"
+	}
+	return b.String()
+}
+
+func debugMessageStructure(b *strings.Builder, m *Message, prefix string, depth int, opts DebugOptions) {
+	if opts.MaxBytes > 0 && b.Len() > opts.MaxBytes {
+		// the output is truncated anyway
+		return
+	}
+
+	contentType := m.Header.Get("Content-Type")
+	if opts.HideParameters {
+		contentType = m.MediaType()
+	}
+
+	fmt.Fprintf(b, prefix+"IDX: %s\r\n", m.Idx)
+	fmt.Fprintf(b, prefix+"Content-Type: %s\r\n", debugValue("Content-Type", contentType, opts))
+	for _, field := range opts.Headers {
+		for _, value := range m.GetHeaderValues(field) {
+			fmt.Fprintf(b, prefix+"%s: %s\r\n", field, debugValue(field, value, opts))
+		}
+	}
+	fmt.Fprintf(b, prefix+"Is Multipart: %t\r\n", m.IsMultipart())
+	fmt.Fprintf(b, prefix+"Is RFC822: %t\r\n", m.IsRfc822())
+
+	if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		if m.IsRfc822() || len(m.Parts) > 0 {
+			fmt.Fprintf(b, prefix+"... max depth reached\r\n")
+		}
+		return
+	}
 
 	if m.IsRfc822() {
 		prefix += "     "
-		//fmt.Println(prefix, "Unpack Body: ", m.IsMultipart())
-		result += DebugMessageStructure(m.BodyMessage, prefix)
+		debugMessageStructure(b, m.BodyMessage, prefix, depth+1, opts)
 	}
 
-	result += fmt.Sprintf(prefix+"Parts: %d\r\n", len(m.Parts))
+	fmt.Fprintf(b, prefix+"Parts: %d\r\n", len(m.Parts))
 
 	if len(m.Parts) > 0 {
 		prefix += "     "
 		for _, p := range m.Parts {
-			result += DebugMessageStructure(p, prefix)
+			debugMessageStructure(b, p, prefix, depth+1, opts)
 		}
 	}
+}
 
-	return result
-}
\ No newline at end of file
+// redact a header value for the debug output
+func debugValue(field, value string, opts DebugOptions) string {
+	if strings.EqualFold(field, "Subject") && opts.MaxSubjectLength > 0 {
+		value = decodeHeaderWords(value)
+		if runes := []rune(value); len(runes) > opts.MaxSubjectLength {
+			value = string(runes[:opts.MaxSubjectLength]) + "..."
+		}
+	}
+	if opts.MaskAddresses {
+		value = debugAddressRegexp.ReplaceAllStringFunc(value, func(address string) string {
+			at := strings.LastIndex(address, "@")
+			local := []rune(address[:at])
+			return string(local[0]) + "***" + address[at:]
+		})
+	}
+	return value
+}
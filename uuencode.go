@@ -0,0 +1,222 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ErrUUEncodeMissingBegin = errors.New("mailbuilder: uuencoded data has no begin line")
+
+// a uuencoded blob found in a message
+type UUEncodedFile struct {
+	Name string
+	Mode uint32
+	Data []byte
+}
+
+/**
+ * decode the first uuencoded block of data ("begin <mode> <name>" ... "end");
+ * the data may contain text before the begin line
+ */
+func UUDecode(data []byte) (*UUEncodedFile, error) {
+	files, err := uudecodeAll(data, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrUUEncodeMissingBegin
+	}
+	return files[0], nil
+}
+
+// decode at most max uuencoded blocks of data (all when max <= 0)
+func uudecodeAll(data []byte, max int) ([]*UUEncodedFile, error) {
+	var (
+		files   []*UUEncodedFile
+		current *UUEncodedFile
+	)
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+
+		if current == nil {
+			if file, ok := parseUUBeginLine(line); ok {
+				current = file
+			}
+			continue
+		}
+
+		if bytes.Equal(bytes.TrimSpace(line), []byte("end")) {
+			files = append(files, current)
+			current = nil
+			if max > 0 && len(files) >= max {
+				break
+			}
+			continue
+		}
+
+		decoded, err := uudecodeLine(line)
+		if err != nil {
+			return files, err
+		}
+		current.Data = append(current.Data, decoded...)
+	}
+
+	if current != nil {
+		// tolerate a missing end line
+		files = append(files, current)
+	}
+	return files, nil
+}
+
+// parse "begin 644 name"
+func parseUUBeginLine(line []byte) (*UUEncodedFile, bool) {
+	if !bytes.HasPrefix(line, []byte("begin ")) {
+		return nil, false
+	}
+	fields := strings.SplitN(strings.TrimSpace(string(line[len("begin "):])), " ", 2)
+	if len(fields) != 2 {
+		return nil, false
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		return nil, false
+	}
+	return &UUEncodedFile{Name: strings.TrimSpace(fields[1]), Mode: uint32(mode)}, true
+}
+
+// decode one uuencoded line; the first character holds the decoded length
+func uudecodeLine(line []byte) ([]byte, error) {
+	if len(line) == 0 {
+		return nil, nil
+	}
+	n := int((line[0] - ' ') & 0x3f)
+	if n == 0 {
+		return nil, nil
+	}
+
+	result := make([]byte, 0, n)
+	chars := line[1:]
+	for i := 0; len(result) < n; i += 4 {
+		var group [4]byte
+		for j := 0; j < 4; j++ {
+			// trailing spaces are often stripped by mail systems
+			c := byte(' ')
+			if i+j < len(chars) {
+				c = chars[i+j]
+			}
+			if c < ' ' || c > '`' {
+				return nil, fmt.Errorf("mailbuilder: invalid uuencoded character %q", c)
+			}
+			group[j] = (c - ' ') & 0x3f
+		}
+		decoded := []byte{
+			group[0]<<2 | group[1]>>4,
+			group[1]<<4 | group[2]>>2,
+			group[2]<<6 | group[3],
+		}
+		for _, b := range decoded {
+			if len(result) < n {
+				result = append(result, b)
+			}
+		}
+	}
+	return result, nil
+}
+
+// uuencode data as a "begin <mode> <name>" ... "end" block
+func UUEncode(data []byte, name string, mode uint32) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "begin %o %s\n", mode, name)
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > 45 {
+			n = 45
+		}
+		chunk := data[:n]
+		data = data[n:]
+
+		b.WriteByte(uuencodeChar(byte(n)))
+		for i := 0; i < len(chunk); i += 3 {
+			var group [3]byte
+			copy(group[:], chunk[i:])
+			b.WriteByte(uuencodeChar(group[0] >> 2))
+			b.WriteByte(uuencodeChar(group[0]<<4&0x30 | group[1]>>4))
+			b.WriteByte(uuencodeChar(group[1]<<2&0x3c | group[2]>>6))
+			b.WriteByte(uuencodeChar(group[2] & 0x3f))
+		}
+		b.WriteByte('\n')
+	}
+
+	b.WriteString("`\nend\n")
+	return b.Bytes()
+}
+
+// encode a 6 bits value; zero is written as a backquote instead of a space
+func uuencodeChar(v byte) byte {
+	if v == 0 {
+		return '`'
+	}
+	return v + ' '
+}
+
+/**
+ * find the uuencoded blobs of the message: the parts with a x-uuencode
+ * Content-Transfer-Encoding, whatever their media type, and the "begin 644
+ * name" blocks inlined in the other text/plain parts; each blob is returned as a synthetic attachment part
+ * (not added to the tree) indexed after the part holding it
+ */
+func ExtractUUEncoded(m *Message) []*Message {
+	var result []*Message
+
+	m.Walk(func(p *Message) bool {
+		if p.IsMultipart() || p.IsRfc822() {
+			return true
+		}
+
+		var files []*UUEncodedFile
+		if isUUEncoding(p.ContentTransferEncoding()) {
+			// whatever the media type
+			body, err := p.rawBody()
+			if err != nil {
+				return true
+			}
+			files, _ = uudecodeAll(body, 0)
+		} else if p.MediaType() == "text/plain" {
+			body, err := p.DecodedBody()
+			if err != nil || !bytes.Contains(body, []byte("begin ")) {
+				return true
+			}
+			files, _ = uudecodeAll(body, 0)
+		}
+
+		for i, file := range files {
+			contentType := mime.TypeByExtension(path.Ext(file.Name))
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			part := NewPart(contentType, file.Data, "base64")
+			part.SetHeaderField("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+			part.Idx = p.Idx + "-uu" + strconv.Itoa(i+1)
+			result = append(result, part)
+		}
+		return true
+	})
+
+	return result
+}
+
+// check if a Content-Transfer-Encoding is one of the uuencode variants
+func isUUEncoding(encoding string) bool {
+	switch normalizeEncoding(encoding) {
+	case "x-uuencode", "uuencode", "x-uue", "uue":
+		return true
+	}
+	return false
+}
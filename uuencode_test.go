@@ -0,0 +1,30 @@
+package mailbuilder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExtractUUEncoded(t *testing.T) {
+	data := []byte("a payload longer than the forty five bytes of a uuencoded line\x00\x01")
+	encoded := string(bytes.ReplaceAll(UUEncode(data, "a.bin", 0644), []byte("\n"), []byte("\r\n")))
+
+	for name, raw := range map[string]string{
+		"inline":   "Content-Type: text/plain\r\n\r\nsee the file\r\n" + encoded,
+		"encoding": "Content-Type: application/octet-stream\r\nContent-Transfer-Encoding: x-uuencode\r\n\r\n" + encoded,
+	} {
+		d := NewMessageDecomposer()
+		m, err := d.Decompose([]byte(raw), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := ExtractUUEncoded(m)
+		if len(parts) != 1 {
+			t.Errorf("%s: got %d parts, want 1", name, len(parts))
+			continue
+		}
+		if decoded, _ := parts[0].DecodedBody(); !bytes.Equal(decoded, data) || parts[0].Filename() != "a.bin" {
+			t.Errorf("%s: got %q named %q", name, decoded, parts[0].Filename())
+		}
+	}
+}
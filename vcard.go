@@ -0,0 +1,127 @@
+package mailbuilder
+
+import (
+	"errors"
+	"mime"
+	"path"
+	"strings"
+)
+
+// returned for data which is not a vCard (BEGIN:VCARD ... END:VCARD)
+var ErrInvalidVCard = errors.New("mailbuilder: invalid vCard (missing BEGIN:VCARD)")
+
+// a vCard part of a message
+type VCardPart struct {
+	Part *Message
+
+	// the decoded file name ("" if none)
+	Filename string
+}
+
+/**
+ * check if the part is a vCard: text/vcard, text/x-vcard, a text/directory
+ * with profile=vCard or a generic attachment named *.vcf
+ */
+func (c *Message) IsVCard() bool {
+	if c.IsMultipart() || c.IsRfc822() {
+		return false
+	}
+	switch mediaType := c.MediaType(); mediaType {
+	case "text/vcard", "text/x-vcard":
+		return true
+	case "text/directory":
+		_, params, err := mime.ParseMediaType(c.Header.Get("Content-Type"))
+		return err == nil && strings.EqualFold(params["profile"], "vcard")
+	case "application/octet-stream", "text/plain":
+		return strings.EqualFold(path.Ext(c.Filename()), ".vcf")
+	}
+	return false
+}
+
+// return the vCard parts of the message (the attached messages included); StripAttachments removes them with IsVCard as policy
+func (c *Message) VCardParts() []*VCardPart {
+	var parts []*VCardPart
+	c.Walk(func(p *Message) bool {
+		if p.IsVCard() {
+			parts = append(parts, &VCardPart{Part: p, Filename: p.Filename()})
+		}
+		return true
+	})
+	return parts
+}
+
+/**
+ * return the decoded vCard (UTF-8): the charset parameter is used when set,
+ * UTF-8 otherwise (the default of vCard 4.0)
+ */
+func (c *VCardPart) VCard() (string, error) {
+	if c.Part.EffectiveCharset() != "" {
+		return c.Part.DecodedText()
+	}
+	data, err := c.Part.DecodedBody()
+	return string(data), err
+}
+
+// return the value of the first property (FN, VERSION, EMAIL, ...) of the vCard; "" if missing
+func (c *VCardPart) Property(name string) string {
+	vcard, err := c.VCard()
+	if err != nil {
+		return ""
+	}
+	return vcardProperty(vcard, name)
+}
+
+/**
+ * add a vCard (a signature card) as a text/vcard attachment, the message
+ * becoming multipart/mixed if needed; filename defaults to the formatted
+ * name (FN) with the .vcf extension
+ */
+func AttachVCard(m *Message, vcard string, filename string) error {
+	if !strings.Contains(strings.ToUpper(vcard), "BEGIN:VCARD") {
+		return ErrInvalidVCard
+	}
+	if filename == "" {
+		filename = vcardProperty(vcard, "FN")
+		if filename == "" {
+			filename = "contact"
+		}
+		filename += ".vcf"
+	}
+
+	p := NewPart(mime.FormatMediaType("text/vcard", map[string]string{"charset": "utf-8", "name": filename}), nil, "7bit")
+	p.SetText(string(ConvertNewlines([]byte(vcard), "\r\n")))
+	p.SetHeaderField("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	if m.MediaType() != "multipart/mixed" {
+		m.wrapContent("mixed")
+	}
+	m.AddPart(p)
+	return nil
+}
+
+// the value of the first property of a vCard, folded lines joined; the parameters ("FN;CHARSET=utf-8:") are skipped
+func vcardProperty(vcard, name string) string {
+	lines := strings.Split(strings.ReplaceAll(vcard, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		property, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		property, _, _ = strings.Cut(property, ";")
+		if dot := strings.LastIndexByte(property, '.'); dot != -1 {
+			// a group ("item1.EMAIL")
+			property = property[dot+1:]
+		}
+		if !strings.EqualFold(property, name) {
+			continue
+		}
+		for _, next := range lines[i+1:] {
+			if len(next) == 0 || (next[0] != ' ' && next[0] != '\t') {
+				break
+			}
+			value += next[1:]
+		}
+		return strings.TrimSpace(value)
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package mailbuilder
+
+import (
+	"strings"
+)
+
+/**
+ * return the VERP reverse path of a recipient: local+recipient=domain@domain
+ * ("bounces+bob=example.org@example.com"), the "@" of the recipient written "="
+ */
+func VERPAddress(local, domain, recipient string) string {
+	if i := strings.LastIndexByte(recipient, '@'); i != -1 {
+		recipient = recipient[:i] + "=" + recipient[i+1:]
+	}
+	return local + "+" + recipient + "@" + domain
+}
+
+/**
+ * return the recipient encoded in a VERP address (the recipient of a bounce)
+ * built with the given local part; ok is false for another address
+ */
+func ParseVERPAddress(address, local string) (recipient string, ok bool) {
+	address = strings.Trim(strings.TrimSpace(address), "<>")
+	at := strings.LastIndexByte(address, '@')
+	if at == -1 || !strings.HasPrefix(strings.ToLower(address[:at]), strings.ToLower(local)+"+") {
+		return "", false
+	}
+	encoded := address[len(local)+1 : at]
+	i := strings.LastIndexByte(encoded, '=')
+	if i <= 0 || i == len(encoded)-1 {
+		return "", false
+	}
+	return encoded[:i] + "@" + encoded[i+1:], true
+}
+
+/**
+ * specify the local part and the domain of the VERP reverse paths; the
+ * messages with a single envelope recipient are built with the
+ * Return-Path (and the envelope reverse path) of that recipient (see
+ * BuildForRecipient); an empty local part disables VERP
+ */
+func (c *MessageBuilder) SetVERP(local, domain string) {
+	c.verpLocal, c.verpDomain = local, domain
+}
+
+func (c *MessageBuilder) GetVERP() (string, string) {
+	return c.verpLocal, c.verpDomain
+}
+
+/**
+ * build the message for a single recipient: the SMTP envelope of the built
+ * copy has only this recipient so the VERP Return-Path is written when
+ * enabled (see SetVERP); m itself is not modified
+ */
+func (c *MessageBuilder) BuildForRecipient(m *Message, recipient string) []byte {
+	envelope := &SMTPEnvelope{RcptTo: []string{recipient}}
+	if m.SMTPEnvelope != nil {
+		envelope.MailFrom, envelope.Params = m.SMTPEnvelope.MailFrom, m.SMTPEnvelope.Params
+	}
+	root := *m
+	root.SMTPEnvelope = envelope
+	return c.Build(&root)
+}
+
+// return m with the VERP Return-Path of its single recipient; m itself is not modified
+func (c *MessageBuilder) withVERP(m *Message) *Message {
+	if m.SMTPEnvelope == nil || len(m.SMTPEnvelope.RcptTo) != 1 {
+		return m
+	}
+	envelope := *m.SMTPEnvelope
+	envelope.MailFrom = VERPAddress(c.verpLocal, c.verpDomain, envelope.RcptTo[0])
+
+	root := copyRootHeader(m)
+	root.SMTPEnvelope = &envelope
+	root.SyncReturnPath()
+	return root
+}
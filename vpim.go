@@ -0,0 +1,166 @@
+package mailbuilder
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VPIM v2 (RFC 3801) voice content values of the Content-Disposition voice parameter
+const (
+	VoiceMessage             = "Voice-Message"
+	VoiceMessageNotification = "Voice-Message-Notification"
+	OriginatorSpokenName     = "Originator-Spoken-Name"
+	RecipientSpokenName      = "Recipient-Spoken-Name"
+	SpokenSubject            = "Spoken-Subject"
+)
+
+// the audio encoding required by VPIM v2
+const vpimAudioType = "audio/32kadpcm"
+
+// the components of a VPIM v2 voice message
+type VPIMMessage struct {
+	From    string
+	To      string
+	Subject string
+	Date    time.Time
+
+	// the 32kadpcm encoded voice message and its duration
+	Voice    []byte
+	Duration time.Duration
+
+	// optional 32kadpcm encoded originator spoken name
+	SpokenName []byte
+
+	// optional originator vCard (text/directory)
+	VCard []byte
+
+	// optional Sensitivity header (Personal, Private, Company-Confidential)
+	Sensitivity string
+}
+
+// the validation problems of a VPIM message
+type VPIMError struct {
+	Problems []string
+}
+
+func (e *VPIMError) Error() string {
+	return "mailbuilder: invalid VPIM message: " + strings.Join(e.Problems, "; ")
+}
+
+// build a VPIM v2 multipart/voice-message
+func NewVPIMMessage(v VPIMMessage) *Message {
+	date := v.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	subject := v.Subject
+	if subject == "" {
+		subject = "Voice message"
+	}
+
+	m := NewMessage()
+	m.SetHeaderField("From", v.From)
+	m.SetHeaderField("To", v.To)
+	m.SetHeaderField("Date", date.Format(time.RFC1123Z))
+	m.SetHeaderField("Subject", subject)
+	if v.Sensitivity != "" {
+		m.SetHeaderField("Sensitivity", v.Sensitivity)
+	}
+	m.SetHeaderField("MIME-Version", "1.0")
+	m.setMultipartContentType("voice-message", map[string]string{"version": "2.0"})
+
+	if len(v.SpokenName) > 0 {
+		m.AddPart(newVoicePart(v.SpokenName, OriginatorSpokenName, 0))
+	}
+	m.AddPart(newVoicePart(v.Voice, VoiceMessage, v.Duration))
+
+	if len(v.VCard) > 0 {
+		vcard := NewPart(`text/directory; charset=utf-8; profile="vCard"`, v.VCard, "quoted-printable")
+		vcard.SetHeaderField("Content-Disposition", "attachment")
+		m.AddPart(vcard)
+	}
+	return m
+}
+
+// create an audio/32kadpcm part
+func newVoicePart(audio []byte, voice string, duration time.Duration) *Message {
+	p := NewPart(vpimAudioType, audio, "base64")
+	p.SetHeaderField("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"voice": voice}))
+	if duration > 0 {
+		p.SetHeaderField("Content-Duration", strconv.FormatInt(int64(duration/time.Second), 10))
+	}
+	return p
+}
+
+// check if the message is a VPIM voice message
+func IsVPIM(m *Message) bool {
+	return m.MediaType() == "multipart/voice-message"
+}
+
+// return the voice parameter of the Content-Disposition of a part
+func voiceDisposition(p *Message) string {
+	_, params, err := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["voice"]
+}
+
+// return the first part with the given voice content (Voice-Message, ...)
+func VPIMVoicePart(m *Message, voice string) *Message {
+	for _, p := range m.Parts {
+		if strings.EqualFold(voiceDisposition(p), voice) {
+			return p
+		}
+	}
+	return nil
+}
+
+// validate the structure and the required headers of a VPIM v2 message
+func ValidateVPIM(m *Message) error {
+	var problems []string
+
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || !IsVPIM(m) {
+		problems = append(problems, "content type must be multipart/voice-message")
+	} else if params["version"] != "2.0" {
+		problems = append(problems, fmt.Sprintf("unsupported version %q", params["version"]))
+	}
+	if strings.TrimSpace(m.GetHeader("MIME-Version")) != "1.0" {
+		problems = append(problems, "MIME-Version 1.0 is required")
+	}
+	for _, field := range []string{"From", "To", "Date"} {
+		if m.GetHeader(field) == "" {
+			problems = append(problems, field+" header is required")
+		}
+	}
+
+	voiceParts := 0
+	for _, p := range m.Parts {
+		mediaType := p.MediaType()
+		if !strings.HasPrefix(mediaType, "audio/") {
+			continue
+		}
+		if mediaType != vpimAudioType {
+			problems = append(problems, fmt.Sprintf("part %s: audio must be %s, got %s", p.Idx, vpimAudioType, mediaType))
+		}
+		voice := voiceDisposition(p)
+		if voice == "" {
+			problems = append(problems, fmt.Sprintf("part %s: Content-Disposition voice parameter is required", p.Idx))
+		}
+		if strings.EqualFold(voice, VoiceMessage) {
+			voiceParts++
+		}
+	}
+	if voiceParts == 0 && m.Header.Get("Content-Type") != "" && IsVPIM(m) {
+		problems = append(problems, "no "+VoiceMessage+" audio part")
+	}
+
+	if len(problems) > 0 {
+		return &VPIMError{Problems: problems}
+	}
+	return nil
+}